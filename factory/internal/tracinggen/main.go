@@ -0,0 +1,287 @@
+// Command tracinggen generates wrappers of the interfaces of a package,
+// which start a span per method by util.TraceScope.
+//
+// Every "XxxInterface" type of the package is wrapped by "tracedXxx<suffix>",
+// and the factory wraps an implementation by "r.traceXxx<suffix>(next)".
+// Spans are named "Xxx<suffix>.Method", and record the error if the last result is an error.
+//
+//	//go:generate go run ./internal/tracinggen -pkg github.com/example/service -suffix Service -out tracing_services.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const utilPath = "github.com/itomofumi/go-gin-xorm-starter/util"
+
+func main() {
+	pkgPath := flag.String("pkg", "", "import path of the package whose interfaces are wrapped")
+	suffix := flag.String("suffix", "", "suffix of the wrapper and span names, e.g. Service")
+	children := flag.String("children", "", "spans started inside the wrapped methods, for the doc comment")
+	out := flag.String("out", "", "output file")
+	flag.Parse()
+	if *pkgPath == "" || *suffix == "" || *out == "" {
+		flag.Usage()
+		log.Fatal("-pkg, -suffix and -out are required")
+	}
+
+	file, err := generate(*pkgPath, *suffix, *children)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, file, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// wrapper is an interface to be wrapped.
+type wrapper struct {
+	Name    string
+	Suffix  string
+	Pkg     string
+	Methods []*method
+}
+
+// method is a method of the interface.
+type method struct {
+	Name    string
+	Params  string
+	Args    string
+	Results string
+	// Vars receive the results, the last of which is err if ReturnsError.
+	Vars         string
+	ReturnsError bool
+}
+
+func generate(pkgPath, suffix, children string) ([]byte, error) {
+	pkg, err := build.Import(pkgPath, ".", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, filename := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, filename), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	locals := localTypes(files)
+	imports := map[string]string{utilPath: "util", pkg.ImportPath: pkg.Name}
+	var wrappers []*wrapper
+	for _, f := range files {
+		r := &renderer{fset: fset, pkg: pkg.Name, locals: locals, fileImports: fileImports(f), used: imports}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				it, ok := ts.Type.(*ast.InterfaceType)
+				if !ok || !ts.Name.IsExported() || !strings.HasSuffix(ts.Name.Name, "Interface") {
+					continue
+				}
+				w := &wrapper{Name: strings.TrimSuffix(ts.Name.Name, "Interface"), Suffix: suffix, Pkg: pkg.Name}
+				for _, field := range it.Methods.List {
+					ft, ok := field.Type.(*ast.FuncType)
+					if !ok {
+						return nil, fmt.Errorf("%v embeds %v, which is not supported", ts.Name.Name, r.expr(field.Type))
+					}
+					w.Methods = append(w.Methods, r.method(field.Names[0].Name, ft))
+				}
+				wrappers = append(wrappers, w)
+			}
+		}
+	}
+	sort.Slice(wrappers, func(i, j int) bool { return wrappers[i].Name < wrappers[j].Name })
+
+	// standard packages are grouped first.
+	var std, paths []string
+	for path := range imports {
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			paths = append(paths, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	err = fileTemplate.Execute(&buf, map[string]interface{}{
+		"Std":      std,
+		"Imports":  paths,
+		"Kind":     plural(strings.ToLower(suffix)),
+		"Children": children,
+		"Wrappers": wrappers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// renderer prints types of a file as seen from the factory package.
+type renderer struct {
+	fset *token.FileSet
+	pkg  string
+	// locals are types declared in the package, which are qualified by the package name.
+	locals      map[string]bool
+	fileImports map[string]string
+	// used collects import paths of the printed types.
+	used map[string]string
+}
+
+func (r *renderer) method(name string, ft *ast.FuncType) *method {
+	m := &method{Name: name}
+
+	var params, args []string
+	for _, field := range ft.Params.List {
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{ast.NewIdent("arg" + strconv.Itoa(len(params)))}
+		}
+		for _, n := range names {
+			params = append(params, n.Name+" "+r.expr(field.Type))
+			if _, ok := field.Type.(*ast.Ellipsis); ok {
+				args = append(args, n.Name+"...")
+			} else {
+				args = append(args, n.Name)
+			}
+		}
+	}
+	m.Params = strings.Join(params, ", ")
+	m.Args = strings.Join(args, ", ")
+
+	var results []string
+	if ft.Results != nil {
+		for _, field := range ft.Results.List {
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				results = append(results, r.expr(field.Type))
+			}
+		}
+	}
+	switch len(results) {
+	case 0:
+	case 1:
+		m.Results = results[0]
+	default:
+		m.Results = "(" + strings.Join(results, ", ") + ")"
+	}
+
+	m.ReturnsError = len(results) > 0 && results[len(results)-1] == "error"
+	if !m.ReturnsError {
+		return m
+	}
+	var vars []string
+	switch len(results) {
+	case 1:
+	case 2:
+		vars = append(vars, "res")
+	default:
+		for i := range results[:len(results)-1] {
+			vars = append(vars, "res"+strconv.Itoa(i))
+		}
+	}
+	m.Vars = strings.Join(append(vars, "err"), ", ")
+	return m
+}
+
+// expr prints the type, qualifying local types and recording imports.
+func (r *renderer) expr(e ast.Expr) string {
+	e = r.qualify(e)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, r.fset, e); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+func (r *renderer) qualify(e ast.Expr) ast.Expr {
+	switch t := e.(type) {
+	case *ast.Ident:
+		if r.locals[t.Name] {
+			return &ast.SelectorExpr{X: ast.NewIdent(r.pkg), Sel: t}
+		}
+		return t
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok {
+			if path, ok := r.fileImports[x.Name]; ok {
+				r.used[path] = x.Name
+			}
+		}
+		return t
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: r.qualify(t.X)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: t.Len, Elt: r.qualify(t.Elt)}
+	case *ast.MapType:
+		return &ast.MapType{Key: r.qualify(t.Key), Value: r.qualify(t.Value)}
+	case *ast.Ellipsis:
+		return &ast.Ellipsis{Elt: r.qualify(t.Elt)}
+	case *ast.ChanType:
+		return &ast.ChanType{Dir: t.Dir, Value: r.qualify(t.Value)}
+	}
+	panic(fmt.Sprintf("unsupported type %T", e))
+}
+
+// localTypes returns exported types declared in the package.
+func localTypes(files []*ast.File) map[string]bool {
+	locals := map[string]bool{}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				if name := spec.(*ast.TypeSpec).Name; name.IsExported() {
+					locals[name.Name] = true
+				}
+			}
+		}
+	}
+	return locals
+}
+
+// fileImports maps the names of imports of the file to their paths.
+func fileImports(f *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = path
+	}
+	return imports
+}
+
+func plural(noun string) string {
+	if strings.HasSuffix(noun, "y") {
+		return strings.TrimSuffix(noun, "y") + "ies"
+	}
+	return noun + "s"
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// TestGenerate fails if the checked-in wrappers are out of date. Run `go generate ./factory`.
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		pkg      string
+		suffix   string
+		children string
+		file     string
+	}{
+		{"github.com/itomofumi/go-gin-xorm-starter/repository", "Repository", "SQL and KVS spans", "../../tracing_repositories.go"},
+		{"github.com/itomofumi/go-gin-xorm-starter/service", "Service", "repository spans", "../../tracing_services.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.suffix, func(t *testing.T) {
+			got, err := generate(tt.pkg, tt.suffix, tt.children)
+			if err != nil {
+				t.Fatalf("generate() error = %v", err)
+			}
+			want, err := ioutil.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%v is out of date. run go generate ./factory", tt.file)
+			}
+		})
+	}
+}
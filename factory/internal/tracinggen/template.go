@@ -0,0 +1,46 @@
+package main
+
+import "text/template"
+
+// fileTemplate renders the wrappers in the factory package.
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by tracinggen. DO NOT EDIT.
+
+package factory
+
+import (
+{{- range .Std}}
+	"{{.}}"
+{{- end}}
+{{if .Std}}
+{{end}}
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+
+// traced {{.Kind}} start a span per method{{if .Children}}, which is the parent of {{.Children}}{{end}}.
+{{range $w := .Wrappers}}
+type traced{{$w.Name}}{{$w.Suffix}} struct {
+	next  {{$w.Pkg}}.{{$w.Name}}Interface
+	scope *util.TraceScope
+}
+
+func (r *Service) trace{{$w.Name}}{{$w.Suffix}}(next {{$w.Pkg}}.{{$w.Name}}Interface) {{$w.Pkg}}.{{$w.Name}}Interface {
+	if r.scope == nil {
+		return next
+	}
+	return &traced{{$w.Name}}{{$w.Suffix}}{next, r.scope}
+}
+{{range $w.Methods}}
+func (t *traced{{$w.Name}}{{$w.Suffix}}) {{.Name}}({{.Params}}) {{.Results}} {
+{{- if .ReturnsError}}
+	end := t.scope.Start("{{$w.Name}}{{$w.Suffix}}.{{.Name}}")
+	{{.Vars}} := t.next.{{.Name}}({{.Args}})
+	end(err)
+	return {{.Vars}}
+{{- else}}
+	defer t.scope.Start("{{$w.Name}}{{$w.Suffix}}.{{.Name}}")(nil)
+	{{if .Results}}return {{end}}t.next.{{.Name}}({{.Args}})
+{{- end}}
+}
+{{end}}{{end}}`))
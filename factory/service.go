@@ -1,11 +1,17 @@
 package factory
 
 import (
+	"context"
+
 	"github.com/itomofumi/go-gin-xorm-starter/infra"
 	"github.com/itomofumi/go-gin-xorm-starter/repository"
 	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
 )
 
+//go:generate go run ./internal/tracinggen -pkg github.com/itomofumi/go-gin-xorm-starter/repository -suffix Repository -children "SQL and KVS spans" -out tracing_repositories.go
+//go:generate go run ./internal/tracinggen -pkg github.com/itomofumi/go-gin-xorm-starter/service -suffix Service -children "repository spans" -out tracing_services.go
+
 const (
 	// ServiceKey はサービスファクトリ取得キー名
 	ServiceKey = "service_factory"
@@ -15,6 +21,17 @@ const (
 type Servicer interface {
 	NewUsers() service.UsersInterface
 	NewFruits() service.FruitsInterface
+	NewVerifications() service.VerificationsInterface
+	NewLogins() service.LoginsInterface
+	NewAPIKeys() service.APIKeysInterface
+	NewSessions() service.SessionsInterface
+	NewCookieSessions() service.CookieSessionsInterface
+}
+
+// ContextServicer はリクエストのcontextを渡せるサービスファクトリ
+type ContextServicer interface {
+	Servicer
+	WithContext(ctx context.Context) Servicer
 }
 
 // Service はサービスファクトリの実装
@@ -22,25 +39,76 @@ type Servicer interface {
 type Service struct {
 	engine    infra.EngineInterface
 	kvsClient infra.KVSClientInterface
+	mailer    infra.Mailer
+	// scope traces services and repositories of a request. nil unless WithContext.
+	scope *util.TraceScope
+
+	verificationConfig *service.VerificationConfig
+	sessionConfig      *service.SessionConfig
 }
 
 // NewService initializes factory with injected infra.
-func NewService(engine infra.EngineInterface, kvsClient infra.KVSClientInterface) *Service {
+func NewService(engine infra.EngineInterface, kvsClient infra.KVSClientInterface, mailer infra.Mailer) *Service {
 	r := &Service{
 		engine:    engine,
 		kvsClient: kvsClient,
+		mailer:    mailer,
+
+		verificationConfig: service.LoadVerificationConfigEnv(),
+		sessionConfig:      service.LoadSessionConfigEnv(),
 	}
 	return r
 }
 
+// WithContext returns the factory whose services run queries with ctx,
+// and trace spans of services, repositories, SQL and KVS as children of the span of ctx.
+func (r *Service) WithContext(ctx context.Context) Servicer {
+	s := *r
+	s.scope = util.NewTraceScope(ctx)
+	s.engine = infra.WithContextFunc(r.engine, s.scope.Context)
+	s.kvsClient = infra.TraceKVS(r.kvsClient, s.scope.Context)
+	return &s
+}
+
 // NewFruits returns Fruits service.
 func (r *Service) NewFruits() service.FruitsInterface {
-	repo := repository.NewFruits(r.engine)
-	return service.NewFruits(repo)
+	repo := r.traceFruitsRepository(repository.NewFruits(r.engine))
+	return r.traceFruitsService(service.NewFruits(repo))
 }
 
 // NewUsers returns Users service.
 func (r *Service) NewUsers() service.UsersInterface {
-	repo := repository.NewUsers(r.engine, r.kvsClient)
-	return service.NewUsers(repo)
+	repo := r.traceUsersRepository(repository.NewUsers(r.engine, r.kvsClient))
+	return r.traceUsersService(service.NewUsers(repo))
+}
+
+// NewVerifications returns email verification service.
+func (r *Service) NewVerifications() service.VerificationsInterface {
+	repo := r.traceUsersRepository(repository.NewUsers(r.engine, r.kvsClient))
+	return r.traceVerificationsService(service.NewVerifications(repo, r.mailer, r.verificationConfig))
+}
+
+// NewLogins returns login history service.
+func (r *Service) NewLogins() service.LoginsInterface {
+	repo := r.traceLoginsRepository(repository.NewLogins(r.engine, r.kvsClient))
+	return r.traceLoginsService(service.NewLogins(repo))
+}
+
+// NewAPIKeys returns API keys service.
+func (r *Service) NewAPIKeys() service.APIKeysInterface {
+	repo := r.traceAPIKeysRepository(repository.NewAPIKeys(r.engine))
+	users := r.traceUsersRepository(repository.NewUsers(r.engine, r.kvsClient))
+	return r.traceAPIKeysService(service.NewAPIKeys(repo, users))
+}
+
+// NewSessions returns login sessions service.
+func (r *Service) NewSessions() service.SessionsInterface {
+	repo := r.traceSessionsRepository(repository.NewSessions(r.engine, r.kvsClient, r.sessionConfig.RevocationTTL))
+	return r.traceSessionsService(service.NewSessions(repo))
+}
+
+// NewCookieSessions returns browser cookie sessions service.
+func (r *Service) NewCookieSessions() service.CookieSessionsInterface {
+	repo := r.traceCookieSessionsRepository(repository.NewCookieSessions(r.kvsClient))
+	return r.traceCookieSessionsService(service.NewCookieSessions(repo, r.sessionConfig))
 }
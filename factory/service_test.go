@@ -1,6 +1,7 @@
 package factory_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/itomofumi/go-gin-xorm-starter/factory"
@@ -15,8 +16,18 @@ type KVSClientMock struct {
 	infra.KVSClientInterface
 }
 
+type MailerMock struct {
+	infra.Mailer
+}
+
 func TestNew(t *testing.T) {
-	factory := factory.NewService(&EngineMock{}, &KVSClientMock{})
+	factory := factory.NewService(&EngineMock{}, &KVSClientMock{}, &MailerMock{})
 	factory.NewFruits()
 	factory.NewUsers()
+	factory.NewVerifications()
+	factory.NewLogins()
+	factory.NewAPIKeys()
+	factory.NewSessions()
+	factory.NewCookieSessions()
+	factory.WithContext(context.Background()).NewFruits()
 }
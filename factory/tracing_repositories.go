@@ -0,0 +1,299 @@
+// Code generated by tracinggen. DO NOT EDIT.
+
+package factory
+
+import (
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+// traced repositories start a span per method, which is the parent of SQL and KVS spans.
+
+type tracedAPIKeysRepository struct {
+	next  repository.APIKeysInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceAPIKeysRepository(next repository.APIKeysInterface) repository.APIKeysInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedAPIKeysRepository{next, r.scope}
+}
+
+func (t *tracedAPIKeysRepository) Create(key *model.APIKey) error {
+	end := t.scope.Start("APIKeysRepository.Create")
+	err := t.next.Create(key)
+	end(err)
+	return err
+}
+
+func (t *tracedAPIKeysRepository) GetByUserID(userID uint64) ([]*model.APIKey, error) {
+	end := t.scope.Start("APIKeysRepository.GetByUserID")
+	res, err := t.next.GetByUserID(userID)
+	end(err)
+	return res, err
+}
+
+func (t *tracedAPIKeysRepository) GetByPrefix(prefix string) (*model.APIKey, bool) {
+	defer t.scope.Start("APIKeysRepository.GetByPrefix")(nil)
+	return t.next.GetByPrefix(prefix)
+}
+
+func (t *tracedAPIKeysRepository) Revoke(userID uint64, id uint64, revokedAt time.Time) (bool, error) {
+	end := t.scope.Start("APIKeysRepository.Revoke")
+	res, err := t.next.Revoke(userID, id, revokedAt)
+	end(err)
+	return res, err
+}
+
+func (t *tracedAPIKeysRepository) Touch(id uint64, usedAt time.Time) error {
+	end := t.scope.Start("APIKeysRepository.Touch")
+	err := t.next.Touch(id, usedAt)
+	end(err)
+	return err
+}
+
+type tracedCookieSessionsRepository struct {
+	next  repository.CookieSessionsInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceCookieSessionsRepository(next repository.CookieSessionsInterface) repository.CookieSessionsInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedCookieSessionsRepository{next, r.scope}
+}
+
+func (t *tracedCookieSessionsRepository) Create(id string, session *model.CookieSession, ttl time.Duration) error {
+	end := t.scope.Start("CookieSessionsRepository.Create")
+	err := t.next.Create(id, session, ttl)
+	end(err)
+	return err
+}
+
+func (t *tracedCookieSessionsRepository) Get(id string) (*model.CookieSession, error) {
+	end := t.scope.Start("CookieSessionsRepository.Get")
+	res, err := t.next.Get(id)
+	end(err)
+	return res, err
+}
+
+func (t *tracedCookieSessionsRepository) Delete(id string) error {
+	end := t.scope.Start("CookieSessionsRepository.Delete")
+	err := t.next.Delete(id)
+	end(err)
+	return err
+}
+
+type tracedFruitsRepository struct {
+	next  repository.FruitsInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceFruitsRepository(next repository.FruitsInterface) repository.FruitsInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedFruitsRepository{next, r.scope}
+}
+
+func (t *tracedFruitsRepository) GetAll() ([]*model.Fruit, error) {
+	end := t.scope.Start("FruitsRepository.GetAll")
+	res, err := t.next.GetAll()
+	end(err)
+	return res, err
+}
+
+func (t *tracedFruitsRepository) GetByID(fruitID uint64) (*model.Fruit, error) {
+	end := t.scope.Start("FruitsRepository.GetByID")
+	res, err := t.next.GetByID(fruitID)
+	end(err)
+	return res, err
+}
+
+func (t *tracedFruitsRepository) Create(body *model.FruitBody) (*model.Fruit, error) {
+	end := t.scope.Start("FruitsRepository.Create")
+	res, err := t.next.Create(body)
+	end(err)
+	return res, err
+}
+
+func (t *tracedFruitsRepository) Update(fruitID uint64, body *model.FruitBody) (*model.Fruit, error) {
+	end := t.scope.Start("FruitsRepository.Update")
+	res, err := t.next.Update(fruitID, body)
+	end(err)
+	return res, err
+}
+
+func (t *tracedFruitsRepository) Delete(fruitID uint64) error {
+	end := t.scope.Start("FruitsRepository.Delete")
+	err := t.next.Delete(fruitID)
+	end(err)
+	return err
+}
+
+type tracedLoginsRepository struct {
+	next  repository.LoginsInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceLoginsRepository(next repository.LoginsInterface) repository.LoginsInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedLoginsRepository{next, r.scope}
+}
+
+func (t *tracedLoginsRepository) Record(login *model.Login, loggedInAt time.Time) (bool, error) {
+	end := t.scope.Start("LoginsRepository.Record")
+	res, err := t.next.Record(login, loggedInAt)
+	end(err)
+	return res, err
+}
+
+func (t *tracedLoginsRepository) GetByUserID(userID uint64, limit int) ([]*model.Login, error) {
+	end := t.scope.Start("LoginsRepository.GetByUserID")
+	res, err := t.next.GetByUserID(userID, limit)
+	end(err)
+	return res, err
+}
+
+type tracedSessionsRepository struct {
+	next  repository.SessionsInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceSessionsRepository(next repository.SessionsInterface) repository.SessionsInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedSessionsRepository{next, r.scope}
+}
+
+func (t *tracedSessionsRepository) GetActiveByUserID(userID uint64, limit int) ([]*model.Login, error) {
+	end := t.scope.Start("SessionsRepository.GetActiveByUserID")
+	res, err := t.next.GetActiveByUserID(userID, limit)
+	end(err)
+	return res, err
+}
+
+func (t *tracedSessionsRepository) Revoke(userID uint64, id uint64, revokedAt time.Time) (bool, error) {
+	end := t.scope.Start("SessionsRepository.Revoke")
+	res, err := t.next.Revoke(userID, id, revokedAt)
+	end(err)
+	return res, err
+}
+
+func (t *tracedSessionsRepository) RevokeAll(userID uint64, revokedAt time.Time) error {
+	end := t.scope.Start("SessionsRepository.RevokeAll")
+	err := t.next.RevokeAll(userID, revokedAt)
+	end(err)
+	return err
+}
+
+func (t *tracedSessionsRepository) IsRevoked(iss string, sub string, sessionIDs []string, issuedAt time.Time) (bool, error) {
+	end := t.scope.Start("SessionsRepository.IsRevoked")
+	res, err := t.next.IsRevoked(iss, sub, sessionIDs, issuedAt)
+	end(err)
+	return res, err
+}
+
+func (t *tracedSessionsRepository) RestoreRevocations(now time.Time) (int, error) {
+	end := t.scope.Start("SessionsRepository.RestoreRevocations")
+	res, err := t.next.RestoreRevocations(now)
+	end(err)
+	return res, err
+}
+
+func (t *tracedSessionsRepository) RevocationsLost() (bool, error) {
+	end := t.scope.Start("SessionsRepository.RevocationsLost")
+	res, err := t.next.RevocationsLost()
+	end(err)
+	return res, err
+}
+
+type tracedUsersRepository struct {
+	next  repository.UsersInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceUsersRepository(next repository.UsersInterface) repository.UsersInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedUsersRepository{next, r.scope}
+}
+
+func (t *tracedUsersRepository) GetByEmail(email string) (*model.User, bool) {
+	defer t.scope.Start("UsersRepository.GetByEmail")(nil)
+	return t.next.GetByEmail(email)
+}
+
+func (t *tracedUsersRepository) GetBySub(iss string, sub string) (*model.User, bool) {
+	defer t.scope.Start("UsersRepository.GetBySub")(nil)
+	return t.next.GetBySub(iss, sub)
+}
+
+func (t *tracedUsersRepository) GetByID(id uint64) (*model.User, bool) {
+	defer t.scope.Start("UsersRepository.GetByID")(nil)
+	return t.next.GetByID(id)
+}
+
+func (t *tracedUsersRepository) LinkSub(email string, iss string, sub string) (*model.User, bool) {
+	defer t.scope.Start("UsersRepository.LinkSub")(nil)
+	return t.next.LinkSub(email, iss, sub)
+}
+
+func (t *tracedUsersRepository) Create(email string, profile *model.UserProfile) (*model.UserPublicData, error) {
+	end := t.scope.Start("UsersRepository.Create")
+	res, err := t.next.Create(email, profile)
+	end(err)
+	return res, err
+}
+
+func (t *tracedUsersRepository) Verify(userID uint64) error {
+	end := t.scope.Start("UsersRepository.Verify")
+	err := t.next.Verify(userID)
+	end(err)
+	return err
+}
+
+func (t *tracedUsersRepository) MarkVerificationSent(userID uint64, sentAt time.Time, interval time.Duration) (bool, error) {
+	end := t.scope.Start("UsersRepository.MarkVerificationSent")
+	res, err := t.next.MarkVerificationSent(userID, sentAt, interval)
+	end(err)
+	return res, err
+}
+
+func (t *tracedUsersRepository) UnmarkVerificationSent(userID uint64, sentAt time.Time) error {
+	end := t.scope.Start("UsersRepository.UnmarkVerificationSent")
+	err := t.next.UnmarkVerificationSent(userID, sentAt)
+	end(err)
+	return err
+}
+
+func (t *tracedUsersRepository) ConsumeVerification(userID uint64, sentAt time.Time) (bool, error) {
+	end := t.scope.Start("UsersRepository.ConsumeVerification")
+	res, err := t.next.ConsumeVerification(userID, sentAt)
+	end(err)
+	return res, err
+}
+
+func (t *tracedUsersRepository) Update(id uint64, profile *model.UserProfile) (*model.UserPublicData, error) {
+	end := t.scope.Start("UsersRepository.Update")
+	res, err := t.next.Update(id, profile)
+	end(err)
+	return res, err
+}
+
+func (t *tracedUsersRepository) Delete(id uint64) error {
+	end := t.scope.Start("UsersRepository.Delete")
+	err := t.next.Delete(id)
+	end(err)
+	return err
+}
@@ -0,0 +1,299 @@
+// Code generated by tracinggen. DO NOT EDIT.
+
+package factory
+
+import (
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+// traced services start a span per method, which is the parent of repository spans.
+
+type tracedAPIKeysService struct {
+	next  service.APIKeysInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceAPIKeysService(next service.APIKeysInterface) service.APIKeysInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedAPIKeysService{next, r.scope}
+}
+
+func (t *tracedAPIKeysService) Create(userID uint64, body *model.APIKeyCreateBody) (*model.APIKeyCreated, error) {
+	end := t.scope.Start("APIKeysService.Create")
+	res, err := t.next.Create(userID, body)
+	end(err)
+	return res, err
+}
+
+func (t *tracedAPIKeysService) GetByUserID(userID uint64) ([]*model.APIKey, error) {
+	end := t.scope.Start("APIKeysService.GetByUserID")
+	res, err := t.next.GetByUserID(userID)
+	end(err)
+	return res, err
+}
+
+func (t *tracedAPIKeysService) Revoke(userID uint64, id uint64) error {
+	end := t.scope.Start("APIKeysService.Revoke")
+	err := t.next.Revoke(userID, id)
+	end(err)
+	return err
+}
+
+func (t *tracedAPIKeysService) Authenticate(token string) (*model.APIKey, *model.User, error) {
+	end := t.scope.Start("APIKeysService.Authenticate")
+	res0, res1, err := t.next.Authenticate(token)
+	end(err)
+	return res0, res1, err
+}
+
+type tracedCookieSessionsService struct {
+	next  service.CookieSessionsInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceCookieSessionsService(next service.CookieSessionsInterface) service.CookieSessionsInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedCookieSessionsService{next, r.scope}
+}
+
+func (t *tracedCookieSessionsService) Create(session *model.CookieSession) (string, error) {
+	end := t.scope.Start("CookieSessionsService.Create")
+	res, err := t.next.Create(session)
+	end(err)
+	return res, err
+}
+
+func (t *tracedCookieSessionsService) Get(id string) (*model.CookieSession, error) {
+	end := t.scope.Start("CookieSessionsService.Get")
+	res, err := t.next.Get(id)
+	end(err)
+	return res, err
+}
+
+func (t *tracedCookieSessionsService) Delete(id string) error {
+	end := t.scope.Start("CookieSessionsService.Delete")
+	err := t.next.Delete(id)
+	end(err)
+	return err
+}
+
+type tracedFruitsService struct {
+	next  service.FruitsInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceFruitsService(next service.FruitsInterface) service.FruitsInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedFruitsService{next, r.scope}
+}
+
+func (t *tracedFruitsService) GetAll() ([]*model.Fruit, error) {
+	end := t.scope.Start("FruitsService.GetAll")
+	res, err := t.next.GetAll()
+	end(err)
+	return res, err
+}
+
+func (t *tracedFruitsService) GetByID(fruitID uint64) (*model.Fruit, error) {
+	end := t.scope.Start("FruitsService.GetByID")
+	res, err := t.next.GetByID(fruitID)
+	end(err)
+	return res, err
+}
+
+func (t *tracedFruitsService) Create(body *model.FruitBody) (*model.Fruit, error) {
+	end := t.scope.Start("FruitsService.Create")
+	res, err := t.next.Create(body)
+	end(err)
+	return res, err
+}
+
+func (t *tracedFruitsService) Update(fruitID uint64, notice *model.FruitBody) (*model.Fruit, error) {
+	end := t.scope.Start("FruitsService.Update")
+	res, err := t.next.Update(fruitID, notice)
+	end(err)
+	return res, err
+}
+
+func (t *tracedFruitsService) Delete(fruitID uint64) error {
+	end := t.scope.Start("FruitsService.Delete")
+	err := t.next.Delete(fruitID)
+	end(err)
+	return err
+}
+
+type tracedLoginsService struct {
+	next  service.LoginsInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceLoginsService(next service.LoginsInterface) service.LoginsInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedLoginsService{next, r.scope}
+}
+
+func (t *tracedLoginsService) Record(userID uint64, sessionID string, ip string, userAgent string) (*model.Login, bool, error) {
+	end := t.scope.Start("LoginsService.Record")
+	res0, res1, err := t.next.Record(userID, sessionID, ip, userAgent)
+	end(err)
+	return res0, res1, err
+}
+
+func (t *tracedLoginsService) GetByUserID(userID uint64) ([]*model.Login, error) {
+	end := t.scope.Start("LoginsService.GetByUserID")
+	res, err := t.next.GetByUserID(userID)
+	end(err)
+	return res, err
+}
+
+type tracedSessionsService struct {
+	next  service.SessionsInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceSessionsService(next service.SessionsInterface) service.SessionsInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedSessionsService{next, r.scope}
+}
+
+func (t *tracedSessionsService) GetActiveByUserID(userID uint64, currentSessionID string) ([]*model.Session, error) {
+	end := t.scope.Start("SessionsService.GetActiveByUserID")
+	res, err := t.next.GetActiveByUserID(userID, currentSessionID)
+	end(err)
+	return res, err
+}
+
+func (t *tracedSessionsService) Revoke(userID uint64, id uint64) error {
+	end := t.scope.Start("SessionsService.Revoke")
+	err := t.next.Revoke(userID, id)
+	end(err)
+	return err
+}
+
+func (t *tracedSessionsService) RevokeAll(userID uint64) error {
+	end := t.scope.Start("SessionsService.RevokeAll")
+	err := t.next.RevokeAll(userID)
+	end(err)
+	return err
+}
+
+func (t *tracedSessionsService) IsRevoked(iss string, sub string, sessionIDs []string, issuedAt time.Time) (bool, error) {
+	end := t.scope.Start("SessionsService.IsRevoked")
+	res, err := t.next.IsRevoked(iss, sub, sessionIDs, issuedAt)
+	end(err)
+	return res, err
+}
+
+func (t *tracedSessionsService) RestoreRevocations() (int, error) {
+	end := t.scope.Start("SessionsService.RestoreRevocations")
+	res, err := t.next.RestoreRevocations()
+	end(err)
+	return res, err
+}
+
+func (t *tracedSessionsService) RestoreRevocationsIfLost() (int, error) {
+	end := t.scope.Start("SessionsService.RestoreRevocationsIfLost")
+	res, err := t.next.RestoreRevocationsIfLost()
+	end(err)
+	return res, err
+}
+
+type tracedUsersService struct {
+	next  service.UsersInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceUsersService(next service.UsersInterface) service.UsersInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedUsersService{next, r.scope}
+}
+
+func (t *tracedUsersService) Create(email string, profile *model.UserProfile) (*model.UserPublicData, error) {
+	end := t.scope.Start("UsersService.Create")
+	res, err := t.next.Create(email, profile)
+	end(err)
+	return res, err
+}
+
+func (t *tracedUsersService) GetByID(id uint64) (*model.User, bool) {
+	defer t.scope.Start("UsersService.GetByID")(nil)
+	return t.next.GetByID(id)
+}
+
+func (t *tracedUsersService) GetByEmail(email string) (*model.User, bool) {
+	defer t.scope.Start("UsersService.GetByEmail")(nil)
+	return t.next.GetByEmail(email)
+}
+
+func (t *tracedUsersService) GetBySub(iss string, sub string) (*model.User, bool) {
+	defer t.scope.Start("UsersService.GetBySub")(nil)
+	return t.next.GetBySub(iss, sub)
+}
+
+func (t *tracedUsersService) LinkSub(email string, iss string, sub string) (*model.User, bool) {
+	defer t.scope.Start("UsersService.LinkSub")(nil)
+	return t.next.LinkSub(email, iss, sub)
+}
+
+func (t *tracedUsersService) Verify(userID uint64) error {
+	end := t.scope.Start("UsersService.Verify")
+	err := t.next.Verify(userID)
+	end(err)
+	return err
+}
+
+func (t *tracedUsersService) Update(id uint64, profile *model.UserProfile) (*model.UserPublicData, error) {
+	end := t.scope.Start("UsersService.Update")
+	res, err := t.next.Update(id, profile)
+	end(err)
+	return res, err
+}
+
+func (t *tracedUsersService) Delete(id uint64) error {
+	end := t.scope.Start("UsersService.Delete")
+	err := t.next.Delete(id)
+	end(err)
+	return err
+}
+
+type tracedVerificationsService struct {
+	next  service.VerificationsInterface
+	scope *util.TraceScope
+}
+
+func (r *Service) traceVerificationsService(next service.VerificationsInterface) service.VerificationsInterface {
+	if r.scope == nil {
+		return next
+	}
+	return &tracedVerificationsService{next, r.scope}
+}
+
+func (t *tracedVerificationsService) Send(email string, locale string) error {
+	end := t.scope.Start("VerificationsService.Send")
+	err := t.next.Send(email, locale)
+	end(err)
+	return err
+}
+
+func (t *tracedVerificationsService) Verify(token string) (*model.User, error) {
+	end := t.scope.Start("VerificationsService.Verify")
+	res, err := t.next.Verify(token)
+	end(err)
+	return res, err
+}
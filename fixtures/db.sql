@@ -15,15 +15,21 @@ CREATE TABLE `users` (
   `is_enabled` tinyint(1) NOT NULL DEFAULT '1',
   `created_at` datetime NOT NULL,
   `updated_at` datetime NOT NULL,
+  `iss` varchar(255) DEFAULT NULL,
+  `sub` varchar(255) DEFAULT NULL,
   `email` varchar(120) NOT NULL,
   `email_verified` tinyint(1) NOT NULL,
   `display_name` varchar(50) DEFAULT NULL,
   `about` text,
   `avatar_url` text,
   `last_login_at` datetime DEFAULT NULL,
+  `verification_sent_at` datetime DEFAULT NULL,
+  `sessions_revoked_at` datetime DEFAULT NULL,
+  `role` varchar(20) NOT NULL DEFAULT 'user',
   PRIMARY KEY (`id`),
   KEY `IDX_users_pk` (`id`),
-  KEY `IDX_users_mail` (`email`)
+  KEY `IDX_users_mail` (`email`),
+  UNIQUE KEY `UQE_users_iss_sub` (`iss`, `sub`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 CREATE TABLE `fruits` (
@@ -38,6 +44,35 @@ CREATE TABLE `fruits` (
   KEY `IDX_fruits_pk` (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `logins` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) NOT NULL,
+  `session_id` varchar(255) NOT NULL,
+  `ip` varchar(45) DEFAULT NULL,
+  `user_agent` text,
+  `created_at` datetime NOT NULL,
+  `revoked_at` datetime DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `UQE_logins_session` (`user_id`, `session_id`),
+  KEY `IDX_logins_revoked_at` (`revoked_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `api_keys` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `prefix` varchar(16) NOT NULL,
+  `secret_hash` varchar(64) NOT NULL,
+  `scopes` text,
+  `expires_at` datetime DEFAULT NULL,
+  `last_used_at` datetime DEFAULT NULL,
+  `revoked_at` datetime DEFAULT NULL,
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `IDX_api_keys_user` (`user_id`),
+  UNIQUE KEY `UQE_api_keys_prefix` (`prefix`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 
 /*
   INSERT DATA
@@ -0,0 +1,14 @@
+/*
+  Identify users by the identity provider's subject ("sub" claim).
+  Existing users are linked to their subject on the first login by email.
+
+  sh ./fixtures/init_db.sh is enough for a new database.
+  For an existing database, run:
+    ENV_FILE=.env go run ./fixtures/init.go ./fixtures/migrations/20201019_add_users_sub.sql
+*/
+
+USE `go-gin-xorm-starter`;
+
+ALTER TABLE `users`
+  ADD COLUMN `sub` varchar(255) DEFAULT NULL AFTER `updated_at`,
+  ADD UNIQUE KEY `UQE_users_sub` (`sub`);
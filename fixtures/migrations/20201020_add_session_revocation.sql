@@ -0,0 +1,16 @@
+/*
+  Revoke login sessions per device, or all sessions of a user ("log out everywhere").
+
+  sh ./fixtures/init_db.sh is enough for a new database.
+  For an existing database, run:
+    ENV_FILE=.env go run ./fixtures/init.go ./fixtures/migrations/20201020_add_session_revocation.sql
+*/
+
+USE `go-gin-xorm-starter`;
+
+ALTER TABLE `users`
+  ADD COLUMN `sessions_revoked_at` datetime DEFAULT NULL AFTER `verification_sent_at`;
+
+ALTER TABLE `logins`
+  ADD COLUMN `revoked_at` datetime DEFAULT NULL AFTER `created_at`,
+  ADD KEY `IDX_logins_revoked_at` (`revoked_at`);
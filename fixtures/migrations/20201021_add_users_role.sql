@@ -0,0 +1,12 @@
+/*
+  Add user roles. Admins can act as other users with X-Act-As header.
+
+  sh ./fixtures/init_db.sh is enough for a new database.
+  For an existing database, run:
+    ENV_FILE=.env go run ./fixtures/init.go ./fixtures/migrations/20201021_add_users_role.sql
+*/
+
+USE `go-gin-xorm-starter`;
+
+ALTER TABLE `users`
+  ADD COLUMN `role` varchar(20) NOT NULL DEFAULT 'user' AFTER `sessions_revoked_at`;
@@ -0,0 +1,20 @@
+/*
+  Identify users by the issuer and the subject ("iss" and "sub" claims),
+  since "sub" is unique only within each identity provider.
+
+  Linked users keep NULL "iss" and are not found by their subject until it is set.
+  Set "iss" to the issuer which has been used (e.g. the Cognito user pool) before restarting the server.
+
+  sh ./fixtures/init_db.sh is enough for a new database.
+  For an existing database, run:
+    ENV_FILE=.env go run ./fixtures/init.go ./fixtures/migrations/20201022_add_users_iss.sql
+*/
+
+USE `go-gin-xorm-starter`;
+
+ALTER TABLE `users`
+  ADD COLUMN `iss` varchar(255) DEFAULT NULL AFTER `updated_at`,
+  DROP KEY `UQE_users_sub`,
+  ADD UNIQUE KEY `UQE_users_iss_sub` (`iss`, `sub`);
+
+-- UPDATE `users` SET `iss` = 'https://cognito-idp.<region>.amazonaws.com/<user pool id>' WHERE `sub` IS NOT NULL;
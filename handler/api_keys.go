@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/itomofumi/go-gin-xorm-starter/factory"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+)
+
+// GetMyAPIKeys はAPIキー一覧を取得します
+func GetMyAPIKeys(c *gin.Context) {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	apiKeysService := factory.NewAPIKeys()
+
+	user := c.MustGet("user").(*model.User)
+
+	list, err := apiKeysService.GetByUserID(user.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, err))
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// PostMyAPIKey はAPIキーを発行します
+func PostMyAPIKey(c *gin.Context) {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	apiKeysService := factory.NewAPIKeys()
+
+	user := c.MustGet("user").(*model.User)
+
+	body := model.APIKeyCreateBody{}
+	if err := c.ShouldBindWith(&body, binding.JSON); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, "request body mismatch", err))
+		return
+	}
+
+	created, err := apiKeysService.Create(user.ID, &body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, err))
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// DeleteMyAPIKey はAPIキーを無効化します
+func DeleteMyAPIKey(c *gin.Context) {
+	tokenID := c.MustGet("token-id").(uint64)
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	apiKeysService := factory.NewAPIKeys()
+
+	user := c.MustGet("user").(*model.User)
+
+	err := apiKeysService.Revoke(user.ID, tokenID)
+	if err == service.ErrAPIKeyNotFound {
+		c.AbortWithStatusJSON(http.StatusNotFound, model.NewErrorResponse("404", model.ErrorNotFound, err))
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, err))
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,152 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/itomofumi/go-gin-xorm-starter/handler"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// APIKeysMock is a mock of API keys.
+type APIKeysMock struct {
+	service.APIKeysInterface
+	FakeCreate      func(userID uint64, body *model.APIKeyCreateBody) (*model.APIKeyCreated, error)
+	FakeGetByUserID func(userID uint64) ([]*model.APIKey, error)
+	FakeRevoke      func(userID uint64, id uint64) error
+}
+
+func (km *APIKeysMock) Create(userID uint64, body *model.APIKeyCreateBody) (*model.APIKeyCreated, error) {
+	return km.FakeCreate(userID, body)
+}
+
+func (km *APIKeysMock) GetByUserID(userID uint64) ([]*model.APIKey, error) {
+	return km.FakeGetByUserID(userID)
+}
+
+func (km *APIKeysMock) Revoke(userID uint64, id uint64) error {
+	return km.FakeRevoke(userID, id)
+}
+
+var testAPIKeys = []*model.APIKey{
+	{ID: 1, Name: "batch", Prefix: "0a1b2c3d", Scopes: []string{"fruits:write"}},
+}
+
+func TestGetMyAPIKeys(t *testing.T) {
+	defer Setup()()
+
+	factory := &ServiceFactoryMock{
+		APIKeysMock: &APIKeysMock{
+			FakeGetByUserID: func(userID uint64) ([]*model.APIKey, error) {
+				return testAPIKeys, nil
+			},
+		},
+	}
+	c, w := createGinTestContext(factory)
+	c.Set("user", testUsers[0])
+	handler.GetMyAPIKeys(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var res []*model.APIKey
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Equal(t, testAPIKeys, res)
+}
+
+func TestPostMyAPIKey(t *testing.T) {
+	defer Setup()()
+
+	type fakes struct {
+		create func(userID uint64, body *model.APIKeyCreateBody) (*model.APIKeyCreated, error)
+	}
+	tests := []struct {
+		name       string
+		fakes      fakes
+		body       interface{}
+		wantStatus int
+		want       interface{}
+	}{
+		{"success",
+			fakes{
+				create: func(userID uint64, body *model.APIKeyCreateBody) (*model.APIKeyCreated, error) {
+					return &model.APIKeyCreated{APIKey: *testAPIKeys[0], Token: "gxs_0a1b2c3d_secret"}, nil
+				},
+			},
+			model.APIKeyCreateBody{Name: "batch", Scopes: []string{"fruits:write"}},
+			http.StatusCreated,
+			&model.APIKeyCreated{APIKey: *testAPIKeys[0], Token: "gxs_0a1b2c3d_secret"},
+		},
+		{"no name",
+			fakes{},
+			model.APIKeyCreateBody{},
+			http.StatusBadRequest,
+			model.NewErrorResponse("400", model.ErrorParam, "request body mismatch", "Key: 'APIKeyCreateBody.Name' Error:Field validation for 'Name' failed on the 'required' tag"),
+		},
+		{"failure",
+			fakes{
+				create: func(userID uint64, body *model.APIKeyCreateBody) (*model.APIKeyCreated, error) {
+					return nil, fmt.Errorf("expires_at must be in the future")
+				},
+			},
+			model.APIKeyCreateBody{Name: "batch"},
+			http.StatusBadRequest,
+			model.NewErrorResponse("400", model.ErrorParam, "expires_at must be in the future"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := &ServiceFactoryMock{
+				APIKeysMock: &APIKeysMock{FakeCreate: tt.fakes.create},
+			}
+			c, w := createGinTestContext(factory)
+			c.Set("user", testUsers[0])
+			b, _ := json.Marshal(tt.body)
+			c.Request, _ = http.NewRequest("POST", "/me/tokens", bytes.NewBuffer(b))
+
+			handler.PostMyAPIKey(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			switch want := tt.want.(type) {
+			case *model.APIKeyCreated:
+				var res *model.APIKeyCreated
+				json.Unmarshal(w.Body.Bytes(), &res)
+				assert.Equal(t, want, res)
+			case *model.ErrorResponse:
+				testErrorResponse(t, want, w)
+			}
+		})
+	}
+}
+
+func TestDeleteMyAPIKey(t *testing.T) {
+	defer Setup()()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusNoContent},
+		{"not found", service.ErrAPIKeyNotFound, http.StatusNotFound},
+		{"failure", fmt.Errorf("db error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := &ServiceFactoryMock{
+				APIKeysMock: &APIKeysMock{
+					FakeRevoke: func(userID uint64, id uint64) error { return tt.err },
+				},
+			}
+			c, w := createGinTestContext(factory)
+			c.Set("user", testUsers[0])
+			c.Set("token-id", uint64(1))
+
+			handler.DeleteMyAPIKey(c)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -28,8 +28,12 @@ func Setup() func() {
 // ServiceFactoryMock はServiceFactoryのモック実装です
 type ServiceFactoryMock struct {
 	factory.Servicer
-	FruitsMock service.FruitsInterface
-	UsersMock  service.UsersInterface
+	FruitsMock        service.FruitsInterface
+	UsersMock         service.UsersInterface
+	VerificationsMock service.VerificationsInterface
+	LoginsMock        service.LoginsInterface
+	APIKeysMock       service.APIKeysInterface
+	SessionsMock      service.SessionsInterface
 }
 
 // NewFruits returns FruitsMock
@@ -42,6 +46,26 @@ func (sf *ServiceFactoryMock) NewUsers() service.UsersInterface {
 	return sf.UsersMock
 }
 
+// NewAPIKeys returns APIKeysMock
+func (sf *ServiceFactoryMock) NewAPIKeys() service.APIKeysInterface {
+	return sf.APIKeysMock
+}
+
+// NewSessions returns SessionsMock
+func (sf *ServiceFactoryMock) NewSessions() service.SessionsInterface {
+	return sf.SessionsMock
+}
+
+// NewLogins returns LoginsMock
+func (sf *ServiceFactoryMock) NewLogins() service.LoginsInterface {
+	return sf.LoginsMock
+}
+
+// NewVerifications returns VerificationsMock
+func (sf *ServiceFactoryMock) NewVerifications() service.VerificationsInterface {
+	return sf.VerificationsMock
+}
+
 func createGinTestContext(mock *ServiceFactoryMock) (*gin.Context, *httptest.ResponseRecorder) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/factory"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+)
+
+// GetMyLogins はログイン履歴を取得します
+func GetMyLogins(c *gin.Context) {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	loginsService := factory.NewLogins()
+
+	user := c.MustGet("user").(*model.User)
+
+	list, err := loginsService.GetByUserID(user.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
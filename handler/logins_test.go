@@ -0,0 +1,86 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/itomofumi/go-gin-xorm-starter/handler"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// LoginsMock is a mock of logins.
+type LoginsMock struct {
+	service.LoginsInterface
+	FakeGetByUserID func(userID uint64) ([]*model.Login, error)
+}
+
+func (lm *LoginsMock) GetByUserID(userID uint64) ([]*model.Login, error) {
+	return lm.FakeGetByUserID(userID)
+}
+
+var testLogins = []*model.Login{
+	{ID: 2, UserID: 1, IP: "127.0.0.2", UserAgent: "curl"},
+	{ID: 1, UserID: 1, IP: "127.0.0.1", UserAgent: "httptest"},
+}
+
+func TestGetMyLogins(t *testing.T) {
+	defer Setup()()
+
+	type fakes struct {
+		getByUserID func(userID uint64) ([]*model.Login, error)
+	}
+	tests := []struct {
+		name       string
+		fakes      fakes
+		wantStatus int
+		want       interface{}
+	}{
+		{"success",
+			fakes{
+				getByUserID: func(userID uint64) ([]*model.Login, error) {
+					return testLogins, nil
+				},
+			},
+			http.StatusOK,
+			testLogins,
+		},
+		{"failure",
+			fakes{
+				getByUserID: func(userID uint64) ([]*model.Login, error) {
+					return nil, fmt.Errorf("db error")
+				},
+			},
+			http.StatusInternalServerError,
+			model.NewErrorResponse("500", model.ErrorUnknown, "db error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := &ServiceFactoryMock{
+				LoginsMock: &LoginsMock{FakeGetByUserID: tt.fakes.getByUserID},
+			}
+
+			c, w := createGinTestContext(factory)
+			c.Set("user", testUsers[0])
+			handler.GetMyLogins(c)
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			switch want := tt.want.(type) {
+			case []*model.Login:
+				var res []*model.Login
+				json.Unmarshal(w.Body.Bytes(), &res)
+				if assert.Len(t, res, len(want)) {
+					assert.Equal(t, want[0].IP, res[0].IP)
+					assert.Equal(t, want[0].UserAgent, res[0].UserAgent)
+				}
+			case *model.ErrorResponse:
+				testErrorResponse(t, want, w)
+			}
+		})
+	}
+}
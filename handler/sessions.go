@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/factory"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+)
+
+// GetMySessions はログイン中のセッション一覧を取得します
+func GetMySessions(c *gin.Context) {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	sessionsService := factory.NewSessions()
+
+	user := c.MustGet("user").(*model.User)
+
+	list, err := sessionsService.GetActiveByUserID(user.ID, c.GetString("session_id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// DeleteMySession はセッションをログアウトさせます
+func DeleteMySession(c *gin.Context) {
+	sessionID := c.MustGet("session-id").(uint64)
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	sessionsService := factory.NewSessions()
+
+	user := c.MustGet("user").(*model.User)
+
+	err := sessionsService.Revoke(user.ID, sessionID)
+	if err == service.ErrSessionNotFound {
+		c.AbortWithStatusJSON(http.StatusNotFound, model.NewErrorResponse("404", model.ErrorNotFound, err))
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, err))
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// DeleteMySessions は全てのセッションをログアウトさせます
+func DeleteMySessions(c *gin.Context) {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	sessionsService := factory.NewSessions()
+
+	user := c.MustGet("user").(*model.User)
+
+	if err := sessionsService.RevokeAll(user.ID); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, err))
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
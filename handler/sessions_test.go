@@ -0,0 +1,115 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/itomofumi/go-gin-xorm-starter/handler"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// SessionsMock is a mock of login sessions.
+type SessionsMock struct {
+	service.SessionsInterface
+	FakeGetActiveByUserID func(userID uint64, currentSessionID string) ([]*model.Session, error)
+	FakeRevoke            func(userID uint64, id uint64) error
+	FakeRevokeAll         func(userID uint64) error
+}
+
+func (sm *SessionsMock) GetActiveByUserID(userID uint64, currentSessionID string) ([]*model.Session, error) {
+	return sm.FakeGetActiveByUserID(userID, currentSessionID)
+}
+
+func (sm *SessionsMock) Revoke(userID uint64, id uint64) error {
+	return sm.FakeRevoke(userID, id)
+}
+
+func (sm *SessionsMock) RevokeAll(userID uint64) error {
+	return sm.FakeRevokeAll(userID)
+}
+
+func TestGetMySessions(t *testing.T) {
+	defer Setup()()
+
+	sessions := []*model.Session{
+		{Login: model.Login{ID: 2, IP: "127.0.0.2", UserAgent: "httptest"}, Current: true},
+		{Login: model.Login{ID: 1, IP: "127.0.0.1", UserAgent: "httptest"}},
+	}
+	factory := &ServiceFactoryMock{
+		SessionsMock: &SessionsMock{
+			FakeGetActiveByUserID: func(userID uint64, currentSessionID string) ([]*model.Session, error) {
+				assert.Equal(t, "origin_jti:bbb", currentSessionID)
+				return sessions, nil
+			},
+		},
+	}
+	c, w := createGinTestContext(factory)
+	c.Set("user", testUsers[0])
+	c.Set("session_id", "origin_jti:bbb")
+	handler.GetMySessions(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var res []*model.Session
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.Equal(t, sessions, res)
+}
+
+func TestDeleteMySession(t *testing.T) {
+	defer Setup()()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusNoContent},
+		{"not found", service.ErrSessionNotFound, http.StatusNotFound},
+		{"failure", fmt.Errorf("db error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := &ServiceFactoryMock{
+				SessionsMock: &SessionsMock{
+					FakeRevoke: func(userID uint64, id uint64) error { return tt.err },
+				},
+			}
+			c, w := createGinTestContext(factory)
+			c.Set("user", testUsers[0])
+			c.Set("session-id", uint64(1))
+
+			handler.DeleteMySession(c)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestDeleteMySessions(t *testing.T) {
+	defer Setup()()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusNoContent},
+		{"failure", fmt.Errorf("db error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := &ServiceFactoryMock{
+				SessionsMock: &SessionsMock{
+					FakeRevokeAll: func(userID uint64) error { return tt.err },
+				},
+			}
+			c, w := createGinTestContext(factory)
+			c.Set("user", testUsers[0])
+
+			handler.DeleteMySessions(c)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
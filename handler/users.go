@@ -8,16 +8,14 @@ import (
 	"github.com/gin-gonic/gin/binding"
 	"github.com/itomofumi/go-gin-xorm-starter/factory"
 	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
 )
 
 // GetMe はログイン情報を取得します
 func GetMe(c *gin.Context) {
-	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
-	usersService := factory.NewUsers()
-
-	email := c.MustGet("email").(string)
-
-	user, ok := usersService.GetByEmail(email)
+	// UserMiddlewareで取得済みのユーザー
+	user, ok := c.Get("user")
 	if !ok {
 		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, fmt.Errorf("user not found")))
 		return
@@ -38,11 +36,94 @@ func PostUser(c *gin.Context) {
 		return
 	}
 
+	verificationService := factory.NewVerifications()
+	locale := service.MatchLocale(c.GetHeader("Accept-Language"))
+
 	created, err := userService.Create(body.Email, &body.UserProfile)
+	if err == service.ErrVerificationPending {
+		// the owner of the email can verify the pending user, throttled like resending.
+		if err := verificationService.Send(body.Email, locale); err != nil {
+			util.GetLogger().Debugf("verification email is not sent to %v: %v", body.Email, err)
+		}
+		c.AbortWithStatusJSON(http.StatusConflict, model.NewErrorResponse("409", model.ErrorConflict,
+			"the email is waiting for verification. check the verification email"))
+		return
+	}
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, err))
 		return
 	}
 
+	// the user can request resending when this fails.
+	if err := verificationService.Send(body.Email, locale); err != nil {
+		util.GetLogger().Warnf("failed to send verification email to %v: %v", body.Email, err)
+	}
+
 	c.JSON(http.StatusCreated, created)
 }
+
+// GetVerifyUser はメール内のリンク (?token=) でユーザーを認証済みにします
+func GetVerifyUser(c *gin.Context) {
+	query := model.UserVerifyBody{}
+	err := c.ShouldBindWith(&query, binding.Query)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, "query mismatch", err))
+		return
+	}
+	verifyUser(c, query.Token)
+}
+
+// PostVerifyUser はメールアドレス確認トークンでユーザーを認証済みにします
+func PostVerifyUser(c *gin.Context) {
+	body := model.UserVerifyBody{}
+	err := c.ShouldBindWith(&body, binding.JSON)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, "request body mismatch", err))
+		return
+	}
+	verifyUser(c, body.Token)
+}
+
+func verifyUser(c *gin.Context, token string) {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	verificationService := factory.NewVerifications()
+
+	user, err := verificationService.Verify(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, user.GetPublicData())
+}
+
+// PostResendVerification は確認メールを再送します
+func PostResendVerification(c *gin.Context) {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	verificationService := factory.NewVerifications()
+
+	body := model.UserResendVerificationBody{}
+	err := c.ShouldBindWith(&body, binding.JSON)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, "request body mismatch", err))
+		return
+	}
+
+	locale := service.MatchLocale(c.GetHeader("Accept-Language"))
+	err = verificationService.Send(body.Email, locale)
+	switch err {
+	case nil:
+	case service.ErrVerificationThrottled:
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, model.NewErrorResponse("429", model.ErrorLimitExceeded, err))
+		return
+	case service.ErrVerificationUserNotFound, service.ErrAlreadyVerified:
+		// don't tell whether the email is registered.
+		util.GetLogger().Debugf("verification email is not sent to %v: %v", body.Email, err)
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, "failed to send verification email"))
+		util.GetLogger().Errorf("failed to send verification email to %v: %v", body.Email, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, nil)
+}
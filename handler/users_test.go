@@ -29,6 +29,21 @@ func (fm *UsersMock) Create(email string, profile *model.UserProfile) (*model.Us
 	return fm.FakeCreate(email, profile)
 }
 
+// VerificationsMock is a mock of verifications.
+type VerificationsMock struct {
+	service.VerificationsInterface
+	FakeSend   func(email string, locale string) error
+	FakeVerify func(token string) (*model.User, error)
+}
+
+func (vm *VerificationsMock) Send(email string, locale string) error {
+	return vm.FakeSend(email, locale)
+}
+
+func (vm *VerificationsMock) Verify(token string) (*model.User, error) {
+	return vm.FakeVerify(token)
+}
+
 var testUsers = []*model.User{
 	{
 		Common: model.Common{ID: 1},
@@ -49,41 +64,19 @@ var testUsers = []*model.User{
 func TestGetMe(t *testing.T) {
 	defer Setup()()
 
-	type fakes struct {
-		getByEmail func(email string) (*model.User, bool)
-	}
-	type args struct {
-		email string
-	}
 	tests := []struct {
 		name       string
-		fakes      fakes
-		args       args
+		user       *model.User
 		wantStatus int
 		want       interface{}
 	}{
 		{"success",
-			fakes{
-				getByEmail: func(email string) (*model.User, bool) {
-					for _, v := range testUsers {
-						if v.Email == email {
-							return v, true
-						}
-					}
-					return nil, false
-				},
-			},
-			args{email: "foo@example.com"},
+			testUsers[0],
 			http.StatusOK,
 			testUsers[0],
 		},
 		{"bad request",
-			fakes{
-				getByEmail: func(email string) (*model.User, bool) {
-					return nil, false
-				},
-			},
-			args{email: "xxx"},
+			nil,
 			http.StatusBadRequest,
 			model.NewErrorResponse("400", model.ErrorParam, fmt.Errorf("user not found")),
 		},
@@ -91,15 +84,10 @@ func TestGetMe(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			Users := &UsersMock{
-				FakeGetByEmail: tt.fakes.getByEmail,
+			c, w := createGinTestContext(&ServiceFactoryMock{})
+			if tt.user != nil {
+				c.Set("user", tt.user)
 			}
-			factory := &ServiceFactoryMock{
-				UsersMock: Users,
-			}
-
-			c, w := createGinTestContext(factory)
-			c.Set("email", tt.args.email)
 			handler.GetMe(c)
 			assert.Equal(t, tt.wantStatus, w.Code)
 
@@ -161,6 +149,21 @@ func TestPostUser(t *testing.T) {
 			http.StatusBadRequest,
 			model.NewErrorResponse("400", model.ErrorParam, "some error"),
 		},
+		{"verification pending",
+			fakes{
+				create: func(email string, profile *model.UserProfile) (*model.UserPublicData, error) {
+					return nil, service.ErrVerificationPending
+				},
+			},
+			args{
+				body: model.UserCreateBody{
+					Email:       "foo@example.com",
+					UserProfile: testUsers[0].UserProfile,
+				},
+			},
+			http.StatusConflict,
+			model.NewErrorResponse("409", model.ErrorConflict, "the email is waiting for verification. check the verification email"),
+		},
 		{"wrong email format",
 			fakes{
 				create: func(email string, profile *model.UserProfile) (*model.UserPublicData, error) {
@@ -184,6 +187,9 @@ func TestPostUser(t *testing.T) {
 			}
 			factory := &ServiceFactoryMock{
 				UsersMock: users,
+				VerificationsMock: &VerificationsMock{
+					FakeSend: func(email string, locale string) error { return nil },
+				},
 			}
 
 			c, w := createGinTestContext(factory)
@@ -205,3 +211,160 @@ func TestPostUser(t *testing.T) {
 		})
 	}
 }
+
+func TestPostVerifyUser(t *testing.T) {
+	defer Setup()()
+	type fakes struct {
+		verify func(token string) (*model.User, error)
+	}
+	type args struct {
+		body interface{}
+	}
+	tests := []struct {
+		name       string
+		fakes      fakes
+		args       args
+		wantStatus int
+		want       interface{}
+	}{
+		{"success",
+			fakes{
+				verify: func(token string) (*model.User, error) {
+					return testUsers[0], nil
+				},
+			},
+			args{body: model.UserVerifyBody{Token: "valid"}},
+			http.StatusOK,
+			testUsers[0].GetPublicData(),
+		},
+		{"invalid token",
+			fakes{
+				verify: func(token string) (*model.User, error) {
+					return nil, fmt.Errorf("verification token is not valid")
+				},
+			},
+			args{body: model.UserVerifyBody{Token: "invalid"}},
+			http.StatusBadRequest,
+			model.NewErrorResponse("400", model.ErrorParam, "verification token is not valid"),
+		},
+		{"no token",
+			fakes{},
+			args{body: struct{}{}},
+			http.StatusBadRequest,
+			model.NewErrorResponse("400", model.ErrorParam, "request body mismatch", "Key: 'UserVerifyBody.Token' Error:Field validation for 'Token' failed on the 'required' tag"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := &ServiceFactoryMock{
+				VerificationsMock: &VerificationsMock{
+					FakeVerify: tt.fakes.verify,
+				},
+			}
+
+			c, w := createGinTestContext(factory)
+			b, _ := json.Marshal(tt.args.body)
+			c.Request, _ = http.NewRequest("POST", "/users/verify", bytes.NewBuffer(b))
+
+			handler.PostVerifyUser(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			switch want := tt.want.(type) {
+			case *model.UserPublicData:
+				var res *model.UserPublicData
+				json.Unmarshal(w.Body.Bytes(), &res)
+				assert.Equal(t, want, res)
+			case *model.ErrorResponse:
+				testErrorResponse(t, want, w)
+			}
+		})
+	}
+}
+
+func TestPostResendVerification(t *testing.T) {
+	defer Setup()()
+	tests := []struct {
+		name       string
+		sendErr    error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusAccepted},
+		{"unknown email is not disclosed", service.ErrVerificationUserNotFound, http.StatusAccepted},
+		{"already verified is not disclosed", service.ErrAlreadyVerified, http.StatusAccepted},
+		{"throttled", service.ErrVerificationThrottled, http.StatusTooManyRequests},
+		{"mailer error", fmt.Errorf("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotLocale string
+			factory := &ServiceFactoryMock{
+				VerificationsMock: &VerificationsMock{
+					FakeSend: func(email string, locale string) error {
+						gotLocale = locale
+						return tt.sendErr
+					},
+				},
+			}
+
+			c, w := createGinTestContext(factory)
+			b, _ := json.Marshal(model.UserResendVerificationBody{Email: "foo@example.com"})
+			c.Request, _ = http.NewRequest("POST", "/users/verify/resend", bytes.NewBuffer(b))
+			c.Request.Header.Set("Accept-Language", "ja-JP,ja;q=0.9,en;q=0.8")
+
+			handler.PostResendVerification(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, "ja", gotLocale)
+		})
+	}
+}
+
+func TestGetVerifyUser(t *testing.T) {
+	defer Setup()()
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       interface{}
+	}{
+		{"success", "?token=valid", http.StatusOK, testUsers[0].GetPublicData()},
+		{"invalid token", "?token=invalid", http.StatusBadRequest,
+			model.NewErrorResponse("400", model.ErrorParam, "verification token is not valid")},
+		{"no token", "", http.StatusBadRequest,
+			model.NewErrorResponse("400", model.ErrorParam, "query mismatch", "Key: 'UserVerifyBody.Token' Error:Field validation for 'Token' failed on the 'required' tag")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := &ServiceFactoryMock{
+				VerificationsMock: &VerificationsMock{
+					FakeVerify: func(token string) (*model.User, error) {
+						if token != "valid" {
+							return nil, fmt.Errorf("verification token is not valid")
+						}
+						return testUsers[0], nil
+					},
+				},
+			}
+
+			c, w := createGinTestContext(factory)
+			c.Request, _ = http.NewRequest("GET", "/users/verify"+tt.query, nil)
+
+			handler.GetVerifyUser(c)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			switch want := tt.want.(type) {
+			case *model.UserPublicData:
+				var res *model.UserPublicData
+				json.Unmarshal(w.Body.Bytes(), &res)
+				assert.Equal(t, want, res)
+			case *model.ErrorResponse:
+				testErrorResponse(t, want, w)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package infra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	lumberjack "gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	errorReporterEnv   = "ERROR_REPORTER"
+	errorReportFileEnv = "ERROR_REPORT_FILE"
+)
+
+// ErrorReport is an unexpected error like a panic, with its context.
+type ErrorReport struct {
+	Time      time.Time `json:"time"`
+	Error     string    `json:"error"`
+	Stack     string    `json:"stack,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	UserID    uint64    `json:"user_id,omitempty"`
+}
+
+// ErrorReporter notifies errors to developers, e.g. an error tracking service.
+type ErrorReporter interface {
+	Report(report *ErrorReport) error
+}
+
+// NewErrorReporterEnv initializes an error reporter using Environment Variables.
+//
+// ERROR_REPORTER=none disables reports.
+// Otherwise reports are written into ERROR_REPORT_FILE for local development.
+func NewErrorReporterEnv() (ErrorReporter, error) {
+	switch strings.ToLower(os.Getenv(errorReporterEnv)) {
+	case "none":
+		return NopErrorReporter{}, nil
+	case "", "file":
+		filename := os.Getenv(errorReportFileEnv)
+		if filename == "" {
+			filename = path.Join(os.Getenv("LOG_DIR"), "server_errors.log")
+		}
+		return NewFileErrorReporter(&lumberjack.Logger{
+			Filename:   filename,
+			MaxSize:    10,  // megabytes
+			MaxBackups: 100, // default: not to remove old logs
+			Compress:   true,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown %v %q. use file or none", errorReporterEnv, os.Getenv(errorReporterEnv))
+}
+
+// FileErrorReporter writes reports as JSON lines.
+type FileErrorReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewFileErrorReporter initializes FileErrorReporter.
+func NewFileErrorReporter(w io.Writer) *FileErrorReporter {
+	return &FileErrorReporter{w: w}
+}
+
+// Report writes the report in a line.
+func (r *FileErrorReporter) Report(report *ErrorReport) error {
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.w.Write(append(b, '\n'))
+	return err
+}
+
+// NopErrorReporter discards reports.
+type NopErrorReporter struct{}
+
+// Report does nothing.
+func (NopErrorReporter) Report(report *ErrorReport) error {
+	return nil
+}
@@ -0,0 +1,47 @@
+package infra_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileErrorReporter_Report(t *testing.T) {
+	var b bytes.Buffer
+	reporter := infra.NewFileErrorReporter(&b)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, reporter.Report(&infra.ErrorReport{Time: now, Error: "first", RequestID: "req-1"}))
+	require.NoError(t, reporter.Report(&infra.ErrorReport{Time: now, Error: "second", Stack: "goroutine 1"}))
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"time":"2020-01-02T03:04:05Z","error":"first","request_id":"req-1"}`, lines[0])
+
+	var report infra.ErrorReport
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &report))
+	assert.Equal(t, "second", report.Error)
+	assert.Equal(t, "goroutine 1", report.Stack)
+}
+
+func TestNewErrorReporterEnv(t *testing.T) {
+	reporter, err := infra.NewErrorReporterEnv()
+	require.NoError(t, err)
+	assert.IsType(t, &infra.FileErrorReporter{}, reporter)
+
+	os.Setenv("ERROR_REPORTER", "none")
+	defer os.Unsetenv("ERROR_REPORTER")
+	reporter, err = infra.NewErrorReporterEnv()
+	require.NoError(t, err)
+	assert.IsType(t, infra.NopErrorReporter{}, reporter)
+
+	os.Setenv("ERROR_REPORTER", "sentry")
+	_, err = infra.NewErrorReporterEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package infra
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	mailerEnv        = "MAILER"
+	mailFromEnv      = "MAIL_FROM"
+	mailOutboxDirEnv = "MAIL_OUTBOX_DIR"
+	smtpHostEnv      = "SMTP_HOST"
+	smtpUserEnv      = "SMTP_USER"
+	smtpPasswordEnv  = "SMTP_PASSWORD"
+
+	defaultMailFrom      = "no-reply@localhost"
+	defaultMailOutboxDir = "outbox"
+)
+
+// Mail is a plain text email message.
+type Mail struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Bytes formats the mail as a MIME message.
+func (m *Mail) Bytes() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", util.GetTimeNow().Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("\r\n")
+
+	// wrap base64 body in 76 characters per line (RFC 2045).
+	encoded := base64.StdEncoding.EncodeToString([]byte(m.Body))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return b.Bytes()
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(mail *Mail) error
+}
+
+// NewMailerEnv initializes a mailer using Environment Variables.
+//
+// MAILER=smtp sends emails via SMTP_HOST.
+// Otherwise emails are written into MAIL_OUTBOX_DIR for local development.
+func NewMailerEnv() (Mailer, error) {
+	from := os.Getenv(mailFromEnv)
+	if from == "" {
+		from = defaultMailFrom
+	}
+
+	switch strings.ToLower(os.Getenv(mailerEnv)) {
+	case "smtp":
+		host := os.Getenv(smtpHostEnv)
+		if host == "" {
+			return nil, fmt.Errorf("%v is not set", smtpHostEnv)
+		}
+		return NewSMTPMailer(host, os.Getenv(smtpUserEnv), os.Getenv(smtpPasswordEnv), from), nil
+	case "", "outbox":
+		dir := os.Getenv(mailOutboxDirEnv)
+		if dir == "" {
+			dir = path.Join(os.Getenv("LOG_DIR"), defaultMailOutboxDir)
+		}
+		return NewOutboxMailer(dir, from), nil
+	}
+	return nil, fmt.Errorf("unknown %v %q. use smtp or outbox", mailerEnv, os.Getenv(mailerEnv))
+}
+
+// SMTPMailer sends emails via SMTP server.
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer initializes SMTPMailer.
+// addr must be "host:port". PLAIN auth is used when user is not empty.
+func NewSMTPMailer(addr, user, password, from string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: addr,
+		from: from,
+	}
+	if user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return m
+}
+
+// Send sends the mail.
+func (m *SMTPMailer) Send(mail *Mail) error {
+	if mail.From == "" {
+		mail.From = m.from
+	}
+	return smtp.SendMail(m.addr, m.auth, mail.From, mail.To, mail.Bytes())
+}
+
+// OutboxMailer writes emails into a directory instead of sending them.
+type OutboxMailer struct {
+	dir   string
+	from  string
+	count uint64
+}
+
+// NewOutboxMailer initializes OutboxMailer.
+func NewOutboxMailer(dir, from string) *OutboxMailer {
+	return &OutboxMailer{
+		dir:  dir,
+		from: from,
+	}
+}
+
+// Send writes the mail as an .eml file.
+func (m *OutboxMailer) Send(mail *Mail) error {
+	if mail.From == "" {
+		mail.From = m.from
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+	n := atomic.AddUint64(&m.count, 1)
+	filename := fmt.Sprintf("%s-%04d.eml", util.GetTimeNow().Format("20060102T150405.000000"), n)
+	filepath := path.Join(m.dir, filename)
+	if err := ioutil.WriteFile(filepath, mail.Bytes(), 0644); err != nil {
+		return err
+	}
+	util.GetLogger().Infof("mail to %v was written to %v", mail.To, filepath)
+	return nil
+}
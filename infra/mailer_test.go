@@ -0,0 +1,69 @@
+package infra_test
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxMailer_Send(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mailer := infra.NewOutboxMailer(dir, "no-reply@example.com")
+	err = mailer.Send(&infra.Mail{
+		To:      []string{"foo@example.com"},
+		Subject: "メールアドレスの確認",
+		Body:    "hello",
+	})
+	if err != nil {
+		t.Fatalf("OutboxMailer.Send() error = %v", err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("outbox has wrong number of files. got=%d, want=%d", len(files), 1)
+	}
+	b, _ := ioutil.ReadFile(path.Join(dir, files[0].Name()))
+	eml := string(b)
+
+	assert := assert.New(t)
+	assert.True(strings.HasSuffix(files[0].Name(), ".eml"))
+	assert.Contains(eml, "From: no-reply@example.com\r\n")
+	assert.Contains(eml, "To: foo@example.com\r\n")
+	assert.Contains(eml, "Subject: =?utf-8?q?")
+	assert.Contains(eml, base64.StdEncoding.EncodeToString([]byte("hello")))
+}
+
+func TestNewMailerEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"outbox by default", map[string]string{"MAILER": ""}, false},
+		{"smtp", map[string]string{"MAILER": "smtp", "SMTP_HOST": "localhost:25"}, false},
+		{"smtp without host", map[string]string{"MAILER": "smtp", "SMTP_HOST": ""}, true},
+		{"unknown", map[string]string{"MAILER": "pigeon"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+			}
+			_, err := infra.NewMailerEnv()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewMailerEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
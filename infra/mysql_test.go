@@ -7,7 +7,7 @@ import (
 
 	"github.com/itomofumi/go-gin-xorm-starter/infra"
 	"github.com/stretchr/testify/assert"
-	"xorm.io/core"
+	"xorm.io/xorm/log"
 )
 
 func setupEnv() {
@@ -65,17 +65,17 @@ func Test_parseLogLevel(t *testing.T) {
 
 	tests := []struct {
 		value   string
-		want    core.LogLevel
+		want    log.LogLevel
 		wantErr bool
 	}{
-		{"fatal", core.LOG_ERR, false},
-		{"error", core.LOG_ERR, false},
-		{"panic", core.LOG_ERR, false},
-		{"warning", core.LOG_WARNING, false},
-		{"warn", core.LOG_WARNING, false},
-		{"info", core.LOG_INFO, false},
-		{"debug", core.LOG_DEBUG, false},
-		{"other", core.LOG_DEBUG, true},
+		{"fatal", log.LOG_ERR, false},
+		{"error", log.LOG_ERR, false},
+		{"panic", log.LOG_ERR, false},
+		{"warning", log.LOG_WARNING, false},
+		{"warn", log.LOG_WARNING, false},
+		{"info", log.LOG_INFO, false},
+		{"debug", log.LOG_DEBUG, false},
+		{"other", log.LOG_DEBUG, true},
 	}
 
 	for _, tt := range tests {
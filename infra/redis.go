@@ -1,10 +1,12 @@
 package infra
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -14,20 +16,65 @@ import (
 const (
 	kvsExpireSecondEnv   string = "KVS_EXPIRE_SECOND"
 	defaultExpireSeconds uint   = 300
+
+	kvsTimeoutMillisEnv = "KVS_TIMEOUT_MILLIS"
+	kvsMaxActiveEnv     = "KVS_MAX_ACTIVE"
+	// defaultKVSTimeout bounds dialing, each command and waiting for a connection,
+	// so that requests don't hang on an unresponsive key-value store.
+	defaultKVSTimeout   = time.Second
+	defaultKVSMaxActive = 100
 )
 
+// ErrKVSNotFound is returned by GetStruct when the key does not exist.
+var ErrKVSNotFound = redis.ErrNil
+
 // KVSClientInterface is key-value store interface.
 type KVSClientInterface interface {
 	SetStruct(key string, structPtr interface{}) error
+	SetStructWithExpire(key string, structPtr interface{}, expire time.Duration) error
 	GetStruct(key string, structPtr interface{}) error
+	Delete(key string) error
+	Incr(key string) (int64, error)
+	EvalInts(script *KVSScript, keys []string, args ...interface{}) ([]int64, error)
+}
+
+// KVSScript is a Lua script run atomically in the key-value store.
+type KVSScript struct {
+	keyCount int
+	script   *redis.Script
+}
+
+// NewKVSScript initializes a Lua script which takes keyCount keys.
+func NewKVSScript(keyCount int, src string) *KVSScript {
+	return &KVSScript{
+		keyCount: keyCount,
+		script:   redis.NewScript(keyCount, src),
+	}
+}
+
+// KVSStats are counts of key-value store operations.
+type KVSStats struct {
+	// Hits and Misses are counts of GetStruct.
+	Hits   uint64
+	Misses uint64
+	// Errors are counts of any operations, including while not connected.
+	Errors uint64
 }
 
 // KVSClient is key-value store client.
 type KVSClient struct {
-	Conn          redis.Conn
+	// counters are first for 64-bit atomic operations on 32-bit platforms.
+	hits   uint64
+	misses uint64
+	errors uint64
+
+	// Pool hands out a connection to each operation, so the client is safe for concurrent use.
+	Pool          *redis.Pool
 	namespace     string
 	expireSeconds uint
-	done          chan struct{}
+	// timeout bounds dialing, reading and writing a command, and waiting for a free connection.
+	// Zero waits without limit.
+	timeout time.Duration
 }
 
 // NewKVSClient initializes key-value store client.
@@ -46,53 +93,134 @@ func NewKVSClient() *KVSClient {
 
 	}
 
-	// first try
-	c, err := connect()
-	if err == nil {
-		client.Conn = c
+	client.timeout = defaultKVSTimeout
+	if ms, err := strconv.Atoi(os.Getenv(kvsTimeoutMillisEnv)); err == nil && ms > 0 {
+		client.timeout = time.Duration(ms) * time.Millisecond
+	}
+	maxActive := defaultKVSMaxActive
+	if n, err := strconv.Atoi(os.Getenv(kvsMaxActiveEnv)); err == nil && n > 0 {
+		maxActive = n
+	}
+
+	client.Pool = &redis.Pool{
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return connect(ctx, client.timeout)
+		},
+		MaxIdle:     10,
+		IdleTimeout: 4 * time.Minute,
+		// operations wait for a free connection up to the timeout instead of opening connections without limit.
+		MaxActive: maxActive,
+		Wait:      true,
+		// a broken connection is found on borrow instead of failing the operation.
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
 	}
-	client.runConnect()
 	return client
 }
 
-// Close closes connection.
+// Stats returns counts of operations since the client was initialized.
+func (kc *KVSClient) Stats() KVSStats {
+	return KVSStats{
+		Hits:   atomic.LoadUint64(&kc.hits),
+		Misses: atomic.LoadUint64(&kc.misses),
+		Errors: atomic.LoadUint64(&kc.errors),
+	}
+}
+
+// countError counts the error of an operation, except not found.
+func (kc *KVSClient) countError(err error) error {
+	if err != nil && err != redis.ErrNil {
+		atomic.AddUint64(&kc.errors, 1)
+	}
+	return err
+}
+
+// Close closes the idle connections and the connections in use when they are returned.
+// It can be called more than once.
 func (kc *KVSClient) Close() {
-	if kc.Conn != nil {
-		close(kc.done)
+	if kc.Pool == nil {
+		return
 	}
+	kc.Pool.Close()
+}
+
+// conn gets a connection from the pool. The caller must close it.
+func (kc *KVSClient) conn() (redis.Conn, error) {
+	if kc.Pool == nil {
+		return nil, kc.countError(fmt.Errorf("not connected"))
+	}
+	ctx := context.Background()
+	if kc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, kc.timeout)
+		defer cancel()
+	}
+	c, err := kc.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, kc.countError(err)
+	}
+	return c, nil
 }
 
 // SetStruct store go struct object by key.
 func (kc *KVSClient) SetStruct(key string, structPtr interface{}) error {
-	if !kc.isConnected() {
-		return fmt.Errorf("not connected")
+	return kc.setStruct(key, structPtr, kc.expireSeconds)
+}
+
+// SetStructWithExpire stores go struct object by key with its own lifetime
+// instead of KVS_EXPIRE_SECOND.
+func (kc *KVSClient) SetStructWithExpire(key string, structPtr interface{}, expire time.Duration) error {
+	sec := uint(expire / time.Second)
+	if sec == 0 {
+		return fmt.Errorf("expire must be at least 1 second")
 	}
+	return kc.setStruct(key, structPtr, sec)
+}
+
+func (kc *KVSClient) setStruct(key string, structPtr interface{}, expireSeconds uint) error {
 	b, err := json.Marshal(structPtr)
 	if err != nil {
 		return err
 	}
-	kc.Conn.Send("MULTI")
-	kc.Conn.Send("SET", kc.namespace+key, string(b))
-	kc.Conn.Send("EXPIRE", kc.namespace+key, kc.expireSeconds)
-	_, err = kc.Conn.Do("EXEC")
+	conn, err := kc.conn()
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
+	defer conn.Close()
+	conn.Send("MULTI")
+	conn.Send("SET", kc.namespace+key, string(b))
+	conn.Send("EXPIRE", kc.namespace+key, expireSeconds)
+	_, err = conn.Do("EXEC")
+	if err != nil {
+		fmt.Println(err)
+		return kc.countError(err)
+	}
 	return nil
 }
 
 // GetStruct load go struct object by key.
+// It returns ErrKVSNotFound if the key does not exist.
 func (kc *KVSClient) GetStruct(key string, structPtr interface{}) error {
-	if !kc.isConnected() {
-		return fmt.Errorf("not connected")
+	conn, err := kc.conn()
+	if err != nil {
+		return err
 	}
+	defer conn.Close()
 
-	str, err := redis.String(kc.Conn.Do("GET", kc.namespace+key))
+	str, err := redis.String(conn.Do("GET", kc.namespace+key))
+	if err == redis.ErrNil {
+		atomic.AddUint64(&kc.misses, 1)
+	}
 	if err != nil {
 		fmt.Println(err)
-		return err
+		return kc.countError(err)
 	}
+	atomic.AddUint64(&kc.hits, 1)
 	err = json.Unmarshal([]byte(str), structPtr)
 	if err != nil {
 		return err
@@ -101,45 +229,87 @@ func (kc *KVSClient) GetStruct(key string, structPtr interface{}) error {
 	return nil
 }
 
-func (kc *KVSClient) isConnected() bool {
-	return kc.Conn != nil
+// Delete removes the key.
+func (kc *KVSClient) Delete(key string) error {
+	conn, err := kc.conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("DEL", kc.namespace+key)
+	return kc.countError(err)
 }
 
-func (kc *KVSClient) runConnect() {
-	if kc.done != nil {
-		return
+// Incr increments the integer value of key and returns the new value.
+// The key never expires unlike SetStruct.
+func (kc *KVSClient) Incr(key string) (int64, error) {
+	conn, err := kc.conn()
+	if err != nil {
+		return 0, err
 	}
+	defer conn.Close()
 
-	go func() {
-		for {
-			select {
-			case <-kc.done:
-				if kc.Conn != nil {
-					kc.Conn.Close()
-					kc.Conn = nil
-				}
-				return
-			default:
-				if !kc.isConnected() {
-					c, err := connect()
-					if err == nil {
-						kc.Conn = c
-					} else {
-						fmt.Println(err)
-					}
-				}
-				time.Sleep(time.Second * 5)
-			}
-		}
-	}()
+	n, err := redis.Int64(conn.Do("INCR", kc.namespace+key))
+	return n, kc.countError(err)
+}
+
+// EvalInts runs the Lua script which returns an array of integers.
+// The script is sent by EVALSHA, and by EVAL only if it is not cached yet.
+func (kc *KVSClient) EvalInts(script *KVSScript, keys []string, args ...interface{}) ([]int64, error) {
+	if len(keys) != script.keyCount {
+		return nil, fmt.Errorf("script expects %v keys, but %v keys were given", script.keyCount, len(keys))
+	}
+	conn, err := kc.conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	keysAndArgs := make([]interface{}, 0, len(keys)+len(args))
+	for _, key := range keys {
+		keysAndArgs = append(keysAndArgs, kc.namespace+key)
+	}
+	keysAndArgs = append(keysAndArgs, args...)
+	values, err := redis.Int64s(script.script.Do(conn, keysAndArgs...))
+	return values, kc.countError(err)
+}
+
+// Ping sends PING to the key-value store within the deadline of ctx.
+// A connection which fails is closed instead of returned to the pool, and the next operation dials again.
+func (kc *KVSClient) Ping(ctx context.Context) error {
+	if kc.Pool == nil {
+		return fmt.Errorf("not connected")
+	}
+	conn, err := kc.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		_, err = conn.Do("PING")
+		return err
+	}
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return context.DeadlineExceeded
+	}
+	_, err = redis.DoWithTimeout(conn, timeout, "PING")
+	return err
 }
 
-func connect() (redis.Conn, error) {
+func connect(ctx context.Context, timeout time.Duration) (redis.Conn, error) {
 	host := os.Getenv("KVS_HOST")
 	if host == "" {
 		return nil, fmt.Errorf("KVS_HOST is not set")
 	}
-	c, err := redis.Dial("tcp", host)
+	c, err := redis.DialContext(ctx, "tcp", host,
+		redis.DialConnectTimeout(timeout),
+		redis.DialReadTimeout(timeout),
+		redis.DialWriteTimeout(timeout),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -1,13 +1,26 @@
 package infra
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/rafaeljusto/redigomock"
 )
 
+// mockPool returns a pool which hands out the mock connection, or nil if conn is nil.
+func mockPool(conn redis.Conn) *redis.Pool {
+	if conn == nil {
+		return nil
+	}
+	return &redis.Pool{MaxIdle: 1, Dial: func() (redis.Conn, error) { return conn, nil }}
+}
+
 func TestKVSClient_GetStruct(t *testing.T) {
 	type testObj struct {
 		Name string
@@ -52,7 +65,7 @@ func TestKVSClient_GetStruct(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			kc := &KVSClient{
-				Conn: tt.fields.Conn,
+				Pool: mockPool(tt.fields.Conn),
 			}
 			obj := testObj{}
 			if err := kc.GetStruct(tt.args.key, &obj); (err != nil) != tt.wantErr {
@@ -116,7 +129,7 @@ func TestKVSClient_SetStruct(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 
 			kc := &KVSClient{
-				Conn: tt.fields.Conn,
+				Pool: mockPool(tt.fields.Conn),
 			}
 
 			if err := kc.SetStruct(tt.args.key, tt.args.value); (err != nil) != tt.wantErr {
@@ -125,3 +138,313 @@ func TestKVSClient_SetStruct(t *testing.T) {
 		})
 	}
 }
+
+func TestKVSClient_Delete(t *testing.T) {
+	tests := []struct {
+		name    string
+		conn    redis.Conn
+		wantErr bool
+	}{
+		{"[success] delete",
+			func() redis.Conn {
+				c := redigomock.NewConn()
+				c.Command("DEL", "key1").Expect(int64(1))
+				return c
+			}(),
+			false,
+		},
+		{"[fail] delete, not connected", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &KVSClient{
+				Pool: mockPool(tt.conn),
+			}
+			if err := kc.Delete("key1"); (err != nil) != tt.wantErr {
+				t.Fatalf("KVSClient.Delete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKVSClient_Incr(t *testing.T) {
+	tests := []struct {
+		name    string
+		conn    redis.Conn
+		want    int64
+		wantErr bool
+	}{
+		{"[success] incr",
+			func() redis.Conn {
+				c := redigomock.NewConn()
+				c.Command("INCR", "key1").Expect(int64(3))
+				return c
+			}(),
+			3,
+			false,
+		},
+		{"[fail] incr",
+			func() redis.Conn {
+				c := redigomock.NewConn()
+				c.Command("INCR", "key1").ExpectError(fmt.Errorf("value is not an integer"))
+				return c
+			}(),
+			0,
+			true,
+		},
+		{"[fail] incr, not connected", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &KVSClient{
+				Pool: mockPool(tt.conn),
+			}
+			got, err := kc.Incr("key1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("KVSClient.Incr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("KVSClient.Incr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKVSClient_SetStructWithExpire(t *testing.T) {
+	tests := []struct {
+		name    string
+		conn    redis.Conn
+		expire  time.Duration
+		wantErr bool
+	}{
+		{"[success] set with expire",
+			func() redis.Conn {
+				c := redigomock.NewConn()
+				c.Command("MULTI").Expect("ok")
+				c.Command("SET", "key1", `{"Name":"value1"}`).Expect("ok")
+				c.Command("EXPIRE", "key1", uint(3600)).Expect("ok")
+				c.Command("EXEC").Expect("ok")
+				return c
+			}(),
+			time.Hour,
+			false,
+		},
+		{"[fail] expire less than 1 second", redigomock.NewConn(), time.Millisecond, true},
+		{"[fail] set, not connected", nil, time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &KVSClient{
+				Pool: mockPool(tt.conn),
+			}
+			obj := struct{ Name string }{"value1"}
+			if err := kc.SetStructWithExpire("key1", &obj, tt.expire); (err != nil) != tt.wantErr {
+				t.Fatalf("KVSClient.SetStructWithExpire() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKVSClient_EvalInts(t *testing.T) {
+	script := NewKVSScript(1, "return {1, 2}")
+	tests := []struct {
+		name    string
+		conn    redis.Conn
+		keys    []string
+		want    []int64
+		wantErr bool
+	}{
+		{"[success] evalsha",
+			func() redis.Conn {
+				c := redigomock.NewConn()
+				c.GenericCommand("EVALSHA").Expect([]interface{}{int64(1), int64(2)})
+				return c
+			}(),
+			[]string{"key1"},
+			[]int64{1, 2},
+			false,
+		},
+		{"[success] eval if not cached",
+			func() redis.Conn {
+				c := redigomock.NewConn()
+				c.GenericCommand("EVALSHA").ExpectError(redis.Error("NOSCRIPT No matching script."))
+				c.GenericCommand("EVAL").Expect([]interface{}{int64(1), int64(2)})
+				return c
+			}(),
+			[]string{"key1"},
+			[]int64{1, 2},
+			false,
+		},
+		{"[fail] wrong number of keys", redigomock.NewConn(), []string{"key1", "key2"}, nil, true},
+		{"[fail] eval, not connected", nil, []string{"key1"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &KVSClient{
+				Pool: mockPool(tt.conn),
+			}
+			got, err := kc.EvalInts(script, tt.keys, 10)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("KVSClient.EvalInts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("KVSClient.EvalInts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKVSClient_Stats(t *testing.T) {
+	type testObj struct {
+		Name string
+	}
+
+	c := redigomock.NewConn()
+	c.Command("GET", "hit").Expect(`{"Name":"ok"}`)
+	c.Command("GET", "miss").Expect(nil)
+	c.Command("GET", "error").ExpectError(fmt.Errorf("connection reset"))
+	c.Command("DEL", "error").ExpectError(fmt.Errorf("connection reset"))
+	kc := &KVSClient{Pool: mockPool(c)}
+
+	obj := testObj{}
+	_ = kc.GetStruct("hit", &obj)
+	_ = kc.GetStruct("hit", &obj)
+	if err := kc.GetStruct("miss", &obj); err != ErrKVSNotFound {
+		t.Fatalf("KVSClient.GetStruct() error = %v, want ErrKVSNotFound", err)
+	}
+	_ = kc.GetStruct("error", &obj)
+	_ = kc.Delete("error")
+
+	want := KVSStats{Hits: 2, Misses: 1, Errors: 2}
+	if got := kc.Stats(); got != want {
+		t.Errorf("KVSClient.Stats() = %+v, want %+v", got, want)
+	}
+
+	disconnected := &KVSClient{}
+	_ = disconnected.GetStruct("hit", &obj)
+	if got := disconnected.Stats(); got != (KVSStats{Errors: 1}) {
+		t.Errorf("KVSClient.Stats() = %+v, want 1 error", got)
+	}
+}
+
+func TestKVSClient_Close(t *testing.T) {
+	c := redigomock.NewConn()
+	c.Command("INCR", "key1").Expect(int64(1))
+	kc := &KVSClient{Pool: mockPool(c)}
+	if _, err := kc.Incr("key1"); err != nil {
+		t.Fatalf("KVSClient.Incr() error = %v", err)
+	}
+	if n := kc.Pool.IdleCount(); n != 1 {
+		t.Errorf("KVSClient.Incr() returned %v connections to the pool, want 1", n)
+	}
+	kc.Close()
+	if err := kc.Ping(context.Background()); err == nil {
+		t.Errorf("KVSClient.Close() did not close the connection")
+	}
+	// closing twice and closing a client never connected do nothing.
+	kc.Close()
+	(&KVSClient{}).Close()
+}
+
+func TestKVSClient_Ping(t *testing.T) {
+	c := redigomock.NewConn()
+	c.Command("PING").Expect("PONG")
+	kc := &KVSClient{Pool: mockPool(c)}
+	if err := kc.Ping(context.Background()); err != nil {
+		t.Errorf("KVSClient.Ping() error = %v", err)
+	}
+
+	if err := (&KVSClient{}).Ping(context.Background()); err == nil {
+		t.Errorf("KVSClient.Ping() of a client never connected returned no error")
+	}
+}
+
+// silentListener starts a server which accepts connections but never replies.
+func silentListener(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	return l
+}
+
+func TestKVSClient_Ping_Timeout(t *testing.T) {
+	l := silentListener(t)
+	defer l.Close()
+
+	os.Setenv("KVS_HOST", l.Addr().String())
+	defer os.Unsetenv("KVS_HOST")
+	kc := NewKVSClient()
+	defer kc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := kc.Ping(ctx); err == nil {
+		t.Fatalf("KVSClient.Ping() returned no error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("KVSClient.Ping() took %v, want it within the deadline", elapsed)
+	}
+	if n := kc.Pool.ActiveCount(); n != 0 {
+		t.Errorf("KVSClient.Ping() kept %v broken connections, want 0", n)
+	}
+}
+
+func TestKVSClient_Timeout(t *testing.T) {
+	l := silentListener(t)
+	defer l.Close()
+
+	os.Setenv("KVS_HOST", l.Addr().String())
+	defer os.Unsetenv("KVS_HOST")
+	os.Setenv("KVS_TIMEOUT_MILLIS", "50")
+	defer os.Unsetenv("KVS_TIMEOUT_MILLIS")
+	os.Setenv("KVS_MAX_ACTIVE", "1")
+	defer os.Unsetenv("KVS_MAX_ACTIVE")
+	kc := NewKVSClient()
+	defer kc.Close()
+
+	operations := map[string]func() error{
+		"GetStruct": func() error {
+			var v string
+			return kc.GetStruct("key", &v)
+		},
+		"SetStruct": func() error { return kc.SetStruct("key", "value") },
+		"Incr": func() error {
+			_, err := kc.Incr("key")
+			return err
+		},
+	}
+	for name, op := range operations {
+		start := time.Now()
+		if err := op(); err == nil {
+			t.Errorf("KVSClient.%v() returned no error", name)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("KVSClient.%v() took %v, want it within the timeout", name, elapsed)
+		}
+	}
+
+	// an operation waits for a free connection up to the timeout.
+	held, err := kc.conn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+	start := time.Now()
+	if err := kc.Delete("key"); err == nil {
+		t.Errorf("KVSClient.Delete() returned no error while the pool is exhausted")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("KVSClient.Delete() took %v, want it within the timeout", elapsed)
+	}
+}
@@ -0,0 +1,83 @@
+package infra
+
+import (
+	"context"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedKVSClient traces operations as child spans of the context returned by ctx.
+type tracedKVSClient struct {
+	next KVSClientInterface
+	ctx  func() context.Context
+}
+
+// TraceKVS returns the client which traces operations as Redis spans.
+func TraceKVS(kvsClient KVSClientInterface, ctx func() context.Context) KVSClientInterface {
+	if t, ok := kvsClient.(*tracedKVSClient); ok {
+		kvsClient = t.next
+	}
+	return &tracedKVSClient{kvsClient, ctx}
+}
+
+func (t *tracedKVSClient) start(operation string, keys ...string) trace.Span {
+	_, span := util.Tracer().Start(t.ctx(), "Redis "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", operation),
+			attribute.StringSlice("db.redis.keys", keys),
+		))
+	return span
+}
+
+func (t *tracedKVSClient) SetStruct(key string, structPtr interface{}) error {
+	span := t.start("SET", key)
+	err := t.next.SetStruct(key, structPtr)
+	util.EndSpan(span, err)
+	return err
+}
+
+func (t *tracedKVSClient) SetStructWithExpire(key string, structPtr interface{}, expire time.Duration) error {
+	span := t.start("SET", key)
+	err := t.next.SetStructWithExpire(key, structPtr, expire)
+	util.EndSpan(span, err)
+	return err
+}
+
+func (t *tracedKVSClient) GetStruct(key string, structPtr interface{}) error {
+	span := t.start("GET", key)
+	err := t.next.GetStruct(key, structPtr)
+	span.SetAttributes(attribute.Bool("db.redis.hit", err == nil))
+	if err == ErrKVSNotFound {
+		// a miss is not an error.
+		util.EndSpan(span, nil)
+		return err
+	}
+	util.EndSpan(span, err)
+	return err
+}
+
+func (t *tracedKVSClient) Delete(key string) error {
+	span := t.start("DEL", key)
+	err := t.next.Delete(key)
+	util.EndSpan(span, err)
+	return err
+}
+
+func (t *tracedKVSClient) Incr(key string) (int64, error) {
+	span := t.start("INCR", key)
+	n, err := t.next.Incr(key)
+	util.EndSpan(span, err)
+	return n, err
+}
+
+func (t *tracedKVSClient) EvalInts(script *KVSScript, keys []string, args ...interface{}) ([]int64, error) {
+	span := t.start("EVALSHA", keys...)
+	values, err := t.next.EvalInts(script, keys, args...)
+	util.EndSpan(span, err)
+	return values, err
+}
@@ -0,0 +1,113 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rafaeljusto/redigomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"xorm.io/xorm/contexts"
+)
+
+func setupSpanRecorder() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+type rowsAffected int64
+
+func (r rowsAffected) LastInsertId() (int64, error) { return 0, nil }
+func (r rowsAffected) RowsAffected() (int64, error) { return int64(r), nil }
+
+func TestTracingHook(t *testing.T) {
+	recorder := setupSpanRecorder()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+
+	hook := &TracingHook{DBName: "fruits"}
+	c := contexts.NewContextHook(ctx, "UPDATE fruits SET name = ? WHERE id = ?", []interface{}{"apple", 1})
+	spanCtx, err := hook.BeforeProcess(c)
+	require.NoError(t, err)
+	c.End(spanCtx, rowsAffected(1), nil)
+	require.NoError(t, hook.AfterProcess(c))
+
+	c = contexts.NewContextHook(ctx, "SELECT * FROM fruits", nil)
+	spanCtx, _ = hook.BeforeProcess(c)
+	c.End(spanCtx, nil, errors.New("bad connection"))
+	require.NoError(t, hook.AfterProcess(c))
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	update, query := spans[0], spans[1]
+	assert.Equal(t, "SQL", update.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), update.Parent().SpanID())
+	attrs := spanAttributes(update)
+	assert.Equal(t, "mysql", attrs["db.system"].AsString())
+	assert.Equal(t, "fruits", attrs["db.name"].AsString())
+	assert.Equal(t, "UPDATE fruits SET name = ? WHERE id = ?", attrs["db.statement"].AsString())
+	assert.Equal(t, int64(1), attrs["db.rows_affected"].AsInt64())
+	assert.Equal(t, codes.Unset, update.Status().Code)
+
+	assert.Equal(t, codes.Error, query.Status().Code)
+	assert.NotContains(t, spanAttributes(query), attribute.Key("db.rows_affected"))
+}
+
+func TestTraceKVS(t *testing.T) {
+	recorder := setupSpanRecorder()
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+
+	conn := redigomock.NewConn()
+	conn.Command("GET", "hit").Expect(`{"Name":"ok"}`)
+	conn.Command("GET", "miss").Expect(nil)
+	conn.Command("DEL", "key").ExpectError(errors.New("connection reset"))
+	kvs := TraceKVS(&KVSClient{Pool: mockPool(conn)}, func() context.Context { return ctx })
+	// not wrapped twice.
+	kvs = TraceKVS(kvs, func() context.Context { return ctx })
+
+	var obj struct{ Name string }
+	assert.NoError(t, kvs.GetStruct("hit", &obj))
+	assert.Equal(t, ErrKVSNotFound, kvs.GetStruct("miss", &obj))
+	assert.Error(t, kvs.Delete("key"))
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	tests := []struct {
+		name      string
+		operation string
+		hit       bool
+		status    codes.Code
+	}{
+		{"Redis GET", "GET", true, codes.Unset},
+		{"Redis GET", "GET", false, codes.Unset},
+		{"Redis DEL", "DEL", false, codes.Error},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		assert.Equal(t, tt.name, span.Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		attrs := spanAttributes(span)
+		assert.Equal(t, "redis", attrs["db.system"].AsString())
+		assert.Equal(t, tt.operation, attrs["db.operation"].AsString())
+		if tt.operation == "GET" {
+			assert.Equal(t, tt.hit, attrs["db.redis.hit"].AsBool())
+		}
+		assert.Equal(t, tt.status, span.Status().Code)
+	}
+}
@@ -0,0 +1,237 @@
+package infra
+
+import (
+	"context"
+	"database/sql"
+
+	"xorm.io/xorm"
+)
+
+// contextEngine runs every query of the engine with the context,
+// e.g. to log SQL with the request ID and trace SQL as a child span.
+type contextEngine struct {
+	EngineInterface
+	ctx func() context.Context
+}
+
+// WithContext returns the engine which runs queries with ctx.
+func WithContext(engine EngineInterface, ctx context.Context) EngineInterface {
+	return WithContextFunc(engine, func() context.Context { return ctx })
+}
+
+// WithContextFunc returns the engine which runs queries with the context returned by ctx at the time.
+func WithContextFunc(engine EngineInterface, ctx func() context.Context) EngineInterface {
+	if e, ok := engine.(*contextEngine); ok {
+		engine = e.EngineInterface
+	}
+	return &contextEngine{engine, ctx}
+}
+
+// NewSession returns a session with the context.
+func (e *contextEngine) NewSession() *xorm.Session {
+	return e.EngineInterface.NewSession().Context(e.ctx())
+}
+
+func (e *contextEngine) AllCols() *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).AllCols()
+}
+
+func (e *contextEngine) Alias(alias string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Alias(alias)
+}
+
+func (e *contextEngine) Asc(colNames ...string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Asc(colNames...)
+}
+
+func (e *contextEngine) BufferSize(size int) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).BufferSize(size)
+}
+
+func (e *contextEngine) Cols(columns ...string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Cols(columns...)
+}
+
+func (e *contextEngine) Count(arg0 ...interface{}) (int64, error) {
+	return e.EngineInterface.Context(e.ctx()).Count(arg0...)
+}
+
+func (e *contextEngine) CreateIndexes(bean interface{}) error {
+	return e.EngineInterface.Context(e.ctx()).CreateIndexes(bean)
+}
+
+func (e *contextEngine) CreateUniques(bean interface{}) error {
+	return e.EngineInterface.Context(e.ctx()).CreateUniques(bean)
+}
+
+func (e *contextEngine) Decr(column string, arg ...interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Decr(column, arg...)
+}
+
+func (e *contextEngine) Desc(arg0 ...string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Desc(arg0...)
+}
+
+func (e *contextEngine) Delete(arg0 interface{}) (int64, error) {
+	return e.EngineInterface.Context(e.ctx()).Delete(arg0)
+}
+
+func (e *contextEngine) Distinct(columns ...string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Distinct(columns...)
+}
+
+func (e *contextEngine) DropIndexes(bean interface{}) error {
+	return e.EngineInterface.Context(e.ctx()).DropIndexes(bean)
+}
+
+func (e *contextEngine) Exec(sqlOrArgs ...interface{}) (sql.Result, error) {
+	return e.EngineInterface.Context(e.ctx()).Exec(sqlOrArgs...)
+}
+
+func (e *contextEngine) Exist(bean ...interface{}) (bool, error) {
+	return e.EngineInterface.Context(e.ctx()).Exist(bean...)
+}
+
+func (e *contextEngine) Find(arg0 interface{}, arg1 ...interface{}) error {
+	return e.EngineInterface.Context(e.ctx()).Find(arg0, arg1...)
+}
+
+func (e *contextEngine) FindAndCount(arg0 interface{}, arg1 ...interface{}) (int64, error) {
+	return e.EngineInterface.Context(e.ctx()).FindAndCount(arg0, arg1...)
+}
+
+func (e *contextEngine) Get(arg0 interface{}) (bool, error) {
+	return e.EngineInterface.Context(e.ctx()).Get(arg0)
+}
+
+func (e *contextEngine) GroupBy(keys string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).GroupBy(keys)
+}
+
+func (e *contextEngine) ID(arg0 interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).ID(arg0)
+}
+
+func (e *contextEngine) In(arg0 string, arg1 ...interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).In(arg0, arg1...)
+}
+
+func (e *contextEngine) Incr(column string, arg ...interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Incr(column, arg...)
+}
+
+func (e *contextEngine) Insert(arg0 ...interface{}) (int64, error) {
+	return e.EngineInterface.Context(e.ctx()).Insert(arg0...)
+}
+
+func (e *contextEngine) InsertOne(arg0 interface{}) (int64, error) {
+	return e.EngineInterface.Context(e.ctx()).InsertOne(arg0)
+}
+
+func (e *contextEngine) IsTableEmpty(bean interface{}) (bool, error) {
+	return e.EngineInterface.Context(e.ctx()).IsTableEmpty(bean)
+}
+
+func (e *contextEngine) IsTableExist(beanOrTableName interface{}) (bool, error) {
+	return e.EngineInterface.Context(e.ctx()).IsTableExist(beanOrTableName)
+}
+
+func (e *contextEngine) Iterate(arg0 interface{}, arg1 xorm.IterFunc) error {
+	return e.EngineInterface.Context(e.ctx()).Iterate(arg0, arg1)
+}
+
+func (e *contextEngine) Limit(arg0 int, arg1 ...int) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Limit(arg0, arg1...)
+}
+
+func (e *contextEngine) MustCols(columns ...string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).MustCols(columns...)
+}
+
+func (e *contextEngine) NoAutoCondition(arg0 ...bool) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).NoAutoCondition(arg0...)
+}
+
+func (e *contextEngine) NotIn(arg0 string, arg1 ...interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).NotIn(arg0, arg1...)
+}
+
+func (e *contextEngine) Join(joinOperator string, tablename interface{}, condition string, args ...interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Join(joinOperator, tablename, condition, args...)
+}
+
+func (e *contextEngine) Omit(columns ...string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Omit(columns...)
+}
+
+func (e *contextEngine) OrderBy(order string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).OrderBy(order)
+}
+
+func (e *contextEngine) Ping() error {
+	return e.EngineInterface.Context(e.ctx()).Ping()
+}
+
+func (e *contextEngine) Query(sqlOrArgs ...interface{}) (resultsSlice []map[string][]byte, err error) {
+	return e.EngineInterface.Context(e.ctx()).Query(sqlOrArgs...)
+}
+
+func (e *contextEngine) QueryInterface(sqlOrArgs ...interface{}) ([]map[string]interface{}, error) {
+	return e.EngineInterface.Context(e.ctx()).QueryInterface(sqlOrArgs...)
+}
+
+func (e *contextEngine) QueryString(sqlOrArgs ...interface{}) ([]map[string]string, error) {
+	return e.EngineInterface.Context(e.ctx()).QueryString(sqlOrArgs...)
+}
+
+func (e *contextEngine) Rows(bean interface{}) (*xorm.Rows, error) {
+	return e.EngineInterface.Context(e.ctx()).Rows(bean)
+}
+
+func (e *contextEngine) SetExpr(arg0 string, arg1 interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).SetExpr(arg0, arg1)
+}
+
+func (e *contextEngine) Select(arg0 string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Select(arg0)
+}
+
+func (e *contextEngine) SQL(arg0 interface{}, arg1 ...interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).SQL(arg0, arg1...)
+}
+
+func (e *contextEngine) Sum(bean interface{}, colName string) (float64, error) {
+	return e.EngineInterface.Context(e.ctx()).Sum(bean, colName)
+}
+
+func (e *contextEngine) SumInt(bean interface{}, colName string) (int64, error) {
+	return e.EngineInterface.Context(e.ctx()).SumInt(bean, colName)
+}
+
+func (e *contextEngine) Sums(bean interface{}, colNames ...string) ([]float64, error) {
+	return e.EngineInterface.Context(e.ctx()).Sums(bean, colNames...)
+}
+
+func (e *contextEngine) SumsInt(bean interface{}, colNames ...string) ([]int64, error) {
+	return e.EngineInterface.Context(e.ctx()).SumsInt(bean, colNames...)
+}
+
+func (e *contextEngine) Table(tableNameOrBean interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Table(tableNameOrBean)
+}
+
+func (e *contextEngine) Unscoped() *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Unscoped()
+}
+
+func (e *contextEngine) Update(bean interface{}, condiBeans ...interface{}) (int64, error) {
+	return e.EngineInterface.Context(e.ctx()).Update(bean, condiBeans...)
+}
+
+func (e *contextEngine) UseBool(arg0 ...string) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).UseBool(arg0...)
+}
+
+func (e *contextEngine) Where(arg0 interface{}, arg1 ...interface{}) *xorm.Session {
+	return e.EngineInterface.Context(e.ctx()).Where(arg0, arg1...)
+}
@@ -0,0 +1,87 @@
+package infra
+
+import (
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"github.com/sirupsen/logrus"
+	"xorm.io/xorm/log"
+)
+
+// SQLLogger writes xorm logs to logrus with the request ID of the query context.
+type SQLLogger struct {
+	logger  *logrus.Logger
+	level   log.LogLevel
+	showSQL bool
+}
+
+// NewSQLLogger initializes a logger with the level and ShowSQL of base, the current logger of the engine.
+func NewSQLLogger(logger *logrus.Logger, base log.ContextLogger) *SQLLogger {
+	return &SQLLogger{logger: logger, level: base.Level(), showSQL: base.IsShowSQL()}
+}
+
+// BeforeSQL implements log.ContextLogger.
+func (l *SQLLogger) BeforeSQL(ctx log.LogContext) {}
+
+// AfterSQL logs the executed SQL.
+func (l *SQLLogger) AfterSQL(ctx log.LogContext) {
+	entry := l.logger.WithFields(logrus.Fields{
+		"sql":     ctx.SQL,
+		"args":    ctx.Args,
+		"latency": ctx.ExecuteTime,
+	})
+	if id := util.GetRequestID(ctx.Ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	if ctx.Err != nil {
+		entry.Error("[SQL] ", ctx.Err)
+	} else {
+		entry.Info("[SQL]")
+	}
+}
+
+// Debugf implements log.ContextLogger.
+func (l *SQLLogger) Debugf(format string, v ...interface{}) {
+	if l.level <= log.LOG_DEBUG {
+		l.logger.Debugf(format, v...)
+	}
+}
+
+// Infof implements log.ContextLogger.
+func (l *SQLLogger) Infof(format string, v ...interface{}) {
+	if l.level <= log.LOG_INFO {
+		l.logger.Infof(format, v...)
+	}
+}
+
+// Warnf implements log.ContextLogger.
+func (l *SQLLogger) Warnf(format string, v ...interface{}) {
+	if l.level <= log.LOG_WARNING {
+		l.logger.Warnf(format, v...)
+	}
+}
+
+// Errorf implements log.ContextLogger.
+func (l *SQLLogger) Errorf(format string, v ...interface{}) {
+	if l.level <= log.LOG_ERR {
+		l.logger.Errorf(format, v...)
+	}
+}
+
+// Level implements log.ContextLogger.
+func (l *SQLLogger) Level() log.LogLevel {
+	return l.level
+}
+
+// SetLevel implements log.ContextLogger.
+func (l *SQLLogger) SetLevel(level log.LogLevel) {
+	l.level = level
+}
+
+// ShowSQL implements log.ContextLogger.
+func (l *SQLLogger) ShowSQL(show ...bool) {
+	l.showSQL = len(show) == 0 || show[0]
+}
+
+// IsShowSQL implements log.ContextLogger.
+func (l *SQLLogger) IsShowSQL() bool {
+	return l.showSQL
+}
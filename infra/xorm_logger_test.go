@@ -0,0 +1,61 @@
+package infra_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"xorm.io/xorm/contexts"
+	"xorm.io/xorm/log"
+)
+
+func TestSQLLogger(t *testing.T) {
+	base := log.NewLoggerAdapter(log.NewSimpleLogger(nil))
+	base.SetLevel(log.LOG_WARNING)
+	base.ShowSQL(true)
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		err   error
+		wants []string
+	}{
+		{"with request ID", util.WithRequestID(context.Background(), "req-1"), nil,
+			[]string{"level=info", "request_id=req-1", `sql="SELECT * FROM fruits WHERE id = ?"`}},
+		{"without request ID", context.Background(), nil, []string{"level=info"}},
+		{"error", context.Background(), errors.New("deadlock"), []string{"level=error", "deadlock"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := logrus.New()
+			logger.Out = &buf
+			sqlLogger := infra.NewSQLLogger(logger, base)
+			assert.Equal(t, log.LOG_WARNING, sqlLogger.Level())
+			assert.True(t, sqlLogger.IsShowSQL())
+
+			hook := contexts.NewContextHook(tt.ctx, "SELECT * FROM fruits WHERE id = ?", []interface{}{1})
+			hook.End(tt.ctx, nil, tt.err)
+			sqlLogger.AfterSQL(log.LogContext(*hook))
+
+			for _, want := range tt.wants {
+				assert.Contains(t, buf.String(), want)
+			}
+			if tt.ctx == context.Background() {
+				assert.NotContains(t, buf.String(), "request_id")
+			}
+
+			// levels below warning are discarded.
+			buf.Reset()
+			sqlLogger.Infof("connected")
+			sqlLogger.Warnf("slow")
+			assert.NotContains(t, buf.String(), "connected")
+			assert.Contains(t, buf.String(), "slow")
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package infra
+
+import (
+	"context"
+
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"xorm.io/xorm/contexts"
+)
+
+// TracingHook is a xorm hook which traces SQL as child spans of the query context.
+type TracingHook struct {
+	// DBName is db.name attribute.
+	DBName string
+}
+
+// BeforeProcess starts a span of the SQL.
+func (h *TracingHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	ctx, _ := util.Tracer().Start(c.Ctx, "SQL",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mysql"),
+			attribute.String("db.name", h.DBName),
+			attribute.String("db.statement", c.SQL),
+		))
+	return ctx, nil
+}
+
+// AfterProcess records rows affected and the error, and ends the span.
+func (h *TracingHook) AfterProcess(c *contexts.ContextHook) error {
+	span := trace.SpanFromContext(c.Ctx)
+	if c.Result != nil {
+		if rows, err := c.Result.RowsAffected(); err == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", rows))
+		}
+	}
+	util.EndSpan(span, c.Err)
+	return nil
+}
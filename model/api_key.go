@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+)
+
+// APIKey is a personal access token for machine clients.
+type APIKey struct {
+	ID         uint64     `xorm:"pk autoincr" json:"id"`
+	UserID     uint64     `xorm:"notnull index(user)" json:"-"`
+	Name       string     `xorm:"VARCHAR(100) notnull" json:"name"`
+	Prefix     string     `xorm:"VARCHAR(16) notnull unique(prefix)" json:"prefix"`
+	SecretHash string     `xorm:"VARCHAR(64) notnull" json:"-"`
+	Scopes     []string   `xorm:"TEXT json" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  *time.Time `xorm:"created notnull" json:"created_at"`
+}
+
+// TableName represents db table name
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsExpired returns true if the key is expired at the given time.
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// APIKeyCreateBody contains new API key data.
+type APIKeyCreateBody struct {
+	Name      string     `binding:"required,max=100" json:"name"`
+	Scopes    []string   `binding:"dive,min=1,max=64" json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APIKeyCreated contains the created API key and its secret token.
+// The token is shown only once.
+type APIKeyCreated struct {
+	APIKey
+	Token string `json:"token"`
+}
@@ -0,0 +1,29 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKey_IsExpired(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      bool
+	}{
+		{"no expiry", nil, false},
+		{"not expired", ptr.Time(now.Add(time.Second)), false},
+		{"expired", ptr.Time(now), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &model.APIKey{ExpiresAt: tt.expiresAt}
+			assert.Equal(t, tt.want, k.IsExpired(now))
+		})
+	}
+}
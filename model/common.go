@@ -27,3 +27,8 @@ func (m *Common) SetDefault() {
 	m.CreatedAt = nil
 	m.UpdatedAt = nil
 }
+
+// IsActive returns false when the record is deleted or disabled.
+func (m *Common) IsActive() bool {
+	return (m.IsDeleted == nil || !*m.IsDeleted) && (m.IsEnabled == nil || *m.IsEnabled)
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/ptr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,3 +16,23 @@ func TestCommon_SetDefault(t *testing.T) {
 	assert.EqualValues(true, *common.IsEnabled)
 	assert.EqualValues(false, *common.IsDeleted)
 }
+
+func TestCommon_IsActive(t *testing.T) {
+	tests := []struct {
+		name      string
+		isDeleted *bool
+		isEnabled *bool
+		want      bool
+	}{
+		{"default", ptr.Bool(false), ptr.Bool(true), true},
+		{"not loaded", nil, nil, true},
+		{"deleted", ptr.Bool(true), ptr.Bool(true), false},
+		{"disabled", ptr.Bool(false), ptr.Bool(false), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common := &model.Common{IsDeleted: tt.isDeleted, IsEnabled: tt.isEnabled}
+			assert.Equal(t, tt.want, common.IsActive())
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+// CookieSession is a browser session exchanged for a JWT.
+// It is stored in the key-value store and identified by an HttpOnly cookie.
+type CookieSession struct {
+	Iss           string `json:"iss"`
+	Sub           string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	DisplayName   string `json:"display_name"`
+	// SessionID is the login session of the exchanged JWT.
+	SessionID string `json:"session_id"`
+	// RevocationIDs and IssuedAt are checked against the revocation list of the JWT.
+	RevocationIDs []string  `json:"revocation_ids"`
+	IssuedAt      time.Time `json:"issued_at"`
+	// Scopes is nil when the JWT has no scope claim.
+	Scopes    []string  `json:"scopes"`
+	CSRFToken string    `json:"csrf_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CookieSessionCreated contains the CSRF token of the created cookie session.
+// Send it in X-CSRF-Token header on unsafe methods.
+type CookieSessionCreated struct {
+	CSRFToken string    `json:"csrf_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
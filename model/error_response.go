@@ -8,6 +8,8 @@ import (
 // ErrorResponse の定義
 type ErrorResponse struct {
 	Errors []*ErrorResponseInner `json:"errors"`
+	// RequestID is the X-Request-ID to find logs of the request.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // ErrorResponseInner の定義
@@ -65,6 +67,8 @@ const (
 	ErrorNotFound ErrorType = "NotFoundError"
 	// ErrorLimitExceeded throttling error
 	ErrorLimitExceeded ErrorType = "LimitExceededError"
+	// ErrorConflict conflict with another request
+	ErrorConflict ErrorType = "ConflictError"
 )
 
 // NewErrorResponse APIエラー時の詳細レスポンスを生成
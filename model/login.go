@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+// Login is a login history of an user.
+type Login struct {
+	ID        uint64     `xorm:"pk autoincr" json:"id"`
+	UserID    uint64     `xorm:"notnull unique(session)" json:"-"`
+	SessionID string     `xorm:"VARCHAR(255) notnull unique(session)" json:"-"`
+	IP        string     `xorm:"VARCHAR(45)" json:"ip"`
+	UserAgent string     `xorm:"TEXT" json:"user_agent"`
+	CreatedAt *time.Time `xorm:"created notnull" json:"logged_in_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// TableName represents db table name
+func (Login) TableName() string {
+	return "logins"
+}
+
+// Session is a login session of a device.
+type Session struct {
+	Login
+	// Current is true for the session of the request.
+	Current bool `json:"current"`
+}
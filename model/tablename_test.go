@@ -18,6 +18,8 @@ func TestTableName(t *testing.T) {
 		{model.Fruit{}, "fruits"},
 		{model.User{}, "users"},
 		{model.UserPublicData{}, "users"},
+		{model.Login{}, "logins"},
+		{model.APIKey{}, "api_keys"},
 	}
 
 	for _, tt := range tests {
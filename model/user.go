@@ -6,11 +6,30 @@ import (
 
 // User ユーザー情報を格納
 type User struct {
-	Common         `xorm:"extends"`
-	Email          string     `xorm:"VARCHAR(120) notnull index(email)" json:"email"`
-	EmailVerified  *bool      `xorm:"notnull" json:"email_verified"`
-	LastLoginAt    *time.Time `json:"last_login_at"`
-	UserPublicData `xorm:"extends"`
+	Common `xorm:"extends"`
+	// Iss and Sub identify the user in the identity provider. "sub" is unique only within the issuer.
+	Iss                *string    `xorm:"VARCHAR(255) unique(iss_sub)" json:"-"`
+	Sub                *string    `xorm:"VARCHAR(255) unique(iss_sub)" json:"-"`
+	Email              string     `xorm:"VARCHAR(120) notnull index(email)" json:"email"`
+	EmailVerified      *bool      `xorm:"notnull" json:"email_verified"`
+	LastLoginAt        *time.Time `json:"last_login_at"`
+	VerificationSentAt *time.Time `json:"-"`
+	SessionsRevokedAt  *time.Time `json:"-"`
+	Role               string     `xorm:"VARCHAR(20) notnull default 'user'" json:"role"`
+	UserPublicData     `xorm:"extends"`
+}
+
+// user roles.
+const (
+	// RoleUser is the default role.
+	RoleUser = "user"
+	// RoleAdmin can act as other users.
+	RoleAdmin = "admin"
+)
+
+// IsAdmin returns true if the user has the admin role.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
 // TableName represents db table name
@@ -48,3 +67,13 @@ type UserCreateBody struct {
 	Email string `binding:"email" json:"email" `
 	UserProfile
 }
+
+// UserVerifyBody contains an email verification token.
+type UserVerifyBody struct {
+	Token string `binding:"required" json:"token" form:"token"`
+}
+
+// UserResendVerificationBody requests a new verification email.
+type UserResendVerificationBody struct {
+	Email string `binding:"email" json:"email"`
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+)
+
+// APIKeysInterface has users' API keys.
+type APIKeysInterface interface {
+	Create(key *model.APIKey) error
+	GetByUserID(userID uint64) ([]*model.APIKey, error)
+	GetByPrefix(prefix string) (key *model.APIKey, ok bool)
+	Revoke(userID uint64, id uint64, revokedAt time.Time) (ok bool, err error)
+	Touch(id uint64, usedAt time.Time) error
+}
+
+// APIKeys implements APIKeysInterface.
+type APIKeys struct {
+	engine infra.EngineInterface
+}
+
+// NewAPIKeys initializes an API keys repository.
+func NewAPIKeys(engine infra.EngineInterface) *APIKeys {
+	k := APIKeys{engine}
+	return &k
+}
+
+// Create adds a new API key.
+func (k *APIKeys) Create(key *model.APIKey) error {
+	_, err := k.engine.InsertOne(key)
+	return err
+}
+
+// GetByUserID returns the user's API keys which are not revoked.
+func (k *APIKeys) GetByUserID(userID uint64) ([]*model.APIKey, error) {
+	list := make([]*model.APIKey, 0)
+	err := k.engine.Where("user_id = ? AND revoked_at IS NULL", userID).Desc("id").Find(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// GetByPrefix returns the API key which is not revoked by the prefix.
+func (k *APIKeys) GetByPrefix(prefix string) (key *model.APIKey, ok bool) {
+	key = &model.APIKey{}
+	ok, err := k.engine.Where("prefix = ? AND revoked_at IS NULL", prefix).Get(key)
+	if err != nil || !ok {
+		return nil, false
+	}
+	return key, true
+}
+
+// Revoke revokes the user's API key.
+// It returns false when the key does not exist or has been already revoked.
+func (k *APIKeys) Revoke(userID uint64, id uint64, revokedAt time.Time) (ok bool, err error) {
+	key := model.APIKey{RevokedAt: &revokedAt}
+	affected, err := k.engine.ID(id).Where("user_id = ? AND revoked_at IS NULL", userID).Update(&key)
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// Touch updates last_used_at of the API key.
+func (k *APIKeys) Touch(id uint64, usedAt time.Time) error {
+	key := model.APIKey{LastUsedAt: &usedAt}
+	_, err := k.engine.ID(id).Update(&key)
+	return err
+}
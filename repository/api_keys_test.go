@@ -0,0 +1,61 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+)
+
+func TestAPIKeys(t *testing.T) {
+	engine, cleanup := setupDB(t)
+	defer cleanup()
+
+	keys := repository.NewAPIKeys(engine)
+
+	var userID uint64 = 1
+	key := &model.APIKey{
+		UserID:     userID,
+		Name:       "batch",
+		Prefix:     "0a1b2c3d",
+		SecretHash: "hash",
+		Scopes:     []string{"fruits:read"},
+	}
+
+	assert := assert.New(t)
+	if err := keys.Create(key); err != nil {
+		t.Fatalf("APIKeys.Create() error = %v", err)
+	}
+
+	got, ok := keys.GetByPrefix("0a1b2c3d")
+	if assert.True(ok) {
+		assert.Equal(key.ID, got.ID)
+		assert.Equal([]string{"fruits:read"}, got.Scopes)
+	}
+
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.Local)
+	assert.NoError(keys.Touch(key.ID, now))
+
+	list, err := keys.GetByUserID(userID)
+	assert.NoError(err)
+	if assert.Len(list, 1) {
+		assert.True(now.Equal(*list[0].LastUsedAt))
+	}
+
+	// other users cannot revoke the key.
+	ok, err = keys.Revoke(userID+1, key.ID, now)
+	assert.NoError(err)
+	assert.False(ok)
+
+	ok, err = keys.Revoke(userID, key.ID, now)
+	assert.NoError(err)
+	assert.True(ok)
+
+	_, ok = keys.GetByPrefix("0a1b2c3d")
+	assert.False(ok)
+	list, _ = keys.GetByUserID(userID)
+	assert.Len(list, 0)
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+)
+
+// CookieSessionsInterface stores browser sessions in the key-value store.
+type CookieSessionsInterface interface {
+	Create(id string, session *model.CookieSession, ttl time.Duration) error
+	Get(id string) (*model.CookieSession, error)
+	Delete(id string) error
+}
+
+// CookieSessions implements CookieSessionsInterface.
+type CookieSessions struct {
+	kvsClient infra.KVSClientInterface
+}
+
+// NewCookieSessions initializes a cookie sessions repository.
+func NewCookieSessions(kvsClient infra.KVSClientInterface) *CookieSessions {
+	s := CookieSessions{kvsClient}
+	return &s
+}
+
+// cookieSessionKey hashes the session id not to leak valid cookies from the key-value store.
+func cookieSessionKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return fmt.Sprintf("cookie_sessions/%s", hex.EncodeToString(sum[:]))
+}
+
+// Create stores the session until ttl passes.
+func (s *CookieSessions) Create(id string, session *model.CookieSession, ttl time.Duration) error {
+	return s.kvsClient.SetStructWithExpire(cookieSessionKey(id), session, ttl)
+}
+
+// Get returns the session. infra.ErrKVSNotFound is returned when it does not exist.
+func (s *CookieSessions) Get(id string) (*model.CookieSession, error) {
+	session := model.CookieSession{}
+	if err := s.kvsClient.GetStruct(cookieSessionKey(id), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Delete removes the session.
+func (s *CookieSessions) Delete(id string) error {
+	return s.kvsClient.Delete(cookieSessionKey(id))
+}
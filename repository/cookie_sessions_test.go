@@ -0,0 +1,30 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+)
+
+func TestCookieSessions(t *testing.T) {
+	kvs := NewKVSClientMock()
+	sessions := repository.NewCookieSessions(kvs)
+
+	assert := assert.New(t)
+	session := &model.CookieSession{Sub: "abc", CSRFToken: "csrf", Scopes: nil}
+	assert.NoError(sessions.Create("id-1", session, time.Hour))
+	assert.False(kvs.Cached("cookie_sessions/id-1"), "session id should be hashed")
+
+	got, err := sessions.Get("id-1")
+	assert.NoError(err)
+	assert.Equal(session, got)
+
+	assert.NoError(sessions.Delete("id-1"))
+	_, err = sessions.Get("id-1")
+	assert.Equal(infra.ErrKVSNotFound, err)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -19,8 +20,8 @@ import (
 	"github.com/moby/moby/client"
 
 	"github.com/itomofumi/go-gin-xorm-starter/infra"
-	"xorm.io/core"
 	"xorm.io/xorm"
+	"xorm.io/xorm/log"
 )
 
 var dockerMySQLImage = "mysql:5.7.21"
@@ -56,6 +57,9 @@ func TestMain(m *testing.M) {
 
 type KVSClientMock struct {
 	store map[string]interface{}
+
+	// deleted has keys passed to Delete.
+	deleted []string
 }
 
 func NewKVSClientMock() *KVSClientMock {
@@ -68,7 +72,7 @@ func NewKVSClientMock() *KVSClientMock {
 func (kc *KVSClientMock) GetStruct(key string, structPtr interface{}) error {
 	v, ok := kc.store[key]
 	if !ok {
-		return fmt.Errorf("key does not exist")
+		return infra.ErrKVSNotFound
 	}
 	str := v.(string)
 	err := json.Unmarshal([]byte(str), structPtr)
@@ -87,6 +91,48 @@ func (kc *KVSClientMock) SetStruct(key string, structPtr interface{}) error {
 	return nil
 }
 
+func (kc *KVSClientMock) SetStructWithExpire(key string, structPtr interface{}, expire time.Duration) error {
+	return kc.SetStruct(key, structPtr)
+}
+
+func (kc *KVSClientMock) Delete(key string) error {
+	delete(kc.store, key)
+	kc.deleted = append(kc.deleted, key)
+	return nil
+}
+
+func (kc *KVSClientMock) Incr(key string) (int64, error) {
+	var n int64
+	if v, ok := kc.store[key]; ok {
+		if err := json.Unmarshal([]byte(v.(string)), &n); err != nil {
+			return 0, err
+		}
+	}
+	n++
+	kc.store[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (kc *KVSClientMock) EvalInts(script *infra.KVSScript, keys []string, args ...interface{}) ([]int64, error) {
+	return nil, fmt.Errorf("scripts are not supported")
+}
+
+// Cached returns true if the key has a value.
+func (kc *KVSClientMock) Cached(key string) bool {
+	_, ok := kc.store[key]
+	return ok
+}
+
+// Deleted returns true if the key has been deleted.
+func (kc *KVSClientMock) Deleted(key string) bool {
+	for _, k := range kc.deleted {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
 func setupInfra() (cleanup func()) {
 	setMySQLTestEnv()
 	mysqlConf := infra.LoadMySQLConfigEnv()
@@ -290,7 +336,7 @@ func waitDbIsReady() error {
 
 	engine.SetConnMaxLifetime(time.Second * 1)
 	engine.ShowSQL(false)
-	engine.Logger().SetLevel(core.LOG_WARNING)
+	engine.Logger().SetLevel(log.LOG_WARNING)
 
 	retry := 15
 	for i := 0; i < retry; i++ {
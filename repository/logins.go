@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+)
+
+// mysqlErrDupEntry is "Duplicate entry" error number.
+const mysqlErrDupEntry = 1062
+
+// LoginsInterface has users' login history.
+type LoginsInterface interface {
+	Record(login *model.Login, loggedInAt time.Time) (created bool, err error)
+	GetByUserID(userID uint64, limit int) ([]*model.Login, error)
+}
+
+// Logins implements LoginsInterface.
+type Logins struct {
+	engine    infra.EngineInterface
+	kvsClient infra.KVSClientInterface
+	userCache *userCache
+}
+
+// NewLogins initializes a logins repository.
+func NewLogins(engine infra.EngineInterface, kvsClient infra.KVSClientInterface) *Logins {
+	l := Logins{
+		engine:    engine,
+		kvsClient: kvsClient,
+		userCache: &userCache{kvsClient},
+	}
+	return &l
+}
+
+// Record adds the login session and updates user's last_login_at.
+// It returns false when the session has been already recorded.
+func (l *Logins) Record(login *model.Login, loggedInAt time.Time) (created bool, err error) {
+	loginSessionKey := fmt.Sprintf("logins/%d/%s", login.UserID, login.SessionID)
+	// most requests of the session hit cache.
+	if l.kvsClient != nil {
+		var cached model.Login
+		if err := l.kvsClient.GetStruct(loginSessionKey, &cached); err == nil {
+			return false, nil
+		}
+	}
+
+	session := l.engine.NewSession()
+	defer session.Close()
+
+	err = session.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = session.InsertOne(login)
+	if err != nil {
+		session.Rollback()
+		if myErr, ok := err.(*mysql.MySQLError); ok && myErr.Number == mysqlErrDupEntry {
+			l.cache(loginSessionKey, login)
+			return false, nil
+		}
+		return false, err
+	}
+
+	user := model.User{}
+	user.LastLoginAt = &loggedInAt
+	_, err = session.ID(login.UserID).Update(&user)
+	if err != nil {
+		session.Rollback()
+		return false, err
+	}
+
+	err = session.Commit()
+	if err != nil {
+		return false, err
+	}
+	// last_login_at has been changed.
+	l.userCache.invalidateByID(l.engine, login.UserID)
+
+	l.cache(loginSessionKey, login)
+	return true, nil
+}
+
+// GetByUserID returns the latest logins of the user.
+func (l *Logins) GetByUserID(userID uint64, limit int) ([]*model.Login, error) {
+	list := make([]*model.Login, 0)
+	err := l.engine.Where("user_id = ?", userID).Desc("id").Limit(limit).Find(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (l *Logins) cache(key string, login *model.Login) {
+	if l.kvsClient != nil {
+		_ = l.kvsClient.SetStruct(key, login)
+	}
+}
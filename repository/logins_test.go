@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+)
+
+func TestLogins_Record(t *testing.T) {
+	engine, cleanup := setupDB(t)
+	defer cleanup()
+
+	logins := repository.NewLogins(engine, NewKVSClientMock())
+	users := repository.NewUsers(engine, nil)
+
+	var userID uint64 = 1
+	loggedInAt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.Local)
+
+	assert := assert.New(t)
+	created, err := logins.Record(&model.Login{UserID: userID, SessionID: "jti:aaa", IP: "127.0.0.1", UserAgent: "httptest"}, loggedInAt)
+	assert.NoError(err)
+	assert.True(created)
+
+	// the same session is not recorded twice.
+	created, err = logins.Record(&model.Login{UserID: userID, SessionID: "jti:aaa", IP: "127.0.0.1", UserAgent: "httptest"}, loggedInAt.Add(time.Hour))
+	assert.NoError(err)
+	assert.False(created)
+
+	created, err = logins.Record(&model.Login{UserID: userID, SessionID: "jti:bbb", IP: "127.0.0.2", UserAgent: "httptest"}, loggedInAt.Add(time.Hour))
+	assert.NoError(err)
+	assert.True(created)
+
+	user, ok := users.GetByID(userID)
+	if !ok {
+		t.Fatalf("Users.GetByID() failed")
+	}
+	assert.True(loggedInAt.Add(time.Hour).Equal(*user.LastLoginAt))
+
+	list, err := logins.GetByUserID(userID, 10)
+	assert.NoError(err)
+	if assert.Len(list, 2) {
+		assert.Equal("127.0.0.2", list[0].IP)
+		assert.Equal("127.0.0.1", list[1].IP)
+	}
+}
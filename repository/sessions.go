@@ -0,0 +1,326 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+)
+
+// SessionsInterface manages users' login sessions and their revocation.
+//
+// MySQL is the source of truth, and the revocation list is published to the key-value store
+// so that every API instance can check it on each request.
+type SessionsInterface interface {
+	GetActiveByUserID(userID uint64, limit int) ([]*model.Login, error)
+	Revoke(userID uint64, id uint64, revokedAt time.Time) (ok bool, err error)
+	RevokeAll(userID uint64, revokedAt time.Time) error
+	IsRevoked(iss string, sub string, sessionIDs []string, issuedAt time.Time) (bool, error)
+	RestoreRevocations(now time.Time) (int, error)
+	RevocationsLost() (bool, error)
+}
+
+// Sessions implements SessionsInterface.
+type Sessions struct {
+	engine    infra.EngineInterface
+	kvsClient infra.KVSClientInterface
+	userCache *userCache
+	// revocationTTL is how long revocations are kept in the key-value store.
+	// It should be longer than the lifetime of the tokens (or refresh tokens for "origin_jti").
+	revocationTTL time.Duration
+}
+
+// NewSessions initializes a sessions repository.
+func NewSessions(engine infra.EngineInterface, kvsClient infra.KVSClientInterface, revocationTTL time.Duration) *Sessions {
+	s := Sessions{
+		engine:        engine,
+		kvsClient:     kvsClient,
+		userCache:     &userCache{kvsClient},
+		revocationTTL: revocationTTL,
+	}
+	return &s
+}
+
+// apiKeySessionPrefix is the session id prefix of API key logins.
+const apiKeySessionPrefix = "api_key:"
+
+// revocationCheckTTL is how long a token checked in MySQL is not revoked in the key-value store.
+// A revocation which failed to be published is effective after this.
+const revocationCheckTTL = 30 * time.Second
+
+// revocationsRestoredKey exists while the key-value store keeps the restored revocation list.
+const revocationsRestoredKey = "revocations/restored"
+
+// revocations are keyed by the identity of the user, i.e. iss and sub of the tokens.
+func revokedSessionKey(iss, sub, sessionID string) string {
+	return fmt.Sprintf("revocations/%s/sessions/%s", userIdentity(iss, sub), sessionID)
+}
+
+func revokedAllKey(iss, sub string) string {
+	return fmt.Sprintf("revocations/%s/all", userIdentity(iss, sub))
+}
+
+func revocationCheckedKey(iss, sub string, sessionIDs []string, issuedAt time.Time) string {
+	return fmt.Sprintf("revocations/%s/checked/%d/%s", userIdentity(iss, sub), issuedAt.Unix(), strings.Join(sessionIDs, ","))
+}
+
+// GetActiveByUserID returns the latest sessions of the user which are not revoked.
+// API keys are managed by API keys repository instead.
+func (s *Sessions) GetActiveByUserID(userID uint64, limit int) ([]*model.Login, error) {
+	list := make([]*model.Login, 0)
+	err := s.engine.Where("user_id = ? AND revoked_at IS NULL AND session_id NOT LIKE ?", userID, apiKeySessionPrefix+"%").
+		Desc("id").Limit(limit).Find(&list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Revoke revokes the user's session and publishes it to the revocation list.
+// Revoking a revoked session publishes it again. It returns false when the session does not exist.
+func (s *Sessions) Revoke(userID uint64, id uint64, revokedAt time.Time) (ok bool, err error) {
+	login := model.Login{}
+	ok, err = s.engine.ID(id).Where("user_id = ? AND session_id NOT LIKE ?", userID, apiKeySessionPrefix+"%").Get(&login)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if login.RevokedAt == nil {
+		_, err = s.engine.ID(id).Where("revoked_at IS NULL").Update(&model.Login{RevokedAt: &revokedAt})
+		if err != nil {
+			return false, err
+		}
+		login.RevokedAt = &revokedAt
+	}
+
+	iss, sub, err := s.getIdentity(userID)
+	if err != nil {
+		return false, err
+	}
+	if sub == "" {
+		return true, nil
+	}
+	if err := s.publish(revokedSessionKey(iss, sub, login.SessionID), *login.RevokedAt, revokedAt); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RevokeAll revokes all sessions of the user, including tokens issued before revokedAt
+// which have not been recorded as sessions yet.
+func (s *Sessions) RevokeAll(userID uint64, revokedAt time.Time) error {
+	iss, sub, err := s.getIdentity(userID)
+	if err != nil {
+		return err
+	}
+
+	// API keys are revoked by API keys repository, not by signing out everywhere.
+	active := make([]*model.Login, 0)
+	err = s.engine.Where("user_id = ? AND revoked_at IS NULL AND session_id NOT LIKE ?", userID, apiKeySessionPrefix+"%").Find(&active)
+	if err != nil {
+		return err
+	}
+
+	session := s.engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	user := model.User{}
+	user.SessionsRevokedAt = &revokedAt
+	if _, err := session.ID(userID).Update(&user); err != nil {
+		session.Rollback()
+		return err
+	}
+	_, err = session.Where("user_id = ? AND revoked_at IS NULL AND session_id NOT LIKE ?", userID, apiKeySessionPrefix+"%").
+		Update(&model.Login{RevokedAt: &revokedAt})
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	if err := session.Commit(); err != nil {
+		return err
+	}
+	s.userCache.invalidateByID(s.engine, userID)
+	if sub == "" {
+		return nil
+	}
+
+	if err := s.publish(revokedAllKey(iss, sub), revokedAt, revokedAt); err != nil {
+		return err
+	}
+	// tokens refreshed after revokedAt still have the revoked "origin_jti".
+	for _, login := range active {
+		if err := s.publish(revokedSessionKey(iss, sub, login.SessionID), revokedAt, revokedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsRevoked returns true when one of the session ids of the user identified by iss and sub is revoked,
+// or the token was issued before all sessions of the user were revoked.
+//
+// A miss in the key-value store is not trusted, since publishing may have failed or the store may have lost the list.
+// It is checked in MySQL, and the result is kept for revocationCheckTTL.
+// It falls back to MySQL when the key-value store is not available.
+func (s *Sessions) IsRevoked(iss string, sub string, sessionIDs []string, issuedAt time.Time) (bool, error) {
+	if s.kvsClient == nil {
+		return s.isRevokedInDB(iss, sub, sessionIDs, issuedAt)
+	}
+	revoked, err := s.isRevokedInKVS(iss, sub, sessionIDs, issuedAt)
+	if err != nil {
+		return s.isRevokedInDB(iss, sub, sessionIDs, issuedAt)
+	}
+	if revoked {
+		return true, nil
+	}
+
+	checkedKey := revocationCheckedKey(iss, sub, sessionIDs, issuedAt)
+	var checked bool
+	if err := s.kvsClient.GetStruct(checkedKey, &checked); err == nil && checked {
+		return false, nil
+	}
+	revoked, err = s.isRevokedInDB(iss, sub, sessionIDs, issuedAt)
+	if err != nil || revoked {
+		return revoked, err
+	}
+	_ = s.kvsClient.SetStructWithExpire(checkedKey, true, revocationCheckTTL)
+	return false, nil
+}
+
+func (s *Sessions) isRevokedInKVS(iss string, sub string, sessionIDs []string, issuedAt time.Time) (bool, error) {
+	var revokedAt time.Time
+	for _, id := range sessionIDs {
+		err := s.kvsClient.GetStruct(revokedSessionKey(iss, sub, id), &revokedAt)
+		if err == nil {
+			return true, nil
+		}
+		if err != infra.ErrKVSNotFound {
+			return false, err
+		}
+	}
+
+	err := s.kvsClient.GetStruct(revokedAllKey(iss, sub), &revokedAt)
+	if err == infra.ErrKVSNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !issuedAt.After(revokedAt), nil
+}
+
+func (s *Sessions) isRevokedInDB(iss string, sub string, sessionIDs []string, issuedAt time.Time) (bool, error) {
+	user := model.User{}
+	found, err := s.engine.Where("iss = ? AND sub = ?", iss, sub).Cols("id", "sessions_revoked_at").Get(&user)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		// the user has never logged in.
+		return false, nil
+	}
+	if user.SessionsRevokedAt != nil && !issuedAt.After(*user.SessionsRevokedAt) {
+		return true, nil
+	}
+	if len(sessionIDs) == 0 {
+		return false, nil
+	}
+
+	return s.engine.Where("user_id = ? AND revoked_at IS NOT NULL", user.ID).In("session_id", sessionIDs).Exist(&model.Login{})
+}
+
+// RestoreRevocations publishes revocations which have not expired to the key-value store again,
+// e.g. after the key-value store lost its data. It returns the number of published revocations.
+func (s *Sessions) RestoreRevocations(now time.Time) (int, error) {
+	if s.kvsClient == nil {
+		return 0, nil
+	}
+	since := now.Add(-s.revocationTTL)
+	count := 0
+
+	users := make([]*model.User, 0)
+	err := s.engine.Where("sessions_revoked_at > ? AND iss IS NOT NULL AND sub IS NOT NULL", since).
+		Cols("id", "iss", "sub", "sessions_revoked_at").Find(&users)
+	if err != nil {
+		return count, err
+	}
+	for _, user := range users {
+		if err := s.publish(revokedAllKey(*user.Iss, *user.Sub), *user.SessionsRevokedAt, now); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	type revokedLogin struct {
+		model.Login `xorm:"extends"`
+		Iss         string
+		Sub         string
+	}
+	logins := make([]*revokedLogin, 0)
+	err = s.engine.Table("logins").Join("INNER", "users", "users.id = logins.user_id").
+		Where("logins.revoked_at > ? AND users.iss IS NOT NULL AND users.sub IS NOT NULL", since).
+		Cols("logins.session_id", "logins.revoked_at", "users.iss", "users.sub").Find(&logins)
+	if err != nil {
+		return count, err
+	}
+	for _, login := range logins {
+		if err := s.publish(revokedSessionKey(login.Iss, login.Sub, login.SessionID), *login.RevokedAt, now); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	if err := s.kvsClient.SetStructWithExpire(revocationsRestoredKey, now, s.revocationTTL); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// RevocationsLost returns true when the key-value store does not keep the restored revocation list,
+// e.g. after it restarted without persistence or failed over.
+func (s *Sessions) RevocationsLost() (bool, error) {
+	if s.kvsClient == nil {
+		return false, nil
+	}
+	var restoredAt time.Time
+	err := s.kvsClient.GetStruct(revocationsRestoredKey, &restoredAt)
+	if err == infra.ErrKVSNotFound {
+		return true, nil
+	}
+	return false, err
+}
+
+// publish stores the revocation until revocationTTL passes from revokedAt.
+func (s *Sessions) publish(key string, revokedAt time.Time, now time.Time) error {
+	if s.kvsClient == nil {
+		return nil
+	}
+	expire := s.revocationTTL - now.Sub(revokedAt)
+	if expire < time.Second {
+		return nil
+	}
+	return s.kvsClient.SetStructWithExpire(key, revokedAt, expire)
+}
+
+// getIdentity returns iss and sub of the user, or empty strings if the user is not linked yet.
+func (s *Sessions) getIdentity(userID uint64) (iss string, sub string, err error) {
+	user := model.User{}
+	found, err := s.engine.ID(userID).Cols("iss", "sub").Get(&user)
+	if err != nil {
+		return "", "", err
+	}
+	if !found {
+		return "", "", fmt.Errorf("user id = %v not found", userID)
+	}
+	if user.Iss == nil || user.Sub == nil {
+		// no token has been accepted for the user.
+		return "", "", nil
+	}
+	return *user.Iss, *user.Sub, nil
+}
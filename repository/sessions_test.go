@@ -0,0 +1,168 @@
+package repository_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+)
+
+func TestSessions_Revoke(t *testing.T) {
+	engine, cleanup := setupDB(t)
+	defer cleanup()
+
+	kvs := NewKVSClientMock()
+	logins := repository.NewLogins(engine, kvs)
+	users := repository.NewUsers(engine, kvs)
+	sessions := repository.NewSessions(engine, kvs, 24*time.Hour)
+
+	var userID uint64 = 1
+	iss := "https://idp.example.com"
+	sub := "3f1e0c9a-0000-4000-8000-000000000001"
+	if _, ok := users.LinkSub("test@example.com", iss, sub); !ok {
+		t.Fatalf("Users.LinkSub() failed")
+	}
+	loggedInAt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.Local)
+	for _, sessionID := range []string{"origin_jti:aaa", "origin_jti:bbb", "api_key:1"} {
+		if _, err := logins.Record(&model.Login{UserID: userID, SessionID: sessionID}, loggedInAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert := assert.New(t)
+	list, err := sessions.GetActiveByUserID(userID, 10)
+	assert.NoError(err)
+	if !assert.Len(list, 2, "API key sessions should be excluded") {
+		return
+	}
+
+	revokedAt := loggedInAt.Add(time.Hour)
+	ok, err := sessions.Revoke(userID, list[1].ID, revokedAt)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.True(kvs.Cached("revocations/https:%2F%2Fidp.example.com/" + sub + "/sessions/origin_jti:aaa"))
+
+	// another user's session.
+	ok, err = sessions.Revoke(userID+1, list[0].ID, revokedAt)
+	assert.NoError(err)
+	assert.False(ok)
+
+	list, err = sessions.GetActiveByUserID(userID, 10)
+	assert.NoError(err)
+	assert.Len(list, 1)
+
+	tests := []struct {
+		name       string
+		sessionIDs []string
+		want       bool
+	}{
+		{"revoked session", []string{"jti:xxx", "origin_jti:aaa"}, true},
+		{"active session", []string{"jti:yyy", "origin_jti:bbb"}, false},
+		{"new session", []string{"jti:zzz"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// both the key-value store and the fallback to MySQL.
+			for _, s := range []*repository.Sessions{sessions, repository.NewSessions(engine, nil, 24*time.Hour)} {
+				got, err := s.IsRevoked(iss, sub, tt.sessionIDs, revokedAt)
+				assert.NoError(err)
+				assert.Equal(tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSessions_RevokeAll(t *testing.T) {
+	engine, cleanup := setupDB(t)
+	defer cleanup()
+
+	kvs := NewKVSClientMock()
+	logins := repository.NewLogins(engine, kvs)
+	users := repository.NewUsers(engine, kvs)
+	sessions := repository.NewSessions(engine, kvs, 24*time.Hour)
+
+	var userID uint64 = 1
+	iss := "https://idp.example.com"
+	sub := "3f1e0c9a-0000-4000-8000-000000000001"
+	if _, ok := users.LinkSub("test@example.com", iss, sub); !ok {
+		t.Fatalf("Users.LinkSub() failed")
+	}
+	now := time.Now().Truncate(time.Second)
+	for _, sessionID := range []string{"origin_jti:aaa", "api_key:1"} {
+		if _, err := logins.Record(&model.Login{UserID: userID, SessionID: sessionID}, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert := assert.New(t)
+	assert.NoError(sessions.RevokeAll(userID, now))
+
+	list, err := sessions.GetActiveByUserID(userID, 10)
+	assert.NoError(err)
+	assert.Len(list, 0)
+
+	// API keys are not revoked by signing out everywhere.
+	apiKeyLogin := model.Login{}
+	found, err := engine.Where("user_id = ? AND session_id = ?", userID, "api_key:1").Get(&apiKeyLogin)
+	assert.NoError(err)
+	assert.True(found)
+	assert.Nil(apiKeyLogin.RevokedAt)
+	assert.False(kvs.Cached("revocations/https:%2F%2Fidp.example.com/" + sub + "/sessions/api_key:1"))
+
+	tests := []struct {
+		name       string
+		sessionIDs []string
+		issuedAt   time.Time
+		want       bool
+	}{
+		{"issued before", []string{"jti:xxx"}, now.Add(-time.Minute), true},
+		{"refreshed token of revoked session", []string{"jti:yyy", "origin_jti:aaa"}, now.Add(time.Minute), true},
+		{"issued after", []string{"jti:zzz"}, now.Add(time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, s := range []*repository.Sessions{sessions, repository.NewSessions(engine, nil, 24*time.Hour)} {
+				got, err := s.IsRevoked(iss, sub, tt.sessionIDs, tt.issuedAt)
+				assert.NoError(err)
+				assert.Equal(tt.want, got)
+			}
+		})
+	}
+
+	// the same sub of another issuer is another user.
+	for _, s := range []*repository.Sessions{sessions, repository.NewSessions(engine, nil, 24*time.Hour)} {
+		got, err := s.IsRevoked("https://other.example.com", sub, []string{"jti:xxx"}, now.Add(-time.Minute))
+		assert.NoError(err)
+		assert.False(got)
+	}
+
+	// revocations are published again to an empty key-value store.
+	restored := NewKVSClientMock()
+	count, err := repository.NewSessions(engine, restored, 24*time.Hour).RestoreRevocations(now)
+	assert.NoError(err)
+	assert.Equal(2, count)
+	assert.True(restored.Cached("revocations/https:%2F%2Fidp.example.com/" + sub + "/all"))
+	assert.True(restored.Cached("revocations/https:%2F%2Fidp.example.com/" + sub + "/sessions/origin_jti:aaa"))
+
+	lost, err := repository.NewSessions(engine, restored, 24*time.Hour).RevocationsLost()
+	assert.NoError(err)
+	assert.False(lost)
+
+	// a key-value store which lost the list is detected, and misses are checked in MySQL meanwhile.
+	empty := NewKVSClientMock()
+	emptySessions := repository.NewSessions(engine, empty, 24*time.Hour)
+	lost, err = emptySessions.RevocationsLost()
+	assert.NoError(err)
+	assert.True(lost)
+	for _, tt := range tests {
+		got, err := emptySessions.IsRevoked(iss, sub, tt.sessionIDs, tt.issuedAt)
+		assert.NoError(err, tt.name)
+		assert.Equal(tt.want, got, tt.name)
+	}
+	assert.True(empty.Cached("revocations/https:%2F%2Fidp.example.com/"+sub+"/checked/"+
+		strconv.FormatInt(now.Add(time.Minute).Unix(), 10)+"/jti:zzz"), "the result of a token not revoked should be kept")
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+)
+
+// user cache indexes.
+const (
+	userCacheByEmail    = "emails"
+	userCacheByIdentity = "identities"
+)
+
+// userIdentity is the cache key value of the subject of the issuer.
+func userIdentity(iss, sub string) string {
+	return url.PathEscape(iss) + "/" + url.PathEscape(sub)
+}
+
+// userCache caches users by email or identity (iss and sub) with versioned keys.
+//
+// Every write path bumps the version of the user's keys and deletes the current entries.
+// Readers which loaded the user before the write store it under the old version,
+// so stale data is never returned after the write.
+type userCache struct {
+	kvsClient infra.KVSClientInterface
+}
+
+func userVersionKey(index, value string) string {
+	return fmt.Sprintf("users/%s/%s/version", index, value)
+}
+
+func userKey(index, value string, version int64) string {
+	return fmt.Sprintf("users/%s/%s/v%d", index, value, version)
+}
+
+// version returns the current cache version of the key.
+func (uc *userCache) version(index, value string) (int64, error) {
+	var version int64
+	err := uc.kvsClient.GetStruct(userVersionKey(index, value), &version)
+	if err == nil {
+		return version, nil
+	}
+	// the first access to the key.
+	return uc.kvsClient.Incr(userVersionKey(index, value))
+}
+
+// get loads the user from cache.
+// The returned version must be passed to set after loading the user from db.
+func (uc *userCache) get(index, value string, user *model.User) (version int64, ok bool) {
+	if uc.kvsClient == nil {
+		return 0, false
+	}
+	version, err := uc.version(index, value)
+	if err != nil {
+		return 0, false
+	}
+	err = uc.kvsClient.GetStruct(userKey(index, value, version), user)
+	return version, err == nil
+}
+
+// set saves the user loaded while the cache version was the given one.
+func (uc *userCache) set(index, value string, version int64, user *model.User) {
+	if uc.kvsClient == nil || version == 0 {
+		return
+	}
+	_ = uc.kvsClient.SetStruct(userKey(index, value, version), user)
+}
+
+// invalidate discards the cached user of the key.
+func (uc *userCache) invalidate(index, value string) {
+	if uc.kvsClient == nil || value == "" {
+		return
+	}
+	version, err := uc.kvsClient.Incr(userVersionKey(index, value))
+	if err != nil {
+		return
+	}
+	_ = uc.kvsClient.Delete(userKey(index, value, version-1))
+}
+
+// invalidateUser discards all cached entries of the user.
+func (uc *userCache) invalidateUser(user *model.User) {
+	uc.invalidate(userCacheByEmail, user.Email)
+	if user.Iss != nil && user.Sub != nil {
+		uc.invalidate(userCacheByIdentity, userIdentity(*user.Iss, *user.Sub))
+	}
+}
+
+// invalidateByID discards all cached entries of the user id.
+func (uc *userCache) invalidateByID(engine infra.EngineInterface, id uint64) {
+	if uc.kvsClient == nil {
+		return
+	}
+	var user model.User
+	found, err := engine.ID(id).Cols("email", "iss", "sub").Get(&user)
+	if err != nil || !found {
+		return
+	}
+	uc.invalidateUser(&user)
+}
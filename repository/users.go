@@ -2,6 +2,7 @@ package repository
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/itomofumi/go-gin-xorm-starter/infra"
 	"github.com/itomofumi/go-gin-xorm-starter/model"
@@ -12,24 +13,29 @@ import (
 // UsersInterface has users data.
 type UsersInterface interface {
 	GetByEmail(email string) (user *model.User, ok bool)
+	GetBySub(iss string, sub string) (user *model.User, ok bool)
 	GetByID(id uint64) (user *model.User, ok bool)
+	LinkSub(email string, iss string, sub string) (user *model.User, ok bool)
 	Create(email string, profile *model.UserProfile) (*model.UserPublicData, error)
 	Verify(userID uint64) error
+	MarkVerificationSent(userID uint64, sentAt time.Time, interval time.Duration) (ok bool, err error)
+	UnmarkVerificationSent(userID uint64, sentAt time.Time) error
+	ConsumeVerification(userID uint64, sentAt time.Time) (ok bool, err error)
 	Update(id uint64, profile *model.UserProfile) (*model.UserPublicData, error)
 	Delete(id uint64) error
 }
 
 // Users has users data.
 type Users struct {
-	engine    infra.EngineInterface
-	kvsClient infra.KVSClientInterface
+	engine infra.EngineInterface
+	cache  *userCache
 }
 
 // NewUsers initializes Users
 func NewUsers(engine infra.EngineInterface, kvsClient infra.KVSClientInterface) *Users {
 	u := Users{
-		engine:    engine,
-		kvsClient: kvsClient,
+		engine: engine,
+		cache:  &userCache{kvsClient},
 	}
 	return &u
 }
@@ -38,13 +44,10 @@ func NewUsers(engine infra.EngineInterface, kvsClient infra.KVSClientInterface)
 func (u *Users) GetByEmail(email string) (user *model.User, ok bool) {
 	var result model.User
 
-	userEmailKey := "users/emails/"
 	// try to get from cache.
-	if u.kvsClient != nil {
-		err := u.kvsClient.GetStruct(userEmailKey+email, &result)
-		if err == nil {
-			return &result, true
-		}
+	version, ok := u.cache.get(userCacheByEmail, email, &result)
+	if ok {
+		return &result, true
 	}
 
 	ok, err := u.engine.Where("is_deleted = ? AND is_enabled = ? AND email = ?", false, true, email).Get(&result)
@@ -57,9 +60,60 @@ func (u *Users) GetByEmail(email string) (user *model.User, ok bool) {
 	}
 
 	// save result to cache.
-	if u.kvsClient != nil {
-		_ = u.kvsClient.SetStruct(userEmailKey+email, &result)
+	u.cache.set(userCacheByEmail, email, version, &result)
+
+	return &result, true
+}
+
+// GetBySub returns an user who has the given subject of the identity provider (issuer).
+func (u *Users) GetBySub(iss string, sub string) (user *model.User, ok bool) {
+	var result model.User
+
+	// try to get from cache.
+	identity := userIdentity(iss, sub)
+	version, ok := u.cache.get(userCacheByIdentity, identity, &result)
+	if ok {
+		return &result, true
+	}
+
+	ok, err := u.engine.Where("is_deleted = ? AND is_enabled = ? AND iss = ? AND sub = ?", false, true, iss, sub).Get(&result)
+	if err != nil || !ok {
+		return nil, false
+	}
+
+	// save result to cache.
+	u.cache.set(userCacheByIdentity, identity, version, &result)
+
+	return &result, true
+}
+
+// LinkSub links the subject of the issuer to an existing user who has the verified email but no subject yet.
+// Unverified users are never linked, since anyone can sign up with the email.
+func (u *Users) LinkSub(email string, iss string, sub string) (user *model.User, ok bool) {
+	var result model.User
+	found, err := u.engine.Where(
+		`
+		is_deleted = ?
+		AND is_enabled = ?
+		AND email = ?
+		AND email_verified = ?
+		AND sub IS NULL
+		`, false, true, email, true).Desc("id").Get(&result)
+	if err != nil || !found {
+		return nil, false
+	}
+
+	linked := model.User{}
+	linked.Iss = &iss
+	linked.Sub = &sub
+	// "sub IS NULL" prevents concurrent requests from linking twice.
+	affected, err := u.engine.ID(result.ID).Where("sub IS NULL").Update(&linked)
+	if err != nil || affected == 0 {
+		return nil, false
 	}
+	result.Iss = &iss
+	result.Sub = &sub
+	u.cache.invalidateUser(&result)
 
 	return &result, true
 }
@@ -81,6 +135,7 @@ func (u *Users) Create(email string, profile *model.UserProfile) (*model.UserPub
 	user.Common.SetDefault()
 	user.Email = email
 	user.EmailVerified = ptr.Bool(false)
+	user.Role = model.RoleUser
 	user.DisplayName = profile.DisplayName
 	user.About = profile.About
 	user.AvatarURL = profile.AvatarURL
@@ -119,6 +174,7 @@ func (u *Users) Create(email string, profile *model.UserProfile) (*model.UserPub
 	if err != nil {
 		return nil, err
 	}
+	u.cache.invalidate(userCacheByEmail, email)
 
 	return user.GetPublicData(), nil
 }
@@ -135,10 +191,66 @@ func (u *Users) Verify(userID uint64) error {
 	if err != nil {
 		return err
 	}
+	u.cache.invalidateByID(u.engine, userID)
 
 	return nil
 }
 
+// MarkVerificationSent records that a verification email is sent at sentAt.
+// It returns false when the previous one was sent within the interval.
+func (u *Users) MarkVerificationSent(userID uint64, sentAt time.Time, interval time.Duration) (ok bool, err error) {
+	user := model.User{}
+	user.VerificationSentAt = &sentAt
+	affected, err := u.engine.ID(userID).Where(
+		`
+		is_deleted = ?
+		AND (verification_sent_at IS NULL OR verification_sent_at <= ?)
+		`, false, sentAt.Add(-interval)).Update(&user)
+	if err != nil {
+		return false, err
+	}
+	if affected > 0 {
+		u.cache.invalidateByID(u.engine, userID)
+	}
+
+	return affected > 0, nil
+}
+
+// UnmarkVerificationSent clears the time marked by MarkVerificationSent,
+// so that the user can request again right after sending failed.
+func (u *Users) UnmarkVerificationSent(userID uint64, sentAt time.Time) error {
+	affected, err := u.engine.ID(userID).Where("verification_sent_at = ?", sentAt).
+		Cols("verification_sent_at").Update(&model.User{})
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		u.cache.invalidateByID(u.engine, userID)
+	}
+	return nil
+}
+
+// ConsumeVerification updates user as verified by the verification email sent at sentAt.
+// It returns false unless the email is the latest one, and clears the time so that it is used only once.
+func (u *Users) ConsumeVerification(userID uint64, sentAt time.Time) (ok bool, err error) {
+	user := model.User{}
+	user.EmailVerified = ptr.Bool(true)
+	affected, err := u.engine.ID(userID).Where(
+		`
+		is_deleted = ?
+		AND is_enabled = ?
+		AND verification_sent_at = ?
+		`, false, true, sentAt).Cols("email_verified", "verification_sent_at").Update(&user)
+	if err != nil {
+		return false, err
+	}
+	if affected > 0 {
+		u.cache.invalidateByID(u.engine, userID)
+	}
+
+	return affected > 0, nil
+}
+
 // Update updates user's profile data.
 func (u *Users) Update(id uint64, profile *model.UserProfile) (*model.UserPublicData, error) {
 	if profile == nil {
@@ -151,6 +263,7 @@ func (u *Users) Update(id uint64, profile *model.UserProfile) (*model.UserPublic
 	if err != nil {
 		return nil, err
 	}
+	u.cache.invalidateByID(u.engine, id)
 
 	var updated model.User
 	_, err = u.engine.ID(id).Get(&updated)
@@ -170,6 +283,7 @@ func (u *Users) Delete(id uint64) error {
 	if err != nil {
 		return err
 	}
+	u.cache.invalidateByID(u.engine, id)
 
 	return nil
 }
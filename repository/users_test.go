@@ -2,10 +2,13 @@ package repository_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/itomofumi/go-gin-xorm-starter/model"
 	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/ptr"
 	"github.com/stretchr/testify/assert"
+	"xorm.io/xorm"
 )
 
 func TestUsers_GetByEmail(t *testing.T) {
@@ -119,3 +122,197 @@ func TestUsers_Delete(t *testing.T) {
 		t.Fatalf("Users.Delete() could not delete user by email = %s", email)
 	}
 }
+
+func TestUsers_MarkVerificationSent(t *testing.T) {
+	engine, cleanup := setupDB(t)
+	defer cleanup()
+
+	users := repository.NewUsers(engine, NewKVSClientMock())
+
+	var id uint64 = 1
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.Local)
+	interval := time.Minute
+
+	assert := assert.New(t)
+	ok, err := users.MarkVerificationSent(id, now, interval)
+	assert.NoError(err)
+	assert.True(ok, "first sending should not be throttled")
+
+	ok, err = users.MarkVerificationSent(id, now.Add(time.Second*30), interval)
+	assert.NoError(err)
+	assert.False(ok, "sending within the interval should be throttled")
+
+	ok, err = users.MarkVerificationSent(id, now.Add(interval), interval)
+	assert.NoError(err)
+	assert.True(ok, "sending after the interval should not be throttled")
+
+	// failed to send
+	assert.NoError(users.UnmarkVerificationSent(id, now.Add(interval)))
+	ok, err = users.MarkVerificationSent(id, now.Add(interval+time.Second), interval)
+	assert.NoError(err)
+	assert.True(ok, "sending after the failure should not be throttled")
+}
+
+func TestUsers_ConsumeVerification(t *testing.T) {
+	engine, cleanup := setupDB(t)
+	defer cleanup()
+
+	users := repository.NewUsers(engine, NewKVSClientMock())
+
+	var id uint64 = 1
+	first := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.Local)
+	latest := first.Add(time.Hour)
+
+	assert := assert.New(t)
+	for _, sentAt := range []time.Time{first, latest} {
+		ok, err := users.MarkVerificationSent(id, sentAt, time.Minute)
+		assert.NoError(err)
+		assert.True(ok)
+	}
+
+	ok, err := users.ConsumeVerification(id, first)
+	assert.NoError(err)
+	assert.False(ok, "an older email should not verify the user")
+
+	ok, err = users.ConsumeVerification(id, latest)
+	assert.NoError(err)
+	assert.True(ok, "the latest email should verify the user")
+	user, _ := users.GetByID(id)
+	assert.True(*user.EmailVerified)
+	assert.Nil(user.VerificationSentAt)
+
+	ok, err = users.ConsumeVerification(id, latest)
+	assert.NoError(err)
+	assert.False(ok, "the email should be used only once")
+}
+
+func TestUsers_CacheInvalidation(t *testing.T) {
+	var id uint64 = 1
+	email := "test@example.com"
+	cachedKey := "users/emails/test@example.com/v1"
+
+	tests := []struct {
+		name  string
+		write func(t *testing.T, engine *xorm.Engine, kvs *KVSClientMock) error
+		check func(assert *assert.Assertions, user *model.User, ok bool)
+	}{
+		{"Verify",
+			func(t *testing.T, engine *xorm.Engine, kvs *KVSClientMock) error {
+				_, err := engine.Exec("UPDATE users SET email_verified = ? WHERE id = ?", false, id)
+				if err != nil {
+					return err
+				}
+				return repository.NewUsers(engine, kvs).Verify(id)
+			},
+			func(assert *assert.Assertions, user *model.User, ok bool) {
+				assert.True(ok)
+				assert.True(*user.EmailVerified)
+			},
+		},
+		{"Update",
+			func(t *testing.T, engine *xorm.Engine, kvs *KVSClientMock) error {
+				_, err := repository.NewUsers(engine, kvs).Update(id, &model.UserProfile{DisplayName: ptr.String("updated")})
+				return err
+			},
+			func(assert *assert.Assertions, user *model.User, ok bool) {
+				assert.True(ok)
+				assert.Equal("updated", *user.DisplayName)
+			},
+		},
+		{"Delete",
+			func(t *testing.T, engine *xorm.Engine, kvs *KVSClientMock) error {
+				return repository.NewUsers(engine, kvs).Delete(id)
+			},
+			func(assert *assert.Assertions, user *model.User, ok bool) {
+				assert.False(ok)
+			},
+		},
+		{"MarkVerificationSent",
+			func(t *testing.T, engine *xorm.Engine, kvs *KVSClientMock) error {
+				_, err := repository.NewUsers(engine, kvs).MarkVerificationSent(id, time.Now(), time.Minute)
+				return err
+			},
+			func(assert *assert.Assertions, user *model.User, ok bool) {
+				assert.True(ok)
+				assert.NotNil(user.VerificationSentAt)
+			},
+		},
+		{"Login",
+			func(t *testing.T, engine *xorm.Engine, kvs *KVSClientMock) error {
+				_, err := repository.NewLogins(engine, kvs).Record(&model.Login{UserID: id, SessionID: "jti:aaa"}, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.Local))
+				return err
+			},
+			func(assert *assert.Assertions, user *model.User, ok bool) {
+				assert.True(ok)
+				assert.Equal(2020, user.LastLoginAt.Year())
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, cleanup := setupDB(t)
+			defer cleanup()
+
+			kvs := NewKVSClientMock()
+			users := repository.NewUsers(engine, kvs)
+
+			assert := assert.New(t)
+			_, ok := users.GetByEmail(email)
+			if !ok || !kvs.Cached(cachedKey) {
+				t.Fatalf("Users.GetByEmail() should cache the user as %v", cachedKey)
+			}
+
+			if err := tt.write(t, engine, kvs); err != nil {
+				t.Fatal(err)
+			}
+			assert.True(kvs.Deleted(cachedKey), "cache should be deleted")
+
+			user, ok := users.GetByEmail(email)
+			tt.check(assert, user, ok)
+		})
+	}
+}
+
+func TestUsers_LinkSub(t *testing.T) {
+	engine, cleanup := setupDB(t)
+	defer cleanup()
+
+	kvs := NewKVSClientMock()
+	users := repository.NewUsers(engine, kvs)
+
+	email := "test@example.com"
+	iss := "https://idp.example.com"
+	sub := "3f1e0c9a-0000-4000-8000-000000000001"
+
+	assert := assert.New(t)
+	_, ok := users.GetBySub(iss, sub)
+	assert.False(ok, "sub should not be linked yet")
+
+	linked, ok := users.LinkSub(email, iss, sub)
+	if !ok {
+		t.Fatalf("Users.LinkSub() failed")
+	}
+	assert.Equal(iss, *linked.Iss)
+	assert.Equal(sub, *linked.Sub)
+
+	// already linked.
+	_, ok = users.LinkSub(email, iss, "another-sub")
+	assert.False(ok)
+
+	// unverified users can't be linked.
+	if _, err := users.Create("unverified@example.com", &model.UserProfile{}); err != nil {
+		t.Fatal(err)
+	}
+	_, ok = users.LinkSub("unverified@example.com", iss, "unverified-sub")
+	assert.False(ok)
+
+	got, ok := users.GetBySub(iss, sub)
+	if assert.True(ok) {
+		assert.Equal(linked.ID, got.ID)
+		assert.Equal(email, got.Email)
+	}
+
+	// the same sub of another issuer is another identity.
+	_, ok = users.GetBySub("https://other.example.com", sub)
+	assert.False(ok)
+}
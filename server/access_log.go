@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	accessLogFormatEnv     = "ACCESS_LOG_FORMAT"
+	accessLogSkipPathsEnv  = "ACCESS_LOG_SKIP_PATHS"
+	accessLogSampleRateEnv = "ACCESS_LOG_SAMPLE_RATE"
+)
+
+// access log formats.
+const (
+	// AccessLogFormatText is the default text format of logrus.
+	AccessLogFormatText = "text"
+	// AccessLogFormatJSON is a JSON object per line.
+	AccessLogFormatJSON = "json"
+	// AccessLogFormatLogfmt is key=value pairs per line.
+	AccessLogFormatLogfmt = "logfmt"
+	// AccessLogFormatCombined is Apache Combined Log Format.
+	AccessLogFormatCombined = "combined"
+)
+
+// AccessLogConfig is what LogMiddleware writes.
+type AccessLogConfig struct {
+	Format string
+	// TimeFormat is a time package format string (e.g. time.RFC3339).
+	TimeFormat string
+	UTC        bool
+	// SkipPaths are not logged, e.g. health checks.
+	SkipPaths []string
+	// SampleRate is the ratio of successful requests to log. Errors are always logged.
+	SampleRate float64
+}
+
+// DefaultAccessLogConfig returns AccessLogConfig used by Start.
+func DefaultAccessLogConfig() *AccessLogConfig {
+	return &AccessLogConfig{
+		Format:     AccessLogFormatText,
+		TimeFormat: time.RFC3339,
+		SkipPaths:  []string{"/", LivenessPath, ReadinessPath, MetricsPath},
+		SampleRate: 1,
+	}
+}
+
+// LoadAccessLogConfigEnv loads DefaultAccessLogConfig overridden by Environment Variables.
+// ACCESS_LOG_SKIP_PATHS are comma separated, and "none" logs all paths.
+func LoadAccessLogConfigEnv() (*AccessLogConfig, error) {
+	conf := DefaultAccessLogConfig()
+	if v := os.Getenv(accessLogFormatEnv); v != "" {
+		conf.Format = strings.ToLower(v)
+	}
+	if _, err := conf.Formatter(); err != nil {
+		return nil, err
+	}
+	if v := os.Getenv(accessLogSkipPathsEnv); v != "" {
+		conf.SkipPaths = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" && p != "none" {
+				conf.SkipPaths = append(conf.SkipPaths, p)
+			}
+		}
+	}
+	if v := os.Getenv(accessLogSampleRateEnv); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("%v expects a ratio from 0 to 1, but %v was given", accessLogSampleRateEnv, v)
+		}
+		conf.SampleRate = rate
+	}
+	return conf, nil
+}
+
+// Formatter returns the logrus formatter of Format.
+func (conf *AccessLogConfig) Formatter() (logrus.Formatter, error) {
+	switch conf.Format {
+	case AccessLogFormatText:
+		return &logrus.TextFormatter{}, nil
+	case AccessLogFormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	case AccessLogFormatLogfmt:
+		return &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}, nil
+	case AccessLogFormatCombined:
+		return &CombinedLogFormatter{}, nil
+	}
+	return nil, fmt.Errorf("%v expects %v, %v, %v or %v, but %v was given", accessLogFormatEnv,
+		AccessLogFormatText, AccessLogFormatJSON, AccessLogFormatLogfmt, AccessLogFormatCombined, conf.Format)
+}
+
+// CombinedLogFormatter formats access logs of LogMiddleware in Apache Combined Log Format:
+//
+//	127.0.0.1 - 3 [10/Nov/2009:23:00:00 +0000] "GET /v1/me HTTP/1.1" 200 512 "-" "curl/7.64.1"
+//
+// The user is the authenticated user ID.
+type CombinedLogFormatter struct{}
+
+// Format implements logrus.Formatter.
+func (f *CombinedLogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	field := func(key string) string {
+		v, ok := entry.Data[key]
+		if !ok || v == nil || fmt.Sprint(v) == "" {
+			return "-"
+		}
+		return fmt.Sprint(v)
+	}
+	quoted := func(key string) string {
+		v := field(key)
+		if v == "-" {
+			return `"-"`
+		}
+		return strconv.Quote(v)
+	}
+
+	target := field("path")
+	if query := field("query"); query != "-" {
+		target += "?" + query
+	}
+	size := field("size")
+	if size == "0" {
+		size = "-"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s - %s [%s] %s %s %s %s %s\n",
+		field("ip"), field("user_id"), entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(fmt.Sprintf("%s %s %s", field("method"), target, field("proto"))),
+		field("status"), size, quoted("referer"), quoted("user-agent"))
+	return b.Bytes(), nil
+}
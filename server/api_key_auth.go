@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/factory"
+)
+
+// APIKeyHeader is a request header for API keys.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyAuthHandler authenticates the request by API key
+// and sets the same context as JWT authentication.
+func apiKeyAuthHandler(c *gin.Context, token string) error {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	apiKey, user, err := factory.NewAPIKeys().Authenticate(token)
+	if err != nil {
+		return err
+	}
+
+	iss, sub := "", ""
+	if user.Iss != nil {
+		iss = *user.Iss
+	}
+	if user.Sub != nil {
+		sub = *user.Sub
+	}
+
+	// set user information to Gin's context.
+	c.Set("email", user.Email)
+	c.Set("iss", iss)
+	c.Set("sub", sub)
+	c.Set("user", user)
+	c.Set("api_key", apiKey)
+	c.Set(scopesContextKey, apiKey.Scopes)
+	c.Set("session_id", fmt.Sprintf("api_key:%d", apiKey.ID))
+	c.Set(authMethodContextKey, AuthMethodAPIKey)
+
+	return nil
+}
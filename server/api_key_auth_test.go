@@ -0,0 +1,107 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+// authenticatorMock rejects all JWT.
+type authenticatorMock struct{}
+
+func (authenticatorMock) ValidateToken(token string) (*jwt.Token, error) {
+	return nil, service.ErrInvalidAPIKey
+}
+
+// apiKeysMock accepts "valid" API key only.
+type apiKeysMock struct {
+	service.APIKeysInterface
+}
+
+func (apiKeysMock) Authenticate(token string) (*model.APIKey, *model.User, error) {
+	if token != "valid" {
+		return nil, nil, service.ErrInvalidAPIKey
+	}
+	key := &model.APIKey{ID: 7, UserID: 1, Scopes: []string{"fruits:write"}}
+	user := &model.User{Common: model.Common{ID: 1}, Iss: ptr.String("https://idp.example.com"), Sub: ptr.String("sub-1"), Email: "foo@example.com"}
+	return key, user, nil
+}
+
+func TestAuthMiddleware_APIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		wantStatus int
+	}{
+		{"valid API key", "valid", http.StatusOK},
+		{"invalid API key", "invalid", http.StatusUnauthorized},
+		{"no credentials", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctx *gin.Context
+			r := gin.New()
+			r.Use(server.ServiceKeyMiddleware(&serviceFactoryMock{apiKeys: apiKeysMock{}}))
+			r.Use(server.SetAuth(authenticatorMock{}, server.DefaultClaimMapping()))
+			r.GET("/", server.AuthMiddleware(), func(c *gin.Context) {
+				ctx = c
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tt.apiKey != "" {
+				req.Header.Set(server.APIKeyHeader, tt.apiKey)
+			}
+			r.ServeHTTP(w, req)
+
+			assert := assert.New(t)
+			assert.Equal(tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusOK {
+				assert.Nil(ctx)
+				return
+			}
+			assert.Equal("foo@example.com", ctx.GetString("email"))
+			assert.Equal("https://idp.example.com", ctx.GetString("iss"))
+			assert.Equal("sub-1", ctx.GetString("sub"))
+			assert.Equal(uint64(1), ctx.MustGet("user").(*model.User).ID)
+			assert.Equal([]string{"fruits:write"}, ctx.GetStringSlice("scopes"))
+			assert.Equal("api_key:7", ctx.GetString("session_id"))
+			assert.Equal(server.AuthMethodAPIKey, ctx.GetString("auth_method"))
+		})
+	}
+}
+
+func TestRequireAuthMethod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		method     string
+		wantStatus int
+	}{
+		{server.AuthMethodJWT, http.StatusOK},
+		{server.AuthMethodAPIKey, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				c.Set("auth_method", tt.method)
+			}, server.RequireAuthMethod(server.AuthMethodJWT), func(c *gin.Context) {})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -1,54 +1,64 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/itomofumi/go-gin-xorm-starter/factory"
 	"github.com/itomofumi/go-gin-xorm-starter/model"
 	"github.com/itomofumi/go-gin-xorm-starter/util"
-	"github.com/itomofumi/gognito/auth"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
 var authContextKey = "auth"
+var claimMappingContextKey = "auth_claim_mapping"
+var authMethodContextKey = "auth_method"
 
-// SetAuth passes an authenticator.
-func SetAuth(authenticator auth.Authenticator) gin.HandlerFunc {
+// authentication methods.
+const (
+	// AuthMethodJWT is Bearer JWT authentication.
+	AuthMethodJWT = "jwt"
+	// AuthMethodAPIKey is X-API-Key authentication.
+	AuthMethodAPIKey = "api_key"
+)
+
+// SetAuth passes an authenticator and JWT claims mapping.
+func SetAuth(authenticator Authenticator, mapping *ClaimMapping) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set(authContextKey, authenticator)
+		c.Set(claimMappingContextKey, mapping)
 		c.Next()
 	}
 }
 
-// AuthMiddleware verifies JWT with authenticator.
+// AuthMiddleware verifies JWT with authenticator, API key or session cookie.
 func AuthMiddleware() gin.HandlerFunc {
-	logger := util.GetLogger()
 	return func(c *gin.Context) {
-		authenticator := c.MustGet(authContextKey).(auth.Authenticator)
+		authenticator := c.MustGet(authContextKey).(Authenticator)
 		err := authHandler(c, authenticator)
 		if err != nil {
-			er := model.NewErrorResponse("401", model.ErrorAuth, err.Error())
-			logger.Debugln(er)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, er)
+			abortAuth(c, err)
 		}
 		c.Next()
 	}
 }
 
-// OptionalAuthMiddleware does optional JWT verification.
+// OptionalAuthMiddleware does optional JWT, API key or session cookie verification.
 func OptionalAuthMiddleware() gin.HandlerFunc {
-	logger := util.GetLogger()
 	return func(c *gin.Context) {
-		if _, ok := GetBearer(c.Request.Header["Authorization"]); ok {
-			authenticator := c.MustGet(authContextKey).(auth.Authenticator)
+		_, hasBearer := GetBearer(c.Request.Header["Authorization"])
+		_, _, hasCookie := getSessionCookie(c)
+		if hasBearer || hasCookie || c.GetHeader(APIKeyHeader) != "" {
+			authenticator := c.MustGet(authContextKey).(Authenticator)
 			err := authHandler(c, authenticator)
 			if err != nil {
-				er := model.NewErrorResponse("401", model.ErrorAuth, err.Error())
-				logger.Debugln(er)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, er)
+				abortAuth(c, err)
 			}
 		} else {
 			c.Next()
@@ -56,40 +66,94 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-func authHandler(c *gin.Context, authenticator auth.Authenticator) error {
+// abortAuth responds 403 for CSRF errors, and 401 for the others.
+func abortAuth(c *gin.Context, err error) {
+	status := http.StatusUnauthorized
+	if errors.Is(err, ErrCSRFToken) {
+		status = http.StatusForbidden
+	}
+	er := model.NewErrorResponse(strconv.Itoa(status), model.ErrorAuth, err.Error())
+	util.GetLogger().Debugln(er)
+	c.AbortWithStatusJSON(status, er)
+}
+
+func authHandler(c *gin.Context, authenticator Authenticator) error {
+	if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" {
+		return apiKeyAuthHandler(c, apiKey)
+	}
+
 	tokenString, ok := GetBearer(c.Request.Header["Authorization"])
 
 	if !ok {
-		return fmt.Errorf("Bearer token was not found in Authorization header")
+		if conf, id, ok := getSessionCookie(c); ok {
+			return cookieAuthHandler(c, conf, id)
+		}
+		return fmt.Errorf("Bearer token was not found in Authorization header nor %v header", APIKeyHeader)
 	}
 
-	authedUser, err := authenticateUser(tokenString, authenticator)
+	mapping := c.MustGet(claimMappingContextKey).(*ClaimMapping)
+	authedUser, err := authenticateUser(tokenString, authenticator, mapping)
 	if err != nil {
 		return err
 	}
+	claims := authedUser.Token.Claims.(jwt.MapClaims)
+	issuedAt, _ := numericDate(claims["iat"])
+	if err := checkRevocation(c, authedUser.Issuer, authedUser.Sub, GetRevocationIDs(claims), issuedAt); err != nil {
+		return err
+	}
 	// set user information to Gin's context.
 	c.Set("email", authedUser.Email)
+	c.Set("email_verified", authedUser.EmailVerified)
+	c.Set("iss", authedUser.Issuer)
 	c.Set("sub", authedUser.Sub)
+	c.Set("display_name", authedUser.DisplayName)
 	c.Set("token", authedUser.Token)
+	c.Set("session_id", authedUser.SessionID)
+	if authedUser.Scopes != nil {
+		c.Set(scopesContextKey, authedUser.Scopes)
+	}
+	c.Set(authMethodContextKey, AuthMethodJWT)
 
 	return nil
 }
 
+// RequireAuthMethod rejects requests authenticated by other methods.
+func RequireAuthMethod(methods ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.GetString(authMethodContextKey)
+		for _, m := range methods {
+			if m == method {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, model.NewErrorResponse("403", model.ErrorAuth,
+			fmt.Sprintf("%v authentication is not allowed. use %v", method, strings.Join(methods, " or "))))
+	}
+}
+
 // AuthenticatedUser verified user information
 type AuthenticatedUser struct {
 	Email string
-	Sub   string
-	Token *jwt.Token
+	// EmailVerified is true when the identity provider verified the email.
+	EmailVerified bool
+	// Issuer and Sub identify the user. Sub is unique only within the issuer.
+	Issuer      string
+	Sub         string
+	DisplayName string
+	SessionID   string
+	// Scopes is nil when the token has no scope claim.
+	Scopes []string
+	Token  *jwt.Token
 }
 
 // authenticateUser performs authentication to the given JWT token.
-func authenticateUser(tokenString string, authenticator auth.Authenticator) (*AuthenticatedUser, error) {
+func authenticateUser(tokenString string, authenticator Authenticator, mapping *ClaimMapping) (*AuthenticatedUser, error) {
 	token, err := authenticator.ValidateToken(tokenString)
 	if err != nil {
-		return nil, fmt.Errorf("token is not valid. [Reason] %v", err)
+		return nil, fmt.Errorf("token is not valid. [Reason] %w", err)
 	}
 
-	// "token == nil" may happen when 'NoVerification Mode' is enabled.
 	if token == nil || token.Claims == nil {
 		return nil, fmt.Errorf("wrong format token")
 	}
@@ -99,21 +163,98 @@ func authenticateUser(tokenString string, authenticator auth.Authenticator) (*Au
 	if !ok {
 		return nil, fmt.Errorf("wrong format token")
 	}
-	email, ok := claims["email"].(string)
-	if !ok {
-		return nil, fmt.Errorf("token must contain email")
+	authedUser, err := MapClaims(claims, mapping)
+	if err != nil {
+		return nil, err
 	}
-	sub := claims["sub"].(string)
+	authedUser.Token = token
 
-	authedUser := AuthenticatedUser{
-		Email: email,
-		Sub:   sub,
-		Token: token,
+	return authedUser, nil
+}
+
+// MapClaims maps JWT claims to AuthenticatedUser.
+// The identity claim is required. Email and display name are optional.
+func MapClaims(claims jwt.MapClaims, mapping *ClaimMapping) (*AuthenticatedUser, error) {
+	sub, ok := claims[mapping.Identity].(string)
+	if !ok || sub == "" {
+		return nil, fmt.Errorf("token must contain %v", mapping.Identity)
 	}
+	issuer, _ := claims["iss"].(string)
+	email, _ := claims[mapping.Email].(string)
+	displayName, _ := claims[mapping.DisplayName].(string)
+
+	scopes, _ := GetScopes(claims)
 
+	authedUser := AuthenticatedUser{
+		Email:         email,
+		EmailVerified: isTrueClaim(claims[mapping.EmailVerified]),
+		Issuer:        issuer,
+		Sub:           sub,
+		DisplayName:   displayName,
+		SessionID:     GetSessionID(claims),
+		Scopes:        scopes,
+	}
 	return &authedUser, nil
 }
 
+// isTrueClaim returns true for boolean true, or "true" string sent by some providers like Amazon Cognito.
+func isTrueClaim(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// GetSessionID identifies the login session of the token by "origin_jti", "jti" or "iat" claim.
+// Tokens refreshed by the same refresh token share "origin_jti".
+// It returns empty string if the token has none of them.
+func GetSessionID(claims jwt.MapClaims) string {
+	if originJTI, ok := claims["origin_jti"].(string); ok && originJTI != "" {
+		return "origin_jti:" + originJTI
+	}
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		return "jti:" + jti
+	}
+	if iat, ok := claims["iat"].(float64); ok {
+		return "iat:" + strconv.FormatInt(int64(iat), 10)
+	}
+	return ""
+}
+
+// checkRevocation rejects the token when its session has been revoked.
+func checkRevocation(c *gin.Context, iss string, sub string, revocationIDs []string, issuedAt time.Time) error {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	revoked, err := factory.NewSessions().IsRevoked(iss, sub, revocationIDs, issuedAt)
+	if err != nil {
+		return fmt.Errorf("cannot check token revocation: %v", err)
+	}
+	if revoked {
+		return fmt.Errorf("token is not valid. [Reason] %w", ErrTokenRevoked)
+	}
+	return nil
+}
+
+// GetRevocationIDs returns ids of the token looked up in the revocation list.
+// Both the token itself ("jti") and its login session ("origin_jti") can be revoked.
+func GetRevocationIDs(claims jwt.MapClaims) []string {
+	ids := make([]string, 0, 2)
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		ids = append(ids, "jti:"+jti)
+	}
+	if originJTI, ok := claims["origin_jti"].(string); ok && originJTI != "" {
+		ids = append(ids, "origin_jti:"+originJTI)
+	}
+	if len(ids) == 0 {
+		if sessionID := GetSessionID(claims); sessionID != "" {
+			ids = append(ids, sessionID)
+		}
+	}
+	return ids
+}
+
 // GetBearer gets a bearer token from Authorization header
 func GetBearer(auth []string) (jwt string, ok bool) {
 	for _, v := range auth {
@@ -1,8 +1,23 @@
 package server_test
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
 	"github.com/itomofumi/go-gin-xorm-starter/server"
 )
 
@@ -34,3 +49,173 @@ func TestGetBearer(t *testing.T) {
 		})
 	}
 }
+
+func TestGetSessionID(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   string
+	}{
+		{"origin_jti", jwt.MapClaims{"origin_jti": "xyz", "jti": "abc", "iat": float64(1516239022)}, "origin_jti:xyz"},
+		{"jti", jwt.MapClaims{"jti": "abc", "iat": float64(1516239022)}, "jti:abc"},
+		{"iat", jwt.MapClaims{"iat": float64(1516239022)}, "iat:1516239022"},
+		{"none", jwt.MapClaims{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := server.GetSessionID(tt.claims); got != tt.want {
+				t.Errorf("GetSessionID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRevocationIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   []string
+	}{
+		{"jti and origin_jti", jwt.MapClaims{"origin_jti": "xyz", "jti": "abc", "iat": float64(1516239022)}, []string{"jti:abc", "origin_jti:xyz"}},
+		{"jti", jwt.MapClaims{"jti": "abc"}, []string{"jti:abc"}},
+		{"iat", jwt.MapClaims{"iat": float64(1516239022)}, []string{"iat:1516239022"}},
+		{"none", jwt.MapClaims{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, server.GetRevocationIDs(tt.claims))
+		})
+	}
+}
+
+func TestMapClaims(t *testing.T) {
+	custom := &server.ClaimMapping{Identity: "uid", Email: "mail", EmailVerified: "mail_verified", DisplayName: "nickname"}
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		mapping *server.ClaimMapping
+		want    *server.AuthenticatedUser
+		wantErr bool
+	}{
+		{"default mapping",
+			jwt.MapClaims{"iss": "https://idp.example.com", "sub": "abc", "email": "foo@example.com", "email_verified": true, "name": "foo"},
+			server.DefaultClaimMapping(),
+			&server.AuthenticatedUser{Issuer: "https://idp.example.com", Sub: "abc", Email: "foo@example.com", EmailVerified: true, DisplayName: "foo"},
+			false,
+		},
+		{"email_verified in string",
+			jwt.MapClaims{"sub": "abc", "email": "foo@example.com", "email_verified": "true"},
+			server.DefaultClaimMapping(),
+			&server.AuthenticatedUser{Sub: "abc", Email: "foo@example.com", EmailVerified: true},
+			false,
+		},
+		{"unverified email",
+			jwt.MapClaims{"sub": "abc", "email": "foo@example.com", "email_verified": "false"},
+			server.DefaultClaimMapping(),
+			&server.AuthenticatedUser{Sub: "abc", Email: "foo@example.com"},
+			false,
+		},
+		{"email is optional",
+			jwt.MapClaims{"sub": "abc"},
+			server.DefaultClaimMapping(),
+			&server.AuthenticatedUser{Sub: "abc"},
+			false,
+		},
+		{"access token",
+			jwt.MapClaims{"sub": "abc", "scope": "openid fruits:write"},
+			server.DefaultClaimMapping(),
+			&server.AuthenticatedUser{Sub: "abc", Scopes: []string{"openid", "fruits:write"}},
+			false,
+		},
+		{"custom mapping",
+			jwt.MapClaims{"sub": "ignored", "uid": "u-1", "mail": "foo@example.com", "mail_verified": true, "nickname": "foo"},
+			custom,
+			&server.AuthenticatedUser{Sub: "u-1", Email: "foo@example.com", EmailVerified: true, DisplayName: "foo"},
+			false,
+		},
+		{"missing identity",
+			jwt.MapClaims{"email": "foo@example.com"},
+			server.DefaultClaimMapping(),
+			nil,
+			true,
+		},
+		{"identity is not string",
+			jwt.MapClaims{"sub": 123},
+			server.DefaultClaimMapping(),
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := server.MapClaims(tt.claims, tt.mapping)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MapClaims() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MapClaims() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_ErrorMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "jwks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	const issuer = "https://issuer.example.com"
+	authenticator, err := server.NewOIDCAuthenticator(&server.OIDCIssuerConfig{
+		Issuer:   issuer,
+		JWKSFile: writeJWKS(t, dir, map[string]interface{}{"k": &key.PublicKey}),
+		Audience: []string{"client-1"},
+		TokenUse: []string{"id"},
+	})
+	require.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name        string
+		claims      jwt.MapClaims
+		wantStatus  int
+		wantMessage error
+	}{
+		{"valid", jwt.MapClaims{"iss": issuer, "sub": "abc", "aud": "client-1", "token_use": "id", "exp": exp}, http.StatusOK, nil},
+		{"expired", jwt.MapClaims{"iss": issuer, "sub": "abc", "aud": "client-1", "token_use": "id", "exp": time.Now().Add(-time.Hour).Unix()}, http.StatusUnauthorized, server.ErrTokenExpired},
+		{"wrong audience", jwt.MapClaims{"iss": issuer, "sub": "abc", "aud": "client-2", "token_use": "id", "exp": exp}, http.StatusUnauthorized, server.ErrTokenAudience},
+		{"access token", jwt.MapClaims{"iss": issuer, "sub": "abc", "client_id": "client-1", "token_use": "access", "exp": exp}, http.StatusUnauthorized, server.ErrTokenUse},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://other.example.com", "sub": "abc", "aud": "client-1", "token_use": "id", "exp": exp}, http.StatusUnauthorized, server.ErrTokenIssuer},
+		{"revoked session", jwt.MapClaims{"iss": issuer, "sub": "abc", "aud": "client-1", "token_use": "id", "exp": exp, "jti": "new", "origin_jti": "revoked"}, http.StatusUnauthorized, server.ErrTokenRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(server.ServiceKeyMiddleware(&serviceFactoryMock{
+				sessions: sessionsMock{revoked: map[string]bool{"origin_jti:revoked": true}},
+			}))
+			r.Use(server.SetAuth(authenticator, server.DefaultClaimMapping()))
+			r.GET("/", server.AuthMiddleware(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+signToken(t, jwt.SigningMethodRS256, "k", key, tt.claims))
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantMessage == nil {
+				return
+			}
+			var res model.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			require.Len(t, res.Errors, 1)
+			assert.Equal(t, model.ErrorAuth, res.Errors[0].Type)
+			assert.Contains(t, res.Errors[0].Messages[0], tt.wantMessage.Error())
+		})
+	}
+}
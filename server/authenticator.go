@@ -0,0 +1,304 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"github.com/itomofumi/gognito/auth"
+)
+
+const (
+	oidcIssuersEnv     = "OIDC_ISSUERS"
+	oidcIssuersFileEnv = "OIDC_ISSUERS_FILE"
+	// comma separated "id" and/or "access".
+	cognitoTokenUseEnv    = "COGNITO_TOKEN_USE"
+	cognitoAppClientIDEnv = "COGNITO_APP_CLIENT_ID"
+)
+
+// Authenticator validates JWT. gognito's auth.Authenticator satisfies it.
+type Authenticator interface {
+	ValidateToken(tokenString string) (*jwt.Token, error)
+}
+
+// OIDCIssuerConfig is a trusted token issuer.
+// When neither JWKSURL nor JWKSFile is given, JWKS URL is discovered
+// from "<Issuer>/.well-known/openid-configuration".
+type OIDCIssuerConfig struct {
+	Issuer   string `json:"issuer"`
+	JWKSURL  string `json:"jwks_url,omitempty"`
+	JWKSFile string `json:"jwks_file,omitempty"`
+	// Audience allows tokens whose "aud" or "client_id" is one of them. Empty allows any audience,
+	// so it is required for issuers loaded by LoadOIDCIssuersEnv.
+	Audience []string `json:"audience,omitempty"`
+	// TokenUse allows tokens whose "token_use" is one of them, e.g. "id" or "access". (default: any)
+	TokenUse []string `json:"token_use,omitempty"`
+	// Leeway is allowed clock skew for "exp", "nbf" and "iat".
+	Leeway time.Duration `json:"-"`
+}
+
+// OIDCAuthenticator validates JWT signed by a key of the issuer's JWKS.
+type OIDCAuthenticator struct {
+	validator *claimValidator
+	keys      *keySet
+}
+
+// NewOIDCAuthenticator initializes OIDCAuthenticator and loads its JWKS.
+func NewOIDCAuthenticator(conf *OIDCIssuerConfig) (*OIDCAuthenticator, error) {
+	if conf.Issuer == "" {
+		return nil, fmt.Errorf("issuer is required")
+	}
+
+	var load func() (*JWKS, error)
+	switch {
+	case conf.JWKSFile != "":
+		load = func() (*JWKS, error) { return LoadJWKSFile(conf.JWKSFile) }
+	case conf.JWKSURL != "":
+		load = func() (*JWKS, error) { return FetchJWKS(conf.JWKSURL) }
+	default:
+		jwksURL, err := discoverJWKSURL(conf.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		load = func() (*JWKS, error) { return FetchJWKS(jwksURL) }
+	}
+
+	return newOIDCAuthenticator(conf, load)
+}
+
+func newOIDCAuthenticator(conf *OIDCIssuerConfig, load func() (*JWKS, error)) (*OIDCAuthenticator, error) {
+	keys, err := newKeySet(load)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load JWKS of %v: %v", conf.Issuer, err)
+	}
+
+	a := OIDCAuthenticator{
+		validator: &claimValidator{
+			issuer:   conf.Issuer,
+			audience: conf.Audience,
+			tokenUse: conf.TokenUse,
+			leeway:   conf.Leeway,
+		},
+		keys: keys,
+	}
+	return &a, nil
+}
+
+// discoverJWKSURL reads jwks_uri from OpenID Provider Metadata.
+func discoverJWKSURL(issuer string) (string, error) {
+	var metadata struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	err := getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &metadata)
+	if err != nil {
+		return "", fmt.Errorf("OpenID Connect discovery of %v failed: %v", issuer, err)
+	}
+	if metadata.Issuer != issuer {
+		return "", fmt.Errorf("OpenID Connect discovery returned issuer %v, expected %v", metadata.Issuer, issuer)
+	}
+	if metadata.JWKSURI == "" {
+		return "", fmt.Errorf("OpenID Connect discovery of %v has no jwks_uri", issuer)
+	}
+	return metadata.JWKSURI, nil
+}
+
+// ValidateToken verifies the signature and the claims.
+func (a *OIDCAuthenticator) ValidateToken(tokenString string) (*jwt.Token, error) {
+	// claims are validated with leeway by claimValidator.
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenString, a.keyFunc)
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("%w: wrong format claims", ErrTokenMalformed)
+	}
+	if err := a.validator.validate(claims, util.GetTimeNow()); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (a *OIDCAuthenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := a.keys.get(kid)
+	if err != nil {
+		return nil, err
+	}
+	// reject algorithm confusion, e.g. "none" or HS256 signed with the public key.
+	var matched bool
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, matched = key.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		_, matched = key.(*ecdsa.PublicKey)
+	}
+	if !matched {
+		return nil, fmt.Errorf("signing method %v does not match the key of kid: %v", token.Method.Alg(), kid)
+	}
+	return key, nil
+}
+
+// MultiAuthenticator selects an authenticator by "iss" claim of the token.
+type MultiAuthenticator struct {
+	issuers map[string]Authenticator
+}
+
+// NewMultiAuthenticator initializes MultiAuthenticator without issuers.
+func NewMultiAuthenticator() *MultiAuthenticator {
+	return &MultiAuthenticator{issuers: map[string]Authenticator{}}
+}
+
+// Add trusts tokens of the issuer validated by the authenticator.
+func (m *MultiAuthenticator) Add(issuer string, authenticator Authenticator) {
+	m.issuers[issuer] = authenticator
+}
+
+// ValidateToken delegates validation to the authenticator of the token issuer.
+func (m *MultiAuthenticator) ValidateToken(tokenString string) (*jwt.Token, error) {
+	// the signature is verified by the selected authenticator.
+	unverified, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	}
+	iss, _ := unverified.Claims.(jwt.MapClaims)["iss"].(string)
+	authenticator, ok := m.issuers[iss]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrTokenIssuer, iss)
+	}
+	return authenticator.ValidateToken(tokenString)
+}
+
+// LoadOIDCIssuersEnv loads trusted issuers from OIDC_ISSUERS
+// (comma separated "<issuer URL>|<audience>", more audiences are separated by "|")
+// and OIDC_ISSUERS_FILE (JSON array of OIDCIssuerConfig).
+// Every issuer requires its audience, since the issuer signs tokens for its other clients too.
+func LoadOIDCIssuersEnv() ([]*OIDCIssuerConfig, error) {
+	confs := make([]*OIDCIssuerConfig, 0)
+	for _, entry := range splitComma(os.Getenv(oidcIssuersEnv)) {
+		fields := strings.Split(entry, "|")
+		conf := &OIDCIssuerConfig{Issuer: strings.TrimSpace(fields[0])}
+		for _, aud := range fields[1:] {
+			if aud = strings.TrimSpace(aud); aud != "" {
+				conf.Audience = append(conf.Audience, aud)
+			}
+		}
+		confs = append(confs, conf)
+	}
+
+	if filename := os.Getenv(oidcIssuersFileEnv); filename != "" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var fileConfs []*OIDCIssuerConfig
+		if err := json.Unmarshal(b, &fileConfs); err != nil {
+			return nil, fmt.Errorf("cannot parse %v: %v", oidcIssuersFileEnv, err)
+		}
+		confs = append(confs, fileConfs...)
+	}
+
+	for _, conf := range confs {
+		if len(conf.Audience) == 0 {
+			return nil, fmt.Errorf("audience of issuer %v is required. set %v=<issuer>|<audience> or \"audience\" in %v",
+				conf.Issuer, oidcIssuersEnv, oidcIssuersFileEnv)
+		}
+	}
+	return confs, nil
+}
+
+// setupAuthenticator initializes Cognito authenticator, trusted OpenID Connect issuers
+// and the development token issuer if given.
+func setupAuthenticator(devIssuer *DevTokenIssuer) (Authenticator, error) {
+	leeway, err := loadJWTLeewayEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	confs := make([]*OIDCIssuerConfig, 0)
+	cognito, err := LoadCognitoIssuerEnv()
+	if err != nil {
+		return nil, err
+	}
+	if cognito != nil {
+		confs = append(confs, cognito)
+	}
+	oidcConfs, err := LoadOIDCIssuersEnv()
+	if err != nil {
+		return nil, err
+	}
+	confs = append(confs, oidcConfs...)
+
+	multi := NewMultiAuthenticator()
+	for _, conf := range confs {
+		conf.Leeway = leeway
+		a, err := NewOIDCAuthenticator(conf)
+		if err != nil {
+			return nil, err
+		}
+		multi.Add(conf.Issuer, a)
+	}
+
+	// dev tokens go through the same verification as the other issuers.
+	if devIssuer != nil {
+		conf := &OIDCIssuerConfig{Issuer: devIssuer.Issuer(), Audience: []string{devIssuer.Audience()}, TokenUse: []string{"id"}, Leeway: leeway}
+		a, err := newOIDCAuthenticator(conf, devIssuer.JWKS)
+		if err != nil {
+			return nil, err
+		}
+		multi.Add(devIssuer.Issuer(), a)
+	}
+
+	if len(multi.issuers) == 0 {
+		return nil, fmt.Errorf("no token issuer is configured. set %v or %v", cognitoUserPoolIDEnv, oidcIssuersEnv)
+	}
+	return multi, nil
+}
+
+// LoadCognitoIssuerEnv returns Cognito UserPool issuer config, or nil if the pool is not set.
+// Only ID tokens are accepted by default.
+// The app client is required, since the user pool signs tokens for its other app clients too.
+func LoadCognitoIssuerEnv() (*OIDCIssuerConfig, error) {
+	userPool := &auth.UserPool{
+		Region:      os.Getenv(cognitoRegionEnv),
+		PoolID:      os.Getenv(cognitoUserPoolIDEnv),
+		AppClientID: os.Getenv(cognitoAppClientIDEnv),
+	}
+	if userPool.PoolID == "" {
+		return nil, nil
+	}
+	if userPool.AppClientID == "" {
+		return nil, fmt.Errorf("%v is required when %v is set", cognitoAppClientIDEnv, cognitoUserPoolIDEnv)
+	}
+
+	conf := &OIDCIssuerConfig{
+		Issuer:   userPool.Issuer(),
+		JWKSURL:  userPool.Issuer() + "/.well-known/jwks.json",
+		Audience: []string{userPool.AppClientID},
+		TokenUse: []string{"id"},
+	}
+	if v := os.Getenv(cognitoTokenUseEnv); v != "" {
+		conf.TokenUse = splitComma(v)
+	}
+	return conf, nil
+}
+
+func splitComma(s string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,248 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeJWKS writes public keys by kid to a temporary JWKS file.
+func writeJWKS(t *testing.T, dir string, keys map[string]interface{}) string {
+	jwks := server.JWKS{}
+	for kid, key := range keys {
+		jwk, err := server.NewJWK(kid, key)
+		require.NoError(t, err)
+		jwks.Keys = append(jwks.Keys, *jwk)
+	}
+	b, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	filename := filepath.Join(dir, "jwks.json")
+	require.NoError(t, ioutil.WriteFile(filename, b, 0600))
+	return filename
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "jwks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	jwksFile := writeJWKS(t, dir, map[string]interface{}{
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+	})
+
+	const issuer = "https://issuer.example.com"
+	a, err := server.NewOIDCAuthenticator(&server.OIDCIssuerConfig{
+		Issuer:   issuer,
+		JWKSFile: jwksFile,
+		Audience: []string{"client-1"},
+		TokenUse: []string{"id"},
+		Leeway:   time.Minute,
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	claims := func(override jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":       issuer,
+			"sub":       "user-1",
+			"aud":       "client-1",
+			"token_use": "id",
+			"exp":       now.Add(time.Hour).Unix(),
+		}
+		for k, v := range override {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"RS256", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil)), nil},
+		{"ES256", signToken(t, jwt.SigningMethodES256, "ec", ecKey, claims(nil)), nil},
+		{"audience array", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": []string{"other", "client-1"}})), nil},
+		{"client_id instead of aud", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": nil, "client_id": "client-1"})), nil},
+		{"expired within leeway", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()})), nil},
+		{"nbf within leeway", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"nbf": now.Add(30 * time.Second).Unix()})), nil},
+		{"wrong issuer", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"iss": "https://evil.example.com"})), server.ErrTokenIssuer},
+		{"wrong audience", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": "other"})), server.ErrTokenAudience},
+		{"no audience", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": nil})), server.ErrTokenAudience},
+		{"access token", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"token_use": "access"})), server.ErrTokenUse},
+		{"no token_use", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"token_use": nil})), server.ErrTokenUse},
+		{"expired", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"exp": now.Add(-2 * time.Minute).Unix()})), server.ErrTokenExpired},
+		{"no exp", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"exp": nil})), server.ErrTokenMalformed},
+		{"nbf in the future", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"nbf": now.Add(2 * time.Minute).Unix()})), server.ErrTokenNotValidYet},
+		{"iat in the future", signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"iat": now.Add(2 * time.Minute).Unix()})), server.ErrTokenNotValidYet},
+		{"unknown kid", signToken(t, jwt.SigningMethodRS256, "unknown", rsaKey, claims(nil)), server.ErrTokenSignature},
+		{"no kid with multiple keys", signToken(t, jwt.SigningMethodRS256, "", rsaKey, claims(nil)), server.ErrTokenSignature},
+		{"alg does not match key", signToken(t, jwt.SigningMethodES256, "rsa", ecKey, claims(nil)), server.ErrTokenSignature},
+		{"HS256 signed with public key", signToken(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), claims(nil)), server.ErrTokenSignature},
+		{"malformed", "not.a.jwt", server.ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := a.ValidateToken(tt.token)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v, want %v", err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", token.Claims.(jwt.MapClaims)["sub"])
+		})
+	}
+}
+
+func TestMultiAuthenticator(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	multi := server.NewMultiAuthenticator()
+	for issuer, key := range map[string]*rsa.PrivateKey{"https://one.example.com": key1, "https://two.example.com": key2} {
+		dir, err := ioutil.TempDir("", "jwks")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		a, err := server.NewOIDCAuthenticator(&server.OIDCIssuerConfig{
+			Issuer:   issuer,
+			JWKSFile: writeJWKS(t, dir, map[string]interface{}{"k": &key.PublicKey}),
+		})
+		require.NoError(t, err)
+		multi.Add(issuer, a)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"issuer one", signToken(t, jwt.SigningMethodRS256, "k", key1, jwt.MapClaims{"iss": "https://one.example.com", "exp": exp}), false},
+		{"issuer two without kid", signToken(t, jwt.SigningMethodRS256, "", key2, jwt.MapClaims{"iss": "https://two.example.com", "exp": exp}), false},
+		{"signed by another issuer's key", signToken(t, jwt.SigningMethodRS256, "k", key2, jwt.MapClaims{"iss": "https://one.example.com", "exp": exp}), true},
+		{"untrusted issuer", signToken(t, jwt.SigningMethodRS256, "k", key1, jwt.MapClaims{"iss": "https://three.example.com", "exp": exp}), true},
+		{"no issuer", signToken(t, jwt.SigningMethodRS256, "k", key1, jwt.MapClaims{"exp": exp}), true},
+		{"malformed", "not.a.jwt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := multi.ValidateToken(tt.token)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestLoadOIDCIssuersEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oidc")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	withAudience := filepath.Join(dir, "with_audience.json")
+	require.NoError(t, ioutil.WriteFile(withAudience, []byte(`[{"issuer": "https://idp.example.com", "audience": ["client-3"]}]`), 0600))
+	withoutAudience := filepath.Join(dir, "without_audience.json")
+	require.NoError(t, ioutil.WriteFile(withoutAudience, []byte(`[{"issuer": "https://idp.example.com"}]`), 0600))
+
+	tests := []struct {
+		name    string
+		issuers string
+		file    string
+		want    []*server.OIDCIssuerConfig
+		wantErr bool
+	}{
+		{"none", "", "", []*server.OIDCIssuerConfig{}, false},
+		{"issuers with audiences",
+			"https://accounts.google.com|client-1, https://login.example.com|client-1|client-2", withAudience,
+			[]*server.OIDCIssuerConfig{
+				{Issuer: "https://accounts.google.com", Audience: []string{"client-1"}},
+				{Issuer: "https://login.example.com", Audience: []string{"client-1", "client-2"}},
+				{Issuer: "https://idp.example.com", Audience: []string{"client-3"}},
+			}, false},
+		{"issuer without audience", "https://accounts.google.com", "", nil, true},
+		{"empty audience", "https://accounts.google.com|", "", nil, true},
+		{"file without audience", "", withoutAudience, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("OIDC_ISSUERS", tt.issuers)
+			defer os.Unsetenv("OIDC_ISSUERS")
+			os.Setenv("OIDC_ISSUERS_FILE", tt.file)
+			defer os.Unsetenv("OIDC_ISSUERS_FILE")
+
+			got, err := server.LoadOIDCIssuersEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadOIDCIssuersEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadCognitoIssuerEnv(t *testing.T) {
+	issuer := "https://cognito-idp.ap-northeast-1.amazonaws.com/ap-northeast-1_ABCDE1234"
+	tests := []struct {
+		name     string
+		poolID   string
+		clientID string
+		tokenUse string
+		want     *server.OIDCIssuerConfig
+		wantErr  bool
+	}{
+		{"none", "", "", "", nil, false},
+		{"pool with app client", "ap-northeast-1_ABCDE1234", "client-1", "",
+			&server.OIDCIssuerConfig{Issuer: issuer, JWKSURL: issuer + "/.well-known/jwks.json", Audience: []string{"client-1"}, TokenUse: []string{"id"}}, false},
+		{"token use", "ap-northeast-1_ABCDE1234", "client-1", "id, access",
+			&server.OIDCIssuerConfig{Issuer: issuer, JWKSURL: issuer + "/.well-known/jwks.json", Audience: []string{"client-1"}, TokenUse: []string{"id", "access"}}, false},
+		{"pool without app client", "ap-northeast-1_ABCDE1234", "", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("COGNITO_REGION", "ap-northeast-1")
+			defer os.Unsetenv("COGNITO_REGION")
+			os.Setenv("COGNITO_USER_POOL_ID", tt.poolID)
+			defer os.Unsetenv("COGNITO_USER_POOL_ID")
+			os.Setenv("COGNITO_APP_CLIENT_ID", tt.clientID)
+			defer os.Unsetenv("COGNITO_APP_CLIENT_ID")
+			os.Setenv("COGNITO_TOKEN_USE", tt.tokenUse)
+			defer os.Unsetenv("COGNITO_TOKEN_USE")
+
+			got, err := server.LoadCognitoIssuerEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadCognitoIssuerEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"os"
+)
+
+const (
+	identityClaimEnv      = "JWT_IDENTITY_CLAIM"
+	emailClaimEnv         = "JWT_EMAIL_CLAIM"
+	emailVerifiedClaimEnv = "JWT_EMAIL_VERIFIED_CLAIM"
+	displayNameClaimEnv   = "JWT_DISPLAY_NAME_CLAIM"
+)
+
+// ClaimMapping defines which JWT claims identify users.
+type ClaimMapping struct {
+	// Identity is an immutable user identifier claim. (default: "sub")
+	Identity string
+	// Email is an email address claim. (default: "email")
+	Email string
+	// EmailVerified is a claim whether the identity provider verified the email. (default: "email_verified")
+	EmailVerified string
+	// DisplayName is a display name claim. (default: "name")
+	DisplayName string
+}
+
+// DefaultClaimMapping returns standard OpenID Connect claims mapping.
+func DefaultClaimMapping() *ClaimMapping {
+	return &ClaimMapping{
+		Identity:      "sub",
+		Email:         "email",
+		EmailVerified: "email_verified",
+		DisplayName:   "name",
+	}
+}
+
+// LoadClaimMappingEnv initializes ClaimMapping using Environment Variables.
+func LoadClaimMappingEnv() *ClaimMapping {
+	m := DefaultClaimMapping()
+	if v := os.Getenv(identityClaimEnv); v != "" {
+		m.Identity = v
+	}
+	if v := os.Getenv(emailClaimEnv); v != "" {
+		m.Email = v
+	}
+	if v := os.Getenv(emailVerifiedClaimEnv); v != "" {
+		m.EmailVerified = v
+	}
+	if v := os.Getenv(displayNameClaimEnv); v != "" {
+		m.DisplayName = v
+	}
+	return m
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	jwtLeewaySecondEnv = "JWT_LEEWAY_SECOND"
+
+	defaultJWTLeeway = 60 * time.Second
+)
+
+// token validation errors. Each reason has a distinct message in the error response.
+var (
+	// ErrTokenMalformed is returned when the token cannot be parsed or lacks required claims.
+	ErrTokenMalformed = errors.New("token is malformed")
+	// ErrTokenSignature is returned when the signature cannot be verified.
+	ErrTokenSignature = errors.New("token signature is invalid")
+	// ErrTokenExpired is returned when "exp" has passed.
+	ErrTokenExpired = errors.New("token is expired")
+	// ErrTokenNotValidYet is returned when "nbf" or "iat" is in the future.
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+	// ErrTokenIssuer is returned when "iss" is not a trusted issuer.
+	ErrTokenIssuer = errors.New("token issuer is not trusted")
+	// ErrTokenAudience is returned when neither "aud" nor "client_id" is an allowed audience.
+	ErrTokenAudience = errors.New("token audience is not allowed")
+	// ErrTokenUse is returned when "token_use" is not allowed, e.g. an access token is used as ID token.
+	ErrTokenUse = errors.New("token_use is not allowed")
+	// ErrTokenRevoked is returned when the token or its session has been revoked.
+	ErrTokenRevoked = errors.New("token is revoked")
+)
+
+// claimValidator validates registered claims of a verified token.
+type claimValidator struct {
+	issuer   string
+	audience []string
+	tokenUse []string
+	leeway   time.Duration
+}
+
+// validate checks "iss", "exp", "nbf", "iat", "aud"/"client_id" and "token_use".
+// "exp" is required, and "nbf" and "iat" are checked if present.
+func (v *claimValidator) validate(claims jwt.MapClaims, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != v.issuer {
+		return fmt.Errorf("%w: %v", ErrTokenIssuer, iss)
+	}
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("%w: exp claim is required", ErrTokenMalformed)
+	}
+	if now.After(exp.Add(v.leeway)) {
+		return fmt.Errorf("%w: expired at %v", ErrTokenExpired, exp.Format(time.RFC3339))
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.leeway).Before(nbf) {
+		return fmt.Errorf("%w: not before %v", ErrTokenNotValidYet, nbf.Format(time.RFC3339))
+	}
+	if iat, ok := numericDate(claims["iat"]); ok && now.Add(v.leeway).Before(iat) {
+		return fmt.Errorf("%w: issued at %v", ErrTokenNotValidYet, iat.Format(time.RFC3339))
+	}
+
+	if len(v.audience) > 0 {
+		// Cognito access tokens have "client_id" instead of "aud".
+		auds := audiences(claims)
+		if clientID, ok := claims["client_id"].(string); ok {
+			auds = append(auds, clientID)
+		}
+		if !containsAny(auds, v.audience) {
+			return fmt.Errorf("%w: %v", ErrTokenAudience, strings.Join(auds, ","))
+		}
+	}
+
+	if len(v.tokenUse) > 0 {
+		tokenUse, _ := claims["token_use"].(string)
+		if !containsAny([]string{tokenUse}, v.tokenUse) {
+			return fmt.Errorf("%w: %q, expected %v", ErrTokenUse, tokenUse, strings.Join(v.tokenUse, " or "))
+		}
+	}
+	return nil
+}
+
+// numericDate parses NumericDate claim value.
+func numericDate(v interface{}) (time.Time, bool) {
+	switch n := v.(type) {
+	case float64:
+		return time.Unix(int64(n), 0), true
+	case int64:
+		return time.Unix(n, 0), true
+	case json.Number:
+		i, err := n.Int64()
+		return time.Unix(i, 0), err == nil
+	}
+	return time.Time{}, false
+}
+
+// audiences returns "aud" claim which is a string or an array of strings.
+func audiences(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		list := make([]string, 0, len(aud))
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func containsAny(values []string, allowed []string) bool {
+	for _, v := range values {
+		for _, a := range allowed {
+			if v == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseError converts jwt-go validation error into the token validation errors.
+func parseError(err error) error {
+	var vErr *jwt.ValidationError
+	if errors.As(err, &vErr) && vErr.Errors&(jwt.ValidationErrorUnverifiable|jwt.ValidationErrorSignatureInvalid) != 0 {
+		return fmt.Errorf("%w: %v", ErrTokenSignature, err)
+	}
+	return fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+}
+
+// loadJWTLeewayEnv loads allowed clock skew for "exp", "nbf" and "iat".
+func loadJWTLeewayEnv() (time.Duration, error) {
+	v := os.Getenv(jwtLeewaySecondEnv)
+	if v == "" {
+		return defaultJWTLeeway, nil
+	}
+	sec, err := strconv.Atoi(v)
+	if err != nil || sec < 0 {
+		return 0, fmt.Errorf("%v expects non-negative int value, but %v was given", jwtLeewaySecondEnv, v)
+	}
+	return time.Duration(sec) * time.Second, nil
+}
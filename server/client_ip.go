@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const trustedProxiesEnv = "TRUSTED_PROXIES"
+
+var clientIPContextKey = "client_ip"
+
+// TrustedProxies are networks of reverse proxies and load balancers
+// whose X-Forwarded-For header is trusted.
+type TrustedProxies []*net.IPNet
+
+// LoadTrustedProxiesEnv loads comma separated CIDRs or IP addresses of TRUSTED_PROXIES.
+// It returns empty TrustedProxies if not set, and X-Forwarded-For is ignored.
+func LoadTrustedProxiesEnv() (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, v := range strings.Split(os.Getenv(trustedProxiesEnv), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("%v has an invalid IP address %q", trustedProxiesEnv, v)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("%v has an invalid CIDR %q", trustedProxiesEnv, v)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// contains returns true if the IP address is one of the trusted proxies.
+func (tp TrustedProxies) contains(ip net.IP) bool {
+	for _, network := range tp {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIPMiddleware determines the client IP of the request for rate limits, logs and traces.
+// It is the peer address, unless the peer is a trusted proxy.
+// Then X-Forwarded-For is read from the right, and the first address which is not a trusted proxy is the client.
+func ClientIPMiddleware(proxies TrustedProxies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(clientIPContextKey, proxies.clientIP(c.Request.RemoteAddr, c.Request.Header.Values("X-Forwarded-For")))
+		c.Next()
+	}
+}
+
+// ClientIP returns the client IP set by ClientIPMiddleware, or the peer address.
+// Use it instead of gin.Context.ClientIP, which trusts X-Forwarded-For of any client.
+func ClientIP(c *gin.Context) string {
+	if ip := c.GetString(clientIPContextKey); ip != "" {
+		return ip
+	}
+	return peerIP(c.Request.RemoteAddr)
+}
+
+func (tp TrustedProxies) clientIP(remoteAddr string, forwardedFor []string) string {
+	ip := peerIP(remoteAddr)
+	if peer := net.ParseIP(ip); peer == nil || !tp.contains(peer) {
+		return ip
+	}
+
+	// each proxy appends the address of its peer.
+	var hops []string
+	for _, v := range forwardedFor {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// the rest may be forged by the client.
+			break
+		}
+		ip = hop.String()
+		if !tp.contains(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// peerIP returns the host of the remote address.
+func peerIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(strings.TrimSpace(remoteAddr)); err == nil {
+		return host
+	}
+	return remoteAddr
+}
@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTrustedProxiesEnv(t *testing.T) {
+	defer os.Unsetenv("TRUSTED_PROXIES")
+
+	tests := []struct {
+		name    string
+		env     string
+		wantLen int
+		wantErr bool
+	}{
+		{"not set", "", 0, false},
+		{"CIDRs and addresses", "10.0.0.0/8, 192.0.2.1,2001:db8::/32", 3, false},
+		{"invalid CIDR", "10.0.0.0/33", 0, true},
+		{"invalid address", "proxy.example.com", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("TRUSTED_PROXIES", tt.env)
+			got, err := server.LoadTrustedProxiesEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadTrustedProxiesEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Len(t, got, tt.wantLen)
+		})
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	os.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,192.0.2.1")
+	defer os.Unsetenv("TRUSTED_PROXIES")
+	proxies, err := server.LoadTrustedProxiesEnv()
+	require.NoError(t, err)
+
+	var clientIP string
+	r := gin.New()
+	r.Use(server.ClientIPMiddleware(proxies))
+	r.GET("/", func(c *gin.Context) { clientIP = server.ClientIP(c) })
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"direct", "203.0.113.1:12345", nil, "203.0.113.1"},
+		{"forged by a direct client", "203.0.113.1:12345", []string{"198.51.100.1"}, "203.0.113.1"},
+		{"trusted proxy", "10.0.0.1:12345", []string{"203.0.113.1"}, "203.0.113.1"},
+		{"forged before trusted proxies", "10.0.0.1:12345", []string{"198.51.100.1, 203.0.113.1, 192.0.2.1"}, "203.0.113.1"},
+		{"multiple headers", "10.0.0.1:12345", []string{"198.51.100.1", "203.0.113.1"}, "203.0.113.1"},
+		{"invalid address", "10.0.0.1:12345", []string{"203.0.113.1, unknown"}, "10.0.0.1"},
+		{"only trusted proxies", "10.0.0.1:12345", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"trusted proxy without header", "10.0.0.1:12345", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Equal(t, tt.want, clientIP)
+		})
+	}
+}
+
+func TestClientIP_WithoutMiddleware(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/", nil)
+	c.Request.RemoteAddr = "203.0.113.1:12345"
+	c.Request.Header.Set("X-Forwarded-For", "198.51.100.1")
+	assert.Equal(t, "203.0.113.1", server.ClientIP(c))
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	compressionEnabledEnv     = "COMPRESSION_ENABLED"
+	compressionMinSizeEnv     = "COMPRESSION_MIN_SIZE"
+	compressionGzipLevelEnv   = "COMPRESSION_GZIP_LEVEL"
+	compressionBrotliLevelEnv = "COMPRESSION_BROTLI_LEVEL"
+	compressionTypesEnv       = "COMPRESSION_CONTENT_TYPES"
+)
+
+// content codings.
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+// CompressionConfig is when and how responses are compressed.
+type CompressionConfig struct {
+	// MinSize is the body size in bytes to compress. Smaller bodies are not worth it.
+	MinSize     int
+	GzipLevel   int
+	BrotliLevel int
+	// ContentTypes are media types to compress. "text/*" matches all text types.
+	ContentTypes []string
+}
+
+// DefaultCompressionConfig returns CompressionConfig used by Start.
+func DefaultCompressionConfig() *CompressionConfig {
+	return &CompressionConfig{
+		MinSize:   1024,
+		GzipLevel: gzip.DefaultCompression,
+		// higher levels are too slow for dynamic responses.
+		BrotliLevel: 4,
+		ContentTypes: []string{
+			"application/json",
+			"application/javascript",
+			"application/xml",
+			"text/*",
+		},
+	}
+}
+
+// LoadCompressionConfigEnv loads DefaultCompressionConfig overridden by Environment Variables.
+// It returns nil if COMPRESSION_ENABLED is false.
+func LoadCompressionConfigEnv() (*CompressionConfig, error) {
+	if os.Getenv(compressionEnabledEnv) == "false" {
+		return nil, nil
+	}
+	conf := DefaultCompressionConfig()
+
+	loadInt := func(env string, min, max int, v *int) error {
+		s := os.Getenv(env)
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("%v expects int value from %v to %v, but %v was given", env, min, max, s)
+		}
+		*v = n
+		return nil
+	}
+	if err := loadInt(compressionMinSizeEnv, 0, 1<<30, &conf.MinSize); err != nil {
+		return nil, err
+	}
+	if err := loadInt(compressionGzipLevelEnv, gzip.HuffmanOnly, gzip.BestCompression, &conf.GzipLevel); err != nil {
+		return nil, err
+	}
+	if err := loadInt(compressionBrotliLevelEnv, brotli.BestSpeed, brotli.BestCompression, &conf.BrotliLevel); err != nil {
+		return nil, err
+	}
+	if v := os.Getenv(compressionTypesEnv); v != "" {
+		conf.ContentTypes = nil
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				conf.ContentTypes = append(conf.ContentTypes, strings.ToLower(t))
+			}
+		}
+	}
+	return conf, nil
+}
+
+func (conf *CompressionConfig) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range conf.ContentTypes {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompressionMiddleware compresses responses by brotli or gzip negotiated by Accept-Encoding.
+// Bodies are buffered up to MinSize to decide whether to compress.
+// Responses already encoded, without body like 304 Not Modified, or of other content types are sent as they are.
+func CompressionMiddleware(conf *CompressionConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, conf: conf, encoding: encoding}
+		c.Writer = w
+		defer w.close()
+		c.Next()
+	}
+}
+
+// negotiateEncoding returns the content coding with the highest quality, preferring brotli.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qualities[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{EncodingBrotli, EncodingGzip} {
+		q, ok := qualities[coding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the body until it decides whether to compress.
+type compressWriter struct {
+	gin.ResponseWriter
+	conf     *CompressionConfig
+	encoding string
+
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+	// size is the uncompressed size written by handlers.
+	size int
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.size += len(b)
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.conf.MinSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Size returns the body size before compression, for access logs.
+func (w *compressWriter) Size() int {
+	if w.size == 0 && !w.decided {
+		return w.ResponseWriter.Size()
+	}
+	return w.size
+}
+
+func (w *compressWriter) Written() bool {
+	return w.size > 0 || w.ResponseWriter.Written()
+}
+
+// Flush sends the buffered body, compressing it if it can grow up to MinSize like a stream.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.decided = true
+	return w.ResponseWriter.Hijack()
+}
+
+// decide starts compression if the response is worth it, then writes the buffered body.
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	header := w.Header()
+	status := w.Status()
+	if large && w.conf.compressible(header.Get("Content-Type")) &&
+		header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" &&
+		status != http.StatusNotModified && status != http.StatusNoContent && status != http.StatusPartialContent {
+		header.Set("Content-Encoding", w.encoding)
+		header.Add("Vary", "Accept-Encoding")
+		header.Del("Content-Length")
+		switch w.encoding {
+		case EncodingBrotli:
+			w.encoder = brotli.NewWriterLevel(w.ResponseWriter, w.conf.BrotliLevel)
+		default:
+			// the level is validated by LoadCompressionConfigEnv.
+			w.encoder, _ = gzip.NewWriterLevel(w.ResponseWriter, w.conf.GzipLevel)
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close sends the small body as it is, or finishes compression.
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
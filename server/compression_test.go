@@ -0,0 +1,139 @@
+package server_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	large := strings.Repeat("apple ", 500)
+	r := gin.New()
+	r.Use(server.CompressionMiddleware(server.DefaultCompressionConfig()))
+	r.GET("/large", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"name": large}) })
+	r.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"name": "apple"}) })
+	r.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+	r.GET("/encoded", func(c *gin.Context) {
+		c.Header("Content-Encoding", "gzip")
+		c.Data(http.StatusOK, "text/plain", []byte(large))
+	})
+	r.GET("/not-modified", func(c *gin.Context) { c.Status(http.StatusNotModified) })
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+		wantStatus     int
+	}{
+		{"brotli preferred", "/large", "gzip, deflate, br", "br", http.StatusOK},
+		{"gzip", "/large", "gzip", "gzip", http.StatusOK},
+		{"gzip by quality", "/large", "br;q=0.5, gzip", "gzip", http.StatusOK},
+		{"wildcard", "/large", "*", "br", http.StatusOK},
+		{"refused", "/large", "br;q=0, gzip;q=0", "", http.StatusOK},
+		{"not accepted", "/large", "", "", http.StatusOK},
+		{"identity", "/large", "identity", "", http.StatusOK},
+		{"below min size", "/small", "gzip", "", http.StatusOK},
+		{"content type", "/image", "gzip", "", http.StatusOK},
+		{"already encoded", "/encoded", "br", "gzip", http.StatusOK},
+		{"not modified", "/not-modified", "gzip", "", http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantEncoding, w.Header().Get("Content-Encoding"))
+			if tt.path != "/large" || tt.wantEncoding == "" {
+				return
+			}
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+			var body []byte
+			switch tt.wantEncoding {
+			case "gzip":
+				gr, err := gzip.NewReader(w.Body)
+				require.NoError(t, err)
+				body, err = ioutil.ReadAll(gr)
+				require.NoError(t, err)
+			case "br":
+				var err error
+				body, err = ioutil.ReadAll(brotli.NewReader(w.Body))
+				require.NoError(t, err)
+			}
+			assert.JSONEq(t, `{"name":"`+large+`"}`, string(body))
+		})
+	}
+}
+
+func TestCompressionMiddleware_RequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	conf := server.DefaultCompressionConfig()
+	conf.MinSize = 0
+	r := gin.New()
+	r.Use(server.CompressionMiddleware(conf), server.RequestIDMiddleware())
+	r.GET("/error", func(c *gin.Context) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"errors": []gin.H{{"code": "404", "type": "NotFoundError", "messages": []string{}}}})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/error", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set(server.RequestIDHeader, "req-1")
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	gr, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(gr)
+	assert.Contains(t, string(body), `"request_id":"req-1"`)
+}
+
+func TestLoadCompressionConfigEnv(t *testing.T) {
+	conf, err := server.LoadCompressionConfigEnv()
+	require.NoError(t, err)
+	assert.Equal(t, server.DefaultCompressionConfig(), conf)
+
+	os.Setenv("COMPRESSION_MIN_SIZE", "256")
+	os.Setenv("COMPRESSION_GZIP_LEVEL", "9")
+	os.Setenv("COMPRESSION_BROTLI_LEVEL", "11")
+	os.Setenv("COMPRESSION_CONTENT_TYPES", "application/json, text/csv")
+	defer func() {
+		for _, env := range []string{"COMPRESSION_MIN_SIZE", "COMPRESSION_GZIP_LEVEL", "COMPRESSION_BROTLI_LEVEL",
+			"COMPRESSION_CONTENT_TYPES", "COMPRESSION_ENABLED"} {
+			os.Unsetenv(env)
+		}
+	}()
+	conf, err = server.LoadCompressionConfigEnv()
+	require.NoError(t, err)
+	assert.Equal(t, &server.CompressionConfig{
+		MinSize: 256, GzipLevel: 9, BrotliLevel: 11, ContentTypes: []string{"application/json", "text/csv"},
+	}, conf)
+
+	os.Setenv("COMPRESSION_GZIP_LEVEL", "10")
+	_, err = server.LoadCompressionConfigEnv()
+	assert.Error(t, err)
+
+	os.Setenv("COMPRESSION_ENABLED", "false")
+	conf, err = server.LoadCompressionConfigEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, conf)
+}
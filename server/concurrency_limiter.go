@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const concurrencyLimitsFileEnv = "CONCURRENCY_LIMITS_FILE"
+
+var concurrencyLimitersContextKey = "concurrency_limiters"
+
+// ErrConcurrencyLimitExceeded is returned when the queue is full or the request waited too long.
+var ErrConcurrencyLimitExceeded = errors.New("too many requests in flight")
+
+// ConcurrencyLimitConfig is a limit of in-flight requests.
+// The limit grows by 1 while it is used and shrinks by BackoffRatio when latency rises,
+// between MinLimit and MaxLimit. MinLimit == MaxLimit is a fixed limit.
+type ConcurrencyLimitConfig struct {
+	InitialLimit int `json:"initial_limit"`
+	MinLimit     int `json:"min_limit"`
+	// MaxLimit of 0 disables the limit.
+	MaxLimit int `json:"max_limit"`
+	// QueueSize is the number of requests waiting for a slot.
+	QueueSize          int `json:"queue_size"`
+	QueueTimeoutMillis int `json:"queue_timeout_millis"`
+	// LatencyTolerance is the ratio of short-term latency to the long-term baseline regarded as congestion.
+	LatencyTolerance float64 `json:"latency_tolerance"`
+	BackoffRatio     float64 `json:"backoff_ratio"`
+	RetryAfterSecond int     `json:"retry_after_second"`
+}
+
+func (conf *ConcurrencyLimitConfig) validate() error {
+	if conf.MaxLimit == 0 {
+		return nil
+	}
+	if conf.MinLimit <= 0 || conf.MinLimit > conf.MaxLimit ||
+		conf.InitialLimit < conf.MinLimit || conf.InitialLimit > conf.MaxLimit {
+		return fmt.Errorf("concurrency limit expects 0 < min_limit <= initial_limit <= max_limit")
+	}
+	if conf.QueueSize < 0 || conf.QueueTimeoutMillis < 0 || conf.RetryAfterSecond < 0 {
+		return fmt.Errorf("concurrency limit expects non-negative queue_size, queue_timeout_millis and retry_after_second")
+	}
+	if conf.LatencyTolerance < 1 {
+		return fmt.Errorf("concurrency limit expects latency_tolerance >= 1")
+	}
+	if conf.BackoffRatio <= 0 || conf.BackoffRatio >= 1 {
+		return fmt.Errorf("concurrency limit expects 0 < backoff_ratio < 1")
+	}
+	return nil
+}
+
+// ConcurrencyLimits are concurrency limits by name.
+type ConcurrencyLimits map[string]*ConcurrencyLimitConfig
+
+// DefaultConcurrencyLimits returns concurrency limits used by Start and defineRoutes.
+func DefaultConcurrencyLimits() ConcurrencyLimits {
+	return ConcurrencyLimits{
+		// all requests of this instance
+		"global": {
+			InitialLimit: 100, MinLimit: 10, MaxLimit: 500,
+			QueueSize: 100, QueueTimeoutMillis: 200,
+			LatencyTolerance: 2, BackoffRatio: 0.9, RetryAfterSecond: 1,
+		},
+		// writes by users and internal workers, not to take all DB connections.
+		"fruits:write": {
+			InitialLimit: 20, MinLimit: 2, MaxLimit: 50,
+			QueueSize: 20, QueueTimeoutMillis: 500,
+			LatencyTolerance: 2, BackoffRatio: 0.9, RetryAfterSecond: 1,
+		},
+	}
+}
+
+// LoadConcurrencyLimitsEnv loads DefaultConcurrencyLimits overridden by CONCURRENCY_LIMITS_FILE.
+//
+//	{"global": {"initial_limit": 50, "min_limit": 10, "max_limit": 100, "queue_size": 50, "queue_timeout_millis": 100,
+//	 "latency_tolerance": 2, "backoff_ratio": 0.9, "retry_after_second": 1}}
+func LoadConcurrencyLimitsEnv() (ConcurrencyLimits, error) {
+	limits := DefaultConcurrencyLimits()
+	if filename := os.Getenv(concurrencyLimitsFileEnv); filename != "" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var overrides ConcurrencyLimits
+		if err := json.Unmarshal(b, &overrides); err != nil {
+			return nil, fmt.Errorf("cannot parse %v: %v", concurrencyLimitsFileEnv, err)
+		}
+		for name, conf := range overrides {
+			limits[name] = conf
+		}
+	}
+
+	for name, conf := range limits {
+		if err := conf.validate(); err != nil {
+			return nil, fmt.Errorf("concurrency limit %v: %v", name, err)
+		}
+	}
+	return limits, nil
+}
+
+// latency smoothing factors of exponentially weighted moving averages.
+const (
+	shortLatencyAlpha = 0.2
+	longLatencyAlpha  = 0.01
+)
+
+// ConcurrencyLimiter limits in-flight requests of this instance.
+// The limit is adapted by AIMD with a Vegas-like delay signal:
+// it decreases when the short-term latency exceeds the long-term baseline by LatencyTolerance,
+// and increases while more than half of it is used.
+type ConcurrencyLimiter struct {
+	conf *ConcurrencyLimitConfig
+
+	mu           sync.Mutex
+	limit        float64
+	inFlight     int
+	waiters      []chan struct{}
+	shortLatency float64
+	longLatency  float64
+}
+
+// NewConcurrencyLimiter initializes a limiter.
+func NewConcurrencyLimiter(conf *ConcurrencyLimitConfig) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{conf: conf, limit: float64(conf.InitialLimit)}
+}
+
+// Limit returns the current limit.
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of requests holding slots.
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Acquire takes a slot, waiting in the queue up to QueueTimeoutMillis.
+// The caller must call Release with the latency when the request is done.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.waiters) >= l.conf.QueueSize {
+		l.mu.Unlock()
+		return ErrConcurrencyLimitExceeded
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Duration(l.conf.QueueTimeoutMillis) * time.Millisecond)
+	defer timer.Stop()
+	err := ErrConcurrencyLimitExceeded
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, w := range l.waiters {
+		if w == ready {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return err
+		}
+	}
+	// a slot was given while timing out.
+	return nil
+}
+
+// Release returns the slot and adapts the limit by the latency of the request.
+func (l *ConcurrencyLimiter) Release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	l.adapt(float64(latency))
+
+	// hand over slots to queued requests in order.
+	for len(l.waiters) > 0 && l.inFlight < int(l.limit) {
+		l.inFlight++
+		close(l.waiters[0])
+		l.waiters = l.waiters[1:]
+	}
+}
+
+func (l *ConcurrencyLimiter) adapt(latency float64) {
+	if l.longLatency == 0 {
+		l.shortLatency, l.longLatency = latency, latency
+		return
+	}
+	l.shortLatency += shortLatencyAlpha * (latency - l.shortLatency)
+	l.longLatency += longLatencyAlpha * (latency - l.longLatency)
+
+	min, max := float64(l.conf.MinLimit), float64(l.conf.MaxLimit)
+	if l.shortLatency > l.longLatency*l.conf.LatencyTolerance {
+		l.limit = math.Max(min, l.limit*l.conf.BackoffRatio)
+		// follow the short-term latency, or the limit keeps decreasing under a new normal.
+		l.longLatency = l.shortLatency / l.conf.LatencyTolerance
+	} else if float64(l.inFlight+1)*2 >= l.limit {
+		l.limit = math.Min(max, l.limit+1)
+	}
+}
+
+// ConcurrencyLimiters are limiters by name.
+type ConcurrencyLimiters map[string]*ConcurrencyLimiter
+
+// NewConcurrencyLimiters initializes limiters of enabled limits.
+func NewConcurrencyLimiters(limits ConcurrencyLimits) ConcurrencyLimiters {
+	limiters := ConcurrencyLimiters{}
+	for name, conf := range limits {
+		if conf.MaxLimit > 0 {
+			limiters[name] = NewConcurrencyLimiter(conf)
+		}
+	}
+	return limiters
+}
+
+// SetConcurrencyLimiters passes limiters to ConcurrencyLimit middlewares.
+func SetConcurrencyLimiters(limiters ConcurrencyLimiters) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(concurrencyLimitersContextKey, limiters)
+		c.Next()
+	}
+}
+
+// ConcurrencyLimit sheds requests of the route when the named limiter is full,
+// with 503 Service Unavailable and Retry-After.
+func ConcurrencyLimit(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get(concurrencyLimitersContextKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		limiter, ok := v.(ConcurrencyLimiters)[name]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if err := limiter.Acquire(c.Request.Context()); err != nil {
+			util.GetLogger().Warnf("request is shed by concurrency limit %v (limit: %v): %v", name, limiter.Limit(), err)
+			c.Header("Retry-After", strconv.Itoa(limiter.conf.RetryAfterSecond))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, model.NewErrorResponse("503", model.ErrorLimitExceeded,
+				"server is busy. please retry later"))
+			return
+		}
+		start := time.Now()
+		defer func() {
+			limiter.Release(time.Since(start))
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,118 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConcurrencyLimitConfig(limit, queueSize int) *server.ConcurrencyLimitConfig {
+	return &server.ConcurrencyLimitConfig{
+		InitialLimit: limit, MinLimit: 1, MaxLimit: 10,
+		QueueSize: queueSize, QueueTimeoutMillis: 50,
+		LatencyTolerance: 2, BackoffRatio: 0.5, RetryAfterSecond: 3,
+	}
+}
+
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	ctx := context.Background()
+	limiter := server.NewConcurrencyLimiter(newConcurrencyLimitConfig(1, 1))
+
+	require.NoError(t, limiter.Acquire(ctx))
+	// queued and timed out.
+	assert.Equal(t, server.ErrConcurrencyLimitExceeded, limiter.Acquire(ctx))
+
+	// a queued request gets the released slot.
+	done := make(chan error)
+	go func() { done <- limiter.Acquire(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	// the queue is full.
+	assert.Equal(t, server.ErrConcurrencyLimitExceeded, limiter.Acquire(ctx))
+	limiter.Release(time.Millisecond)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 1, limiter.InFlight())
+
+	// canceled while queued.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, limiter.Acquire(canceled))
+}
+
+func TestConcurrencyLimiter_Adapt(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		conf      *server.ConcurrencyLimitConfig
+		latencies []time.Duration
+		wantLimit int
+	}{
+		{"increase while used", newConcurrencyLimitConfig(2, 0), []time.Duration{10, 10, 10, 10}, 3},
+		{"decrease on latency rise", newConcurrencyLimitConfig(8, 0), []time.Duration{10, 10, 100}, 4},
+		{"not below min", newConcurrencyLimitConfig(1, 0), []time.Duration{10, 100, 1000}, 1},
+		{"fixed limit", &server.ConcurrencyLimitConfig{
+			InitialLimit: 3, MinLimit: 3, MaxLimit: 3, LatencyTolerance: 2, BackoffRatio: 0.5,
+		}, []time.Duration{10, 100, 10, 10}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := server.NewConcurrencyLimiter(tt.conf)
+			for _, latency := range tt.latencies {
+				require.NoError(t, limiter.Acquire(ctx))
+				limiter.Release(latency * time.Millisecond)
+			}
+			assert.Equal(t, tt.wantLimit, limiter.Limit())
+		})
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiters := server.NewConcurrencyLimiters(server.ConcurrencyLimits{
+		"global": newConcurrencyLimitConfig(1, 0),
+		"off":    {MaxLimit: 0},
+	})
+	assert.Len(t, limiters, 1)
+
+	blocking := make(chan struct{})
+	entered := make(chan struct{})
+	r := gin.New()
+	r.Use(server.SetConcurrencyLimiters(limiters), server.ConcurrencyLimit("global"))
+	r.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		<-blocking
+		c.Status(http.StatusOK)
+	})
+	r.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	slow := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		req, _ := http.NewRequest("GET", "/slow", nil)
+		r.ServeHTTP(slow, req)
+		close(finished)
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/fast", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+
+	close(blocking)
+	<-finished
+	assert.Equal(t, http.StatusOK, slow.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/factory"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	sessionCookieEnabledEnv  = "SESSION_COOKIE_ENABLED"
+	sessionCookieNameEnv     = "SESSION_COOKIE_NAME"
+	sessionCookieDomainEnv   = "SESSION_COOKIE_DOMAIN"
+	sessionCookieSecureEnv   = "SESSION_COOKIE_SECURE"
+	sessionCookieSameSiteEnv = "SESSION_COOKIE_SAMESITE"
+
+	// CSRFTokenHeader is a request header for the double-submit CSRF token.
+	CSRFTokenHeader = "X-CSRF-Token"
+)
+
+// AuthMethodCookie is session cookie authentication.
+const AuthMethodCookie = "cookie"
+
+var cookieConfigContextKey = "auth_cookie"
+
+// ErrCSRFToken is returned when the CSRF token is missing or does not match.
+var ErrCSRFToken = errors.New("CSRF token is missing or invalid")
+
+// CookieConfig has attributes of the session cookie and the CSRF token cookie.
+type CookieConfig struct {
+	Name           string
+	CSRFCookieName string
+	Domain         string
+	Secure         bool
+	SameSite       http.SameSite
+}
+
+// LoadCookieConfigEnv initializes CookieConfig using Environment Variables.
+// It returns nil if the session cookie mode is not enabled.
+func LoadCookieConfigEnv() (*CookieConfig, error) {
+	if os.Getenv(sessionCookieEnabledEnv) != "true" {
+		return nil, nil
+	}
+
+	conf := &CookieConfig{
+		Name:           "session",
+		CSRFCookieName: "csrf_token",
+		Domain:         os.Getenv(sessionCookieDomainEnv),
+		Secure:         os.Getenv(sessionCookieSecureEnv) != "false",
+		SameSite:       http.SameSiteLaxMode,
+	}
+	if name := os.Getenv(sessionCookieNameEnv); name != "" {
+		conf.Name = name
+	}
+
+	switch v := strings.ToLower(os.Getenv(sessionCookieSameSiteEnv)); v {
+	case "", "lax":
+	case "strict":
+		conf.SameSite = http.SameSiteStrictMode
+	case "none":
+		if !conf.Secure {
+			return nil, fmt.Errorf("%v=none requires secure cookie", sessionCookieSameSiteEnv)
+		}
+		conf.SameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("%v expects lax, strict or none, but %v was given", sessionCookieSameSiteEnv, v)
+	}
+	return conf, nil
+}
+
+// SetCookieAuth enables session cookie authentication in AuthMiddleware.
+func SetCookieAuth(conf *CookieConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(cookieConfigContextKey, conf)
+		c.Next()
+	}
+}
+
+// getSessionCookie returns the session cookie if the session cookie mode is enabled.
+func getSessionCookie(c *gin.Context) (conf *CookieConfig, id string, ok bool) {
+	v, ok := c.Get(cookieConfigContextKey)
+	if !ok {
+		return nil, "", false
+	}
+	conf = v.(*CookieConfig)
+	id, err := c.Cookie(conf.Name)
+	if err != nil || id == "" {
+		return nil, "", false
+	}
+	return conf, id, true
+}
+
+// cookieAuthHandler authenticates the request by session cookie
+// and sets the same context as JWT authentication.
+func cookieAuthHandler(c *gin.Context, conf *CookieConfig, id string) error {
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	session, err := factory.NewCookieSessions().Get(id)
+	if err != nil {
+		return fmt.Errorf("session cookie is not valid. [Reason] %w", err)
+	}
+
+	if !isSafeMethod(c.Request.Method) {
+		if err := checkCSRFToken(c, conf, session.CSRFToken); err != nil {
+			return err
+		}
+	}
+
+	if err := checkRevocation(c, session.Iss, session.Sub, session.RevocationIDs, session.IssuedAt); err != nil {
+		return err
+	}
+
+	// set user information to Gin's context.
+	c.Set("email", session.Email)
+	c.Set("email_verified", session.EmailVerified)
+	c.Set("iss", session.Iss)
+	c.Set("sub", session.Sub)
+	c.Set("display_name", session.DisplayName)
+	c.Set("session_id", session.SessionID)
+	if session.Scopes != nil {
+		c.Set(scopesContextKey, session.Scopes)
+	}
+	c.Set(authMethodContextKey, AuthMethodCookie)
+
+	return nil
+}
+
+// isSafeMethod returns true for methods which must not change state (RFC 7231).
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// checkCSRFToken validates the double-submit CSRF token.
+// X-CSRF-Token header must equal both the CSRF cookie and the token of the session.
+func checkCSRFToken(c *gin.Context, conf *CookieConfig, sessionToken string) error {
+	header := c.GetHeader(CSRFTokenHeader)
+	cookie, _ := c.Cookie(conf.CSRFCookieName)
+	if header == "" ||
+		subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(header), []byte(sessionToken)) != 1 {
+		return ErrCSRFToken
+	}
+	return nil
+}
+
+// setCookies sets the session cookie (HttpOnly) and the CSRF token cookie readable by scripts.
+// Negative maxAge deletes the cookies.
+func (conf *CookieConfig) setCookies(c *gin.Context, id, csrfToken string, maxAge int) {
+	for _, cookie := range []*http.Cookie{
+		{Name: conf.Name, Value: id, HttpOnly: true},
+		{Name: conf.CSRFCookieName, Value: csrfToken},
+	} {
+		cookie.Path = "/"
+		cookie.Domain = conf.Domain
+		cookie.MaxAge = maxAge
+		cookie.Secure = conf.Secure
+		cookie.SameSite = conf.SameSite
+		http.SetCookie(c.Writer, cookie)
+	}
+}
+
+// PostCookieSession exchanges the JWT for a session cookie.
+func (conf *CookieConfig) PostCookieSession(c *gin.Context) {
+	token := c.MustGet("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	issuedAt, _ := numericDate(claims["iat"])
+
+	session := &model.CookieSession{
+		Iss:           c.GetString("iss"),
+		Sub:           c.GetString("sub"),
+		Email:         c.GetString("email"),
+		EmailVerified: c.GetBool("email_verified"),
+		DisplayName:   c.GetString("display_name"),
+		SessionID:     c.GetString("session_id"),
+		RevocationIDs: GetRevocationIDs(claims),
+		IssuedAt:      issuedAt,
+	}
+	if scopes, ok := c.Get(scopesContextKey); ok {
+		session.Scopes = scopes.([]string)
+	}
+
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	id, err := factory.NewCookieSessions().Create(session)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, err))
+		return
+	}
+
+	maxAge := int(session.ExpiresAt.Sub(util.GetTimeNow()) / time.Second)
+	conf.setCookies(c, id, session.CSRFToken, maxAge)
+	c.JSON(http.StatusOK, &model.CookieSessionCreated{
+		CSRFToken: session.CSRFToken,
+		ExpiresAt: session.ExpiresAt,
+	})
+}
+
+// DeleteCookieSession deletes the session and its cookies.
+func (conf *CookieConfig) DeleteCookieSession(c *gin.Context) {
+	_, id, _ := getSessionCookie(c)
+
+	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
+	if err := factory.NewCookieSessions().Delete(id); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, err))
+		return
+	}
+
+	conf.setCookies(c, "", "", -1)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,147 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// claimsAuthenticator accepts any token with the claims.
+type claimsAuthenticator struct {
+	claims jwt.MapClaims
+}
+
+func (a claimsAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+	return &jwt.Token{Claims: a.claims, Valid: true}, nil
+}
+
+// cookieSessionsMock stores cookie sessions in memory.
+type cookieSessionsMock struct {
+	store map[string]*model.CookieSession
+}
+
+func (sm *cookieSessionsMock) Create(session *model.CookieSession) (string, error) {
+	id := fmt.Sprintf("id-%d", len(sm.store))
+	session.CSRFToken = "csrf-" + id
+	session.ExpiresAt = time.Now().Add(time.Hour)
+	sm.store[id] = session
+	return id, nil
+}
+
+func (sm *cookieSessionsMock) Get(id string) (*model.CookieSession, error) {
+	session, ok := sm.store[id]
+	if !ok {
+		return nil, service.ErrCookieSessionNotFound
+	}
+	return session, nil
+}
+
+func (sm *cookieSessionsMock) Delete(id string) error {
+	delete(sm.store, id)
+	return nil
+}
+
+func TestCookieSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	conf := &server.CookieConfig{Name: "session", CSRFCookieName: "csrf_token", Secure: true, SameSite: http.SameSiteLaxMode}
+	cookies := &cookieSessionsMock{store: map[string]*model.CookieSession{
+		"revoked": {Sub: "abc", RevocationIDs: []string{"jti:revoked"}, CSRFToken: "csrf-revoked"},
+	}}
+	authenticator := claimsAuthenticator{jwt.MapClaims{"sub": "abc", "email": "foo@example.com", "jti": "j-1", "iat": float64(1516239022)}}
+
+	var authMethod string
+	r := gin.New()
+	r.Use(server.ServiceKeyMiddleware(&serviceFactoryMock{
+		cookies:  cookies,
+		sessions: sessionsMock{revoked: map[string]bool{"jti:revoked": true}},
+	}))
+	r.Use(server.SetAuth(authenticator, server.DefaultClaimMapping()))
+	r.Use(server.SetCookieAuth(conf))
+	r.POST("/session", server.AuthMiddleware(), server.RequireAuthMethod(server.AuthMethodJWT), conf.PostCookieSession)
+	r.DELETE("/session", server.AuthMiddleware(), server.RequireAuthMethod(server.AuthMethodCookie), conf.DeleteCookieSession)
+	r.Any("/me", server.AuthMiddleware(), func(c *gin.Context) {
+		authMethod = c.GetString("auth_method")
+		c.String(http.StatusOK, c.GetString("sub"))
+	})
+
+	// exchange JWT for a session cookie.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/session", nil)
+	req.Header.Set("Authorization", "Bearer dummy")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var created model.CookieSessionCreated
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "csrf-id-1", created.CSRFToken)
+	setCookies := w.Result().Cookies()
+	require.Len(t, setCookies, 2)
+	assert.Equal(t, "session", setCookies[0].Name)
+	assert.True(t, setCookies[0].HttpOnly)
+	assert.True(t, setCookies[0].Secure)
+	assert.Equal(t, "csrf_token", setCookies[1].Name)
+	assert.False(t, setCookies[1].HttpOnly)
+	assert.Equal(t, []string{"jti:j-1"}, cookies.store["id-1"].RevocationIDs)
+
+	tests := []struct {
+		name       string
+		method     string
+		session    string
+		csrfCookie string
+		csrfHeader string
+		wantStatus int
+	}{
+		{"safe method", "GET", "id-1", "", "", http.StatusOK},
+		{"unsafe method without CSRF token", "POST", "id-1", "csrf-id-1", "", http.StatusForbidden},
+		{"CSRF header differs from cookie", "POST", "id-1", "csrf-id-1", "forged", http.StatusForbidden},
+		{"CSRF token of another session", "POST", "id-1", "csrf-revoked", "csrf-revoked", http.StatusForbidden},
+		{"double-submit CSRF token", "POST", "id-1", "csrf-id-1", "csrf-id-1", http.StatusOK},
+		{"unknown session", "GET", "unknown", "", "", http.StatusUnauthorized},
+		{"revoked session", "GET", "revoked", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authMethod = ""
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/me", nil)
+			req.AddCookie(&http.Cookie{Name: "session", Value: tt.session})
+			if tt.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.csrfCookie})
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(server.CSRFTokenHeader, tt.csrfHeader)
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, server.AuthMethodCookie, authMethod)
+				assert.Equal(t, "abc", w.Body.String())
+			}
+		})
+	}
+
+	// log out.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/session", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "id-1"})
+	req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf-id-1"})
+	req.Header.Set(server.CSRFTokenHeader, "csrf-id-1")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.NotContains(t, cookies.store, "id-1")
+	for _, cookie := range w.Result().Cookies() {
+		assert.True(t, cookie.MaxAge < 0, "cookie %v should be deleted", cookie.Name)
+	}
+}
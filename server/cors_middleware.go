@@ -1,42 +1,263 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CORSMiddleware appends CORS headers
-func CORSMiddleware() gin.HandlerFunc {
-	var accessControlAllowHeaders = strings.Join(
-		[]string{
+const (
+	corsAllowOriginsEnv     = "CORS_ALLOW_ORIGINS"
+	corsAllowCredentialsEnv = "CORS_ALLOW_CREDENTIALS"
+	corsMaxAgeSecondEnv     = "CORS_MAX_AGE_SECOND"
+	corsConfigFileEnv       = "CORS_CONFIG_FILE"
+)
+
+// CORSConfig is a CORS policy.
+type CORSConfig struct {
+	// AllowOrigins are exact origins ("https://app.example.com"),
+	// wildcard subdomains ("https://*.example.com") or "*" for any origin.
+	AllowOrigins     []string `json:"allow_origins"`
+	AllowMethods     []string `json:"allow_methods"`
+	AllowHeaders     []string `json:"allow_headers"`
+	ExposeHeaders    []string `json:"expose_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	// MaxAgeSecond is how long preflight responses can be cached. 0 omits Access-Control-Max-Age.
+	MaxAgeSecond int `json:"max_age_second"`
+}
+
+// CORSGroupConfig overrides the CORS policy for paths under PathPrefix.
+type CORSGroupConfig struct {
+	PathPrefix string
+	Config     *CORSConfig
+}
+
+// CORSPolicy is the default CORS policy and its per-route-group overrides.
+type CORSPolicy struct {
+	Default *CORSConfig
+	Groups  []*CORSGroupConfig
+}
+
+// DefaultCORSConfig allows any origin without credentials.
+func DefaultCORSConfig() *CORSConfig {
+	return &CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders: []string{
 			"Origin",
 			"Content-Type",
 			"Content-Length",
 			"Accept-Encoding",
 			"X-CSRF-Token",
+			"X-Act-As",
+			"X-Request-ID",
+			"traceparent",
+			"Idempotency-Key",
 			"Authorization",
 		},
-		", ",
-	)
+		ExposeHeaders: []string{
+			"Content-Length",
+			"X-Request-ID",
+			"RateLimit-Limit",
+			"RateLimit-Remaining",
+			"RateLimit-Reset",
+			"RateLimit-Policy",
+			"Retry-After",
+			"Idempotent-Replayed",
+		},
+		MaxAgeSecond: 600,
+	}
+}
+
+// LoadCORSPolicyEnv initializes CORSPolicy using Environment Variables.
+//
+// CORS_CONFIG_FILE is a JSON of CORSConfig with "groups" to override it for path prefixes.
+// The groups inherit unspecified fields from the default policy.
+//
+//	{"allow_origins": ["https://app.example.com"], "allow_credentials": true,
+//	 "groups": [{"path_prefix": "/v1/fruits", "allow_origins": ["*"], "allow_credentials": false}]}
+func LoadCORSPolicyEnv() (*CORSPolicy, error) {
+	conf := DefaultCORSConfig()
+	if v := os.Getenv(corsAllowOriginsEnv); v != "" {
+		conf.AllowOrigins = splitComma(v)
+	}
+	if v := os.Getenv(corsAllowCredentialsEnv); v != "" {
+		conf.AllowCredentials = v == "true"
+	}
+	if v := os.Getenv(corsMaxAgeSecondEnv); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec < 0 {
+			return nil, fmt.Errorf("%v expects non-negative int value, but %v was given", corsMaxAgeSecondEnv, v)
+		}
+		conf.MaxAgeSecond = sec
+	}
+
+	policy := &CORSPolicy{Default: conf}
+	if filename := os.Getenv(corsConfigFileEnv); filename != "" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if policy, err = parseCORSPolicy(b, conf); err != nil {
+			return nil, fmt.Errorf("cannot parse %v: %v", corsConfigFileEnv, err)
+		}
+	}
+
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
 
+func parseCORSPolicy(b []byte, base *CORSConfig) (*CORSPolicy, error) {
+	var file struct {
+		Groups []json.RawMessage `json:"groups"`
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, err
+	}
+
+	conf := base.clone()
+	if err := json.Unmarshal(b, conf); err != nil {
+		return nil, err
+	}
+	policy := &CORSPolicy{Default: conf}
+
+	for _, raw := range file.Groups {
+		// unmarshal onto a copy of the default to inherit unspecified fields.
+		groupConf := conf.clone()
+		if err := json.Unmarshal(raw, groupConf); err != nil {
+			return nil, err
+		}
+		var group struct {
+			PathPrefix string `json:"path_prefix"`
+		}
+		if err := json.Unmarshal(raw, &group); err != nil {
+			return nil, err
+		}
+		if group.PathPrefix == "" {
+			return nil, fmt.Errorf("path_prefix is required for groups")
+		}
+		policy.Groups = append(policy.Groups, &CORSGroupConfig{PathPrefix: group.PathPrefix, Config: groupConf})
+	}
+	return policy, nil
+}
+
+// clone copies the config. json.Unmarshal reuses the backing arrays of slices.
+func (conf *CORSConfig) clone() *CORSConfig {
+	c := *conf
+	c.AllowOrigins = append([]string(nil), conf.AllowOrigins...)
+	c.AllowMethods = append([]string(nil), conf.AllowMethods...)
+	c.AllowHeaders = append([]string(nil), conf.AllowHeaders...)
+	c.ExposeHeaders = append([]string(nil), conf.ExposeHeaders...)
+	return &c
+}
+
+// validate rejects credentials for any origin, which browsers reject.
+func (p *CORSPolicy) validate() error {
+	confs := []*CORSConfig{p.Default}
+	for _, group := range p.Groups {
+		confs = append(confs, group.Config)
+	}
+	for _, conf := range confs {
+		if conf.AllowCredentials && containsAny([]string{"*"}, conf.AllowOrigins) {
+			return fmt.Errorf("CORS credentials can't be allowed for any origin \"*\". list allowed origins instead")
+		}
+	}
+	return nil
+}
+
+// configFor returns the policy of the longest matching path prefix.
+func (p *CORSPolicy) configFor(path string) *CORSConfig {
+	conf, matched := p.Default, ""
+	for _, group := range p.Groups {
+		prefix := strings.TrimSuffix(group.PathPrefix, "/")
+		if (path == prefix || strings.HasPrefix(path, prefix+"/")) && len(prefix) >= len(matched) {
+			conf, matched = group.Config, prefix
+		}
+	}
+	return conf
+}
+
+// allowOrigin returns Access-Control-Allow-Origin value for the origin.
+func (conf *CORSConfig) allowOrigin(origin string) (string, bool) {
+	for _, allowed := range conf.AllowOrigins {
+		if allowed == "*" {
+			return "*", true
+		}
+		if matchOrigin(allowed, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// matchOrigin matches an exact origin or a wildcard subdomain pattern like "https://*.example.com".
+func matchOrigin(pattern, origin string) bool {
+	if !strings.Contains(pattern, "*") {
+		return strings.EqualFold(pattern, origin)
+	}
+	parts := strings.SplitN(strings.ToLower(pattern), "*", 2)
+	prefix, suffix := parts[0], parts[1]
+	origin = strings.ToLower(origin)
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	// the wildcard matches subdomain labels only.
+	subdomain := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(subdomain, "/:@")
+}
+
+// CORSMiddleware appends CORS headers for allowed origins and responds to preflight requests.
+func CORSMiddleware(policy *CORSPolicy) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, UPDATE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", accessControlAllowHeaders)
-		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		conf := policy.configFor(c.Request.URL.Path)
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
 
-		if c.Request.Method == "GET" {
-			c.Writer.Header().Set("Access-Control-Max-Age", "0")
-		} else {
-			c.Writer.Header().Set("Access-Control-Max-Age", "0")
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if origin == "" {
+			c.Next()
+			return
 		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(200)
-		} else {
+		allowOrigin, ok := conf.allowOrigin(origin)
+		if !ok {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
 			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Origin", allowOrigin)
+		if conf.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", strings.Join(conf.AllowMethods, ", "))
+			header.Set("Access-Control-Allow-Headers", strings.Join(conf.AllowHeaders, ", "))
+			if conf.MaxAgeSecond > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(conf.MaxAgeSecond))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if len(conf.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(conf.ExposeHeaders, ", "))
 		}
+		c.Next()
 	}
 }
@@ -0,0 +1,93 @@
+package server_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dir, err := ioutil.TempDir("", "cors")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cors.json")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`{
+		"allow_origins": ["https://app.example.com", "https://*.example.com"],
+		"allow_credentials": true,
+		"groups": [{"path_prefix": "/v1/public", "allow_origins": ["*"], "allow_credentials": false}]
+	}`), 0600))
+	os.Setenv("CORS_CONFIG_FILE", filename)
+	defer os.Unsetenv("CORS_CONFIG_FILE")
+
+	policy, err := server.LoadCORSPolicyEnv()
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(server.CORSMiddleware(policy))
+	r.GET("/v1/fruits", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/v1/public/fruits", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		preflight       bool
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"exact origin", "GET", "/v1/fruits", "https://app.example.com", false, http.StatusOK, "https://app.example.com", "true"},
+		{"wildcard subdomain", "GET", "/v1/fruits", "https://admin.example.com", false, http.StatusOK, "https://admin.example.com", "true"},
+		{"nested subdomain", "GET", "/v1/fruits", "https://a.b.example.com", false, http.StatusOK, "https://a.b.example.com", "true"},
+		{"apex domain is not a subdomain", "GET", "/v1/fruits", "https://example.com", false, http.StatusOK, "", ""},
+		{"suffix attack", "GET", "/v1/fruits", "https://evil-example.com", false, http.StatusOK, "", ""},
+		{"other scheme", "GET", "/v1/fruits", "http://app.example.com", false, http.StatusOK, "", ""},
+		{"no origin", "GET", "/v1/fruits", "", false, http.StatusOK, "", ""},
+		{"preflight", "OPTIONS", "/v1/fruits", "https://app.example.com", true, http.StatusNoContent, "https://app.example.com", "true"},
+		{"preflight of disallowed origin", "OPTIONS", "/v1/fruits", "https://evil.com", true, http.StatusForbidden, "", ""},
+		{"group override", "GET", "/v1/public/fruits", "https://evil.com", false, http.StatusOK, "*", ""},
+		{"group override preflight", "OPTIONS", "/v1/public/fruits", "https://evil.com", true, http.StatusNoContent, "*", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.wantCredentials, w.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Contains(t, w.Header().Values("Vary"), "Origin")
+			if tt.preflight && tt.wantStatus == http.StatusNoContent {
+				assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+				assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+				assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func TestLoadCORSPolicyEnv_CredentialsForAnyOrigin(t *testing.T) {
+	os.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	defer os.Unsetenv("CORS_ALLOW_CREDENTIALS")
+
+	_, err := server.LoadCORSPolicyEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	devTokenIssuerEnv       = "DEV_TOKEN_ISSUER"
+	devTokenKeyFileEnv      = "DEV_TOKEN_KEY_FILE"
+	devTokenExpireSecondEnv = "DEV_TOKEN_EXPIRE_SECOND"
+
+	defaultDevTokenIssuer = "http://localhost:3000/dev"
+	devTokenAudience      = "dev"
+	devTokenKeyBits       = 2048
+)
+
+// DevTokenBody is a request body of POST /dev/token.
+type DevTokenBody struct {
+	Email  string   `json:"email" binding:"omitempty,email"`
+	Sub    string   `json:"sub" binding:"max=255"`
+	Name   string   `json:"name" binding:"max=255"`
+	Groups []string `json:"groups"`
+}
+
+// DevTokenIssuer signs ID tokens with a local key for development.
+// Its tokens are verified by the same path as the other issuers via its JWKS.
+type DevTokenIssuer struct {
+	issuer string
+	kid    string
+	key    *rsa.PrivateKey
+	expire time.Duration
+}
+
+// NewDevTokenIssuer initializes DevTokenIssuer with the signing key.
+func NewDevTokenIssuer(issuer string, key *rsa.PrivateKey, expire time.Duration) *DevTokenIssuer {
+	// kid is derived from the public key so that it changes with the key.
+	sum := sha256.Sum256(key.PublicKey.N.Bytes())
+	i := DevTokenIssuer{
+		issuer: issuer,
+		kid:    hex.EncodeToString(sum[:8]),
+		key:    key,
+		expire: expire,
+	}
+	return &i
+}
+
+// NewDevTokenIssuerEnv initializes DevTokenIssuer using Environment Variables.
+// The key is loaded from DEV_TOKEN_KEY_FILE (created if it does not exist),
+// or generated on every start when it is not set.
+func NewDevTokenIssuerEnv() (*DevTokenIssuer, error) {
+	logger := util.GetLogger()
+
+	issuer := os.Getenv(devTokenIssuerEnv)
+	if issuer == "" {
+		issuer = defaultDevTokenIssuer
+	}
+
+	expire := time.Hour
+	if v := os.Getenv(devTokenExpireSecondEnv); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec <= 0 {
+			return nil, fmt.Errorf("%v expects positive int value, but %v was given", devTokenExpireSecondEnv, v)
+		}
+		expire = time.Duration(sec) * time.Second
+	}
+
+	var key *rsa.PrivateKey
+	var err error
+	if keyFile := os.Getenv(devTokenKeyFileEnv); keyFile != "" {
+		key, err = loadOrCreateRSAKey(keyFile)
+	} else {
+		logger.Warnf("%v is not set. dev tokens are invalidated on restart.", devTokenKeyFileEnv)
+		key, err = rsa.GenerateKey(rand.Reader, devTokenKeyBits)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Warnf("development token issuer %v is enabled. never use this build in production.", issuer)
+	return NewDevTokenIssuer(issuer, key, expire), nil
+}
+
+// loadOrCreateRSAKey loads PKCS#1 PEM private key, or generates and saves a new one.
+func loadOrCreateRSAKey(filename string) (*rsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("%v is not PEM encoded", filename)
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, devTokenKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return nil, err
+	}
+	b = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(filename, b, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Audience returns "aud" claim of the tokens.
+func (i *DevTokenIssuer) Audience() string {
+	return devTokenAudience
+}
+
+// Issuer returns "iss" claim of the tokens.
+func (i *DevTokenIssuer) Issuer() string {
+	return i.issuer
+}
+
+// JWKS returns the public key set to verify the tokens.
+func (i *DevTokenIssuer) JWKS() (*JWKS, error) {
+	jwk, err := NewJWK(i.kid, &i.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &JWKS{Keys: []JWK{*jwk}}, nil
+}
+
+// Issue signs an ID token for the user.
+// "sub" defaults to a value derived from the email.
+func (i *DevTokenIssuer) Issue(body *DevTokenBody) (string, error) {
+	sub := body.Sub
+	if sub == "" {
+		if body.Email == "" {
+			return "", fmt.Errorf("email or sub is required")
+		}
+		sum := sha256.Sum256([]byte(body.Email))
+		sub = "dev-" + hex.EncodeToString(sum[:16])
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := util.GetTimeNow()
+	claims := jwt.MapClaims{
+		"iss":       i.issuer,
+		"sub":       sub,
+		"aud":       devTokenAudience,
+		"token_use": "id",
+		"iat":       now.Unix(),
+		"exp":       now.Add(i.expire).Unix(),
+		"jti":       base64.RawURLEncoding.EncodeToString(jti),
+	}
+	if body.Email != "" {
+		claims["email"] = body.Email
+		claims["email_verified"] = true
+	}
+	if body.Name != "" {
+		claims["name"] = body.Name
+	}
+	if len(body.Groups) > 0 {
+		claims["groups"] = body.Groups
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = i.kid
+	return token.SignedString(i.key)
+}
+
+// PostToken handles POST /dev/token.
+func (i *DevTokenIssuer) PostToken(c *gin.Context) {
+	var body DevTokenBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, err.Error()))
+		return
+	}
+	token, err := i.Issue(&body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id_token":   token,
+		"token_type": "Bearer",
+		"expires_in": int(i.expire.Seconds()),
+	})
+}
+
+// GetJWKS handles GET /dev/.well-known/jwks.json.
+func (i *DevTokenIssuer) GetJWKS(c *gin.Context) {
+	jwks, err := i.JWKS()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, model.NewErrorResponse("500", model.ErrorUnknown, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, jwks)
+}
+
+// GetOpenIDConfiguration handles GET /dev/.well-known/openid-configuration.
+func (i *DevTokenIssuer) GetOpenIDConfiguration(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                i.issuer,
+		"jwks_uri":                              i.issuer + "/.well-known/jwks.json",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
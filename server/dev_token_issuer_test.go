@@ -0,0 +1,96 @@
+package server_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevTokenIssuer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	r := gin.New()
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	issuer := server.NewDevTokenIssuer(ts.URL+"/dev", key, time.Hour)
+	r.POST("/dev/token", issuer.PostToken)
+	r.GET("/dev/.well-known/jwks.json", issuer.GetJWKS)
+	r.GET("/dev/.well-known/openid-configuration", issuer.GetOpenIDConfiguration)
+
+	// verified by discovery like any other issuer.
+	authenticator, err := server.NewOIDCAuthenticator(&server.OIDCIssuerConfig{Issuer: issuer.Issuer(), Audience: []string{issuer.Audience()}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantClaims jwt.MapClaims
+	}{
+		{
+			name:       "email and groups",
+			body:       `{"email":"foo@example.com","groups":["admin"]}`,
+			wantStatus: http.StatusOK,
+			wantClaims: jwt.MapClaims{"email": "foo@example.com", "groups": []interface{}{"admin"}, "aud": issuer.Audience(), "token_use": "id"},
+		},
+		{
+			name:       "sub",
+			body:       `{"sub":"user-1","name":"Foo"}`,
+			wantStatus: http.StatusOK,
+			wantClaims: jwt.MapClaims{"sub": "user-1", "name": "Foo"},
+		},
+		{"neither email nor sub", `{}`, http.StatusBadRequest, nil},
+		{"invalid email", `{"email":"foo"}`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Post(ts.URL+"/dev/token", "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				IDToken string `json:"id_token"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+
+			token, err := authenticator.ValidateToken(body.IDToken)
+			require.NoError(t, err)
+			claims := token.Claims.(jwt.MapClaims)
+			assert.Equal(t, issuer.Issuer(), claims["iss"])
+			assert.NotEmpty(t, claims["sub"])
+			assert.NotEmpty(t, claims["jti"])
+			for k, v := range tt.wantClaims {
+				assert.Equal(t, v, claims[k], k)
+			}
+		})
+	}
+
+	t.Run("forged token", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		forged := server.NewDevTokenIssuer(issuer.Issuer(), other, time.Hour)
+		token, err := forged.Issue(&server.DevTokenBody{Email: "foo@example.com"})
+		require.NoError(t, err)
+		_, err = authenticator.ValidateToken(token)
+		assert.Error(t, err)
+	})
+}
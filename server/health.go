@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	healthOptionalDependenciesEnv = "HEALTH_OPTIONAL_DEPENDENCIES"
+	healthCheckTimeoutMillisEnv   = "HEALTH_CHECK_TIMEOUT_MILLIS"
+
+	defaultHealthCheckTimeout = time.Second
+
+	// LivenessPath is the path of the process liveness probe.
+	LivenessPath = "/healthz"
+	// ReadinessPath is the path of the readiness probe checking dependencies.
+	ReadinessPath = "/readyz"
+)
+
+// health statuses.
+const (
+	HealthStatusOK = "ok"
+	// HealthStatusDegraded means optional dependencies are down, but the server is ready.
+	HealthStatusDegraded     = "degraded"
+	HealthStatusUnavailable  = "unavailable"
+	HealthStatusShuttingDown = "shutting_down"
+)
+
+// Dependency is a dependency checked by readiness.
+type Dependency struct {
+	Name string
+	// Critical dependencies make the server not ready when they are down.
+	Critical bool
+	Check    func(ctx context.Context) error
+}
+
+// DependencyStatus is the result of a dependency check.
+type DependencyStatus struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the response of readiness.
+type ReadinessResponse struct {
+	Status       string                       `json:"status"`
+	Dependencies map[string]*DependencyStatus `json:"dependencies,omitempty"`
+}
+
+// Health serves liveness and readiness probes.
+type Health struct {
+	dependencies []*Dependency
+	timeout      time.Duration
+	shuttingDown int32
+}
+
+// NewHealth initializes probes checking dependencies with the timeout.
+func NewHealth(timeout time.Duration, dependencies ...*Dependency) *Health {
+	return &Health{dependencies: dependencies, timeout: timeout}
+}
+
+// NewHealthEnv initializes probes with critical dependencies,
+// made optional by HEALTH_OPTIONAL_DEPENDENCIES (comma separated names).
+func NewHealthEnv(dependencies ...*Dependency) (*Health, error) {
+	timeout := defaultHealthCheckTimeout
+	if v := os.Getenv(healthCheckTimeoutMillisEnv); v != "" {
+		millis, err := strconv.Atoi(v)
+		if err != nil || millis <= 0 {
+			return nil, fmt.Errorf("%v expects positive int value, but %v was given", healthCheckTimeoutMillisEnv, v)
+		}
+		timeout = time.Duration(millis) * time.Millisecond
+	}
+
+	optional := map[string]bool{}
+	for _, name := range strings.Split(os.Getenv(healthOptionalDependenciesEnv), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			optional[name] = true
+		}
+	}
+	for _, d := range dependencies {
+		d.Critical = !optional[d.Name]
+		delete(optional, d.Name)
+	}
+	for name := range optional {
+		return nil, fmt.Errorf("%v has unknown dependency %v", healthOptionalDependenciesEnv, name)
+	}
+	return NewHealth(timeout, dependencies...), nil
+}
+
+// SetShuttingDown makes readiness fail, so that load balancers stop sending requests.
+func (h *Health) SetShuttingDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// IsShuttingDown returns true after SetShuttingDown.
+func (h *Health) IsShuttingDown() bool {
+	return atomic.LoadInt32(&h.shuttingDown) == 1
+}
+
+// Liveness returns ok while the process can serve requests, without checking dependencies.
+func (h *Health) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": HealthStatusOK})
+}
+
+// Readiness checks dependencies concurrently.
+// It returns 503 Service Unavailable when a critical dependency is down or the server is shutting down.
+func (h *Health) Readiness(c *gin.Context) {
+	if h.IsShuttingDown() {
+		c.JSON(http.StatusServiceUnavailable, &ReadinessResponse{Status: HealthStatusShuttingDown})
+		return
+	}
+
+	res := h.Check(c.Request.Context())
+	code := http.StatusOK
+	if res.Status == HealthStatusUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, res)
+}
+
+// Check checks all dependencies, each within the timeout.
+func (h *Health) Check(ctx context.Context) *ReadinessResponse {
+	statuses := make([]*DependencyStatus, len(h.dependencies))
+	var wg sync.WaitGroup
+	for i, d := range h.dependencies {
+		wg.Add(1)
+		go func(i int, d *Dependency) {
+			defer wg.Done()
+			statuses[i] = h.check(ctx, d)
+		}(i, d)
+	}
+	wg.Wait()
+
+	res := &ReadinessResponse{Status: HealthStatusOK, Dependencies: map[string]*DependencyStatus{}}
+	for i, d := range h.dependencies {
+		s := statuses[i]
+		res.Dependencies[d.Name] = s
+		if s.Status == HealthStatusOK {
+			continue
+		}
+		if d.Critical {
+			res.Status = HealthStatusUnavailable
+		} else if res.Status == HealthStatusOK {
+			res.Status = HealthStatusDegraded
+		}
+	}
+	return res
+}
+
+func (h *Health) check(ctx context.Context, d *Dependency) *DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// some drivers ignore the context.
+		err = ctx.Err()
+	}
+
+	s := &DependencyStatus{
+		Status:    HealthStatusOK,
+		Critical:  d.Critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		util.GetLogger().Warnf("health check of %v failed: %v", d.Name, err)
+		s.Status = HealthStatusUnavailable
+		s.Error = err.Error()
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func healthy(ctx context.Context) error { return nil }
+
+func unhealthy(ctx context.Context) error { return errors.New("connection refused") }
+
+func hanging(ctx context.Context) error {
+	time.Sleep(time.Second)
+	return nil
+}
+
+func TestHealth_Readiness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		dependencies []*server.Dependency
+		shutdown     bool
+		wantCode     int
+		wantStatus   string
+		wantDeps     map[string]string
+	}{
+		{
+			name: "all up",
+			dependencies: []*server.Dependency{
+				{Name: "mysql", Critical: true, Check: healthy},
+				{Name: "redis", Critical: true, Check: healthy},
+			},
+			wantCode: http.StatusOK, wantStatus: server.HealthStatusOK,
+			wantDeps: map[string]string{"mysql": server.HealthStatusOK, "redis": server.HealthStatusOK},
+		},
+		{
+			name: "critical down",
+			dependencies: []*server.Dependency{
+				{Name: "mysql", Critical: true, Check: unhealthy},
+				{Name: "redis", Critical: false, Check: healthy},
+			},
+			wantCode: http.StatusServiceUnavailable, wantStatus: server.HealthStatusUnavailable,
+			wantDeps: map[string]string{"mysql": server.HealthStatusUnavailable, "redis": server.HealthStatusOK},
+		},
+		{
+			name: "optional down",
+			dependencies: []*server.Dependency{
+				{Name: "mysql", Critical: true, Check: healthy},
+				{Name: "redis", Critical: false, Check: unhealthy},
+			},
+			wantCode: http.StatusOK, wantStatus: server.HealthStatusDegraded,
+			wantDeps: map[string]string{"mysql": server.HealthStatusOK, "redis": server.HealthStatusUnavailable},
+		},
+		{
+			name: "critical timeout",
+			dependencies: []*server.Dependency{
+				{Name: "mysql", Critical: true, Check: hanging},
+			},
+			wantCode: http.StatusServiceUnavailable, wantStatus: server.HealthStatusUnavailable,
+			wantDeps: map[string]string{"mysql": server.HealthStatusUnavailable},
+		},
+		{
+			name: "shutting down",
+			dependencies: []*server.Dependency{
+				{Name: "mysql", Critical: true, Check: healthy},
+			},
+			shutdown: true,
+			wantCode: http.StatusServiceUnavailable, wantStatus: server.HealthStatusShuttingDown,
+			wantDeps: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := server.NewHealth(50*time.Millisecond, tt.dependencies...)
+			if tt.shutdown {
+				health.SetShuttingDown()
+			}
+			r := gin.New()
+			r.GET(server.ReadinessPath, health.Readiness)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", server.ReadinessPath, nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			var res server.ReadinessResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			assert.Equal(t, tt.wantStatus, res.Status)
+			assert.Len(t, res.Dependencies, len(tt.wantDeps))
+			for name, status := range tt.wantDeps {
+				require.Contains(t, res.Dependencies, name)
+				assert.Equal(t, status, res.Dependencies[name].Status, name)
+				assert.Less(t, res.Dependencies[name].LatencyMS, float64(500), name)
+				if status != server.HealthStatusOK {
+					assert.NotEmpty(t, res.Dependencies[name].Error, name)
+				}
+			}
+		})
+	}
+}
+
+func TestHealth_Liveness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	health := server.NewHealth(time.Second, &server.Dependency{Name: "mysql", Critical: true, Check: unhealthy})
+	health.SetShuttingDown()
+	r := gin.New()
+	r.GET(server.LivenessPath, health.Liveness)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", server.LivenessPath, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestNewHealthEnv(t *testing.T) {
+	mysql := &server.Dependency{Name: "mysql", Check: healthy}
+	redis := &server.Dependency{Name: "redis", Check: healthy}
+	_, err := server.NewHealthEnv(mysql, redis)
+	require.NoError(t, err)
+	assert.True(t, mysql.Critical)
+	assert.True(t, redis.Critical)
+
+	os.Setenv("HEALTH_OPTIONAL_DEPENDENCIES", "redis")
+	defer os.Unsetenv("HEALTH_OPTIONAL_DEPENDENCIES")
+	_, err = server.NewHealthEnv(mysql, redis)
+	require.NoError(t, err)
+	assert.True(t, mysql.Critical)
+	assert.False(t, redis.Critical)
+
+	os.Setenv("HEALTH_OPTIONAL_DEPENDENCIES", "postgres")
+	_, err = server.NewHealthEnv(mysql, redis)
+	assert.Error(t, err)
+
+	os.Setenv("HEALTH_OPTIONAL_DEPENDENCIES", "")
+	os.Setenv("HEALTH_CHECK_TIMEOUT_MILLIS", "-1")
+	defer os.Unsetenv("HEALTH_CHECK_TIMEOUT_MILLIS")
+	_, err = server.NewHealthEnv(mysql, redis)
+	assert.Error(t, err)
+}
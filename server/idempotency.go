@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	idempotencyTTLSecondEnv = "IDEMPOTENCY_TTL_SECOND"
+
+	// IdempotencyKeyHeader is a request header to retry POST requests safely.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set to responses replayed by Idempotency-Key.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+var idempotencyContextKey = "idempotency"
+
+var idempotencyKeyPattern = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+
+// IdempotencyConfig is how long idempotency keys are kept.
+type IdempotencyConfig struct {
+	// TTL is how long the first response is replayed.
+	TTL time.Duration
+	// LockTTL releases keys of requests which never finished, e.g. by a crash.
+	LockTTL time.Duration
+}
+
+// LoadIdempotencyConfigEnv initializes IdempotencyConfig using Environment Variables.
+func LoadIdempotencyConfigEnv() (*IdempotencyConfig, error) {
+	conf := &IdempotencyConfig{TTL: 24 * time.Hour, LockTTL: time.Minute}
+	if v := os.Getenv(idempotencyTTLSecondEnv); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec <= 0 {
+			return nil, fmt.Errorf("%v expects positive int value, but %v was given", idempotencyTTLSecondEnv, v)
+		}
+		conf.TTL = time.Duration(sec) * time.Second
+	}
+	return conf, nil
+}
+
+// idempotencyRecord is the state of an idempotency key.
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	// Done is false while the first request is in flight.
+	Done   bool        `json:"done"`
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// idempotencyLockScript stores the in-flight record only if the key is new.
+// KEYS[1]: key, ARGV: record, lock TTL seconds.
+// returns {1} if locked, {0} if the key exists.
+var idempotencyLockScript = infra.NewKVSScript(1, `
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'EX', ARGV[2]) then
+  return {1}
+end
+return {0}
+`)
+
+type idempotencyContext struct {
+	kvsClient infra.KVSClientInterface
+	conf      *IdempotencyConfig
+}
+
+// SetIdempotency passes the key-value store keeping responses to Idempotent middlewares.
+func SetIdempotency(kvsClient infra.KVSClientInterface, conf *IdempotencyConfig) gin.HandlerFunc {
+	ic := &idempotencyContext{kvsClient, conf}
+	return func(c *gin.Context) {
+		c.Set(idempotencyContextKey, ic)
+		c.Next()
+	}
+}
+
+// Idempotent replays the first response to requests with the same Idempotency-Key,
+// so that clients can retry POST requests without duplicates.
+// Keys are scoped by the client, the method and the route.
+// It returns 409 while the first request is in flight, and 422 when the key is reused for a different payload.
+// Server errors and panics are not stored, to be retried.
+func Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		v, ok := c.Get(idempotencyContextKey)
+		if key == "" || !ok {
+			c.Next()
+			return
+		}
+		ic := v.(*idempotencyContext)
+		if !idempotencyKeyPattern.MatchString(key) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam,
+				fmt.Sprintf("%v must be 1 to 255 visible ASCII characters", IdempotencyKeyHeader)))
+			return
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, model.NewErrorResponse("400", model.ErrorParam, err))
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		fingerprint := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.RequestURI()+"\n"), body...))
+		record := &idempotencyRecord{Fingerprint: hex.EncodeToString(fingerprint[:])}
+
+		kvsKey := fmt.Sprintf("idempotency/%v/%v %v/%v", idempotencyScope(c), c.Request.Method, c.FullPath(), key)
+		lock, _ := json.Marshal(record)
+		values, err := ic.kvsClient.EvalInts(idempotencyLockScript, []string{kvsKey}, string(lock), int64(ic.conf.LockTTL/time.Second))
+		if err != nil || len(values) != 1 {
+			// not to stop the service by the key-value store.
+			util.GetLogger().Warnf("%v %v is skipped: %v", IdempotencyKeyHeader, key, err)
+			c.Next()
+			return
+		}
+		if values[0] == 0 {
+			replayIdempotentResponse(c, ic.kvsClient, kvsKey, record.Fingerprint)
+			return
+		}
+
+		w := &idempotencyWriter{ResponseWriter: c.Writer}
+		header := c.Writer.Header().Clone()
+		c.Writer = w
+		defer func() {
+			// a panic is a server error, which releases the key, then goes on to RecoveryMiddleware.
+			if v := recover(); v != nil {
+				releaseIdempotencyKey(ic.kvsClient, kvsKey, key)
+				panic(v)
+			}
+
+			status := w.Status()
+			if status >= http.StatusInternalServerError {
+				releaseIdempotencyKey(ic.kvsClient, kvsKey, key)
+				return
+			}
+			record.Done = true
+			record.Status = status
+			record.Header = changedHeader(header, w.Header())
+			record.Body = w.body.Bytes()
+			if err := ic.kvsClient.SetStructWithExpire(kvsKey, record, ic.conf.TTL); err != nil {
+				util.GetLogger().Warnf("failed to store the response of %v %v: %v", IdempotencyKeyHeader, key, err)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// releaseIdempotencyKey deletes the key of a failed request, to be retried.
+func releaseIdempotencyKey(kvsClient infra.KVSClientInterface, kvsKey, key string) {
+	if err := kvsClient.Delete(kvsKey); err != nil {
+		util.GetLogger().Warnf("failed to release %v %v: %v", IdempotencyKeyHeader, key, err)
+	}
+}
+
+func replayIdempotentResponse(c *gin.Context, kvsClient infra.KVSClientInterface, kvsKey, fingerprint string) {
+	var record idempotencyRecord
+	err := kvsClient.GetStruct(kvsKey, &record)
+	if err == infra.ErrKVSNotFound {
+		// released between the lock and here. the retry will take the lock.
+		record = idempotencyRecord{Fingerprint: fingerprint}
+	} else if err != nil {
+		util.GetLogger().Warnf("failed to load %v: %v", kvsKey, err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, model.NewErrorResponse("503", model.ErrorUnknown,
+			"cannot check the idempotency key. please retry later"))
+		return
+	}
+
+	if record.Fingerprint != fingerprint {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, model.NewErrorResponse("422", model.ErrorParam,
+			fmt.Sprintf("%v was already used for a different request", IdempotencyKeyHeader)))
+		return
+	}
+	if !record.Done {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusConflict, model.NewErrorResponse("409", model.ErrorConflict,
+			fmt.Sprintf("a request with the same %v is in progress", IdempotencyKeyHeader)))
+		return
+	}
+
+	header := c.Writer.Header()
+	for name, values := range record.Header {
+		header[name] = values
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+	c.Writer.WriteHeader(record.Status)
+	c.Writer.Write(record.Body)
+	c.Abort()
+}
+
+// idempotencyScope identifies the authenticated client of the request, or the client IP.
+// Anonymous clients are not to replay responses of others, even if a retry from another IP is not replayed.
+func idempotencyScope(c *gin.Context) string {
+	if key, ok := clientKey(c); ok {
+		return key
+	}
+	return "ip:" + ClientIP(c)
+}
+
+// unreplayedHeaders describe the encoding of the first response, e.g. by CompressionMiddleware,
+// not the stored body, which is encoded again on replay.
+var unreplayedHeaders = map[string]bool{
+	IdempotentReplayedHeader: true,
+	"Content-Encoding":       true,
+	"Content-Length":         true,
+	"Transfer-Encoding":      true,
+	"Vary":                   true,
+}
+
+// changedHeader returns header fields set by handlers, not by middlewares for each request.
+func changedHeader(before, after http.Header) http.Header {
+	changed := http.Header{}
+	for name, values := range after {
+		if unreplayedHeaders[name] {
+			continue
+		}
+		if prev, ok := before[name]; !ok || fmt.Sprint(prev) != fmt.Sprint(values) {
+			changed[name] = values
+		}
+	}
+	return changed
+}
+
+// idempotencyWriter keeps a copy of the body to replay.
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
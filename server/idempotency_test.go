@@ -0,0 +1,225 @@
+package server_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryKVS stores JSON values like KVSClient. EvalInts sets the value only if the key is new.
+type memoryKVS struct {
+	infra.KVSClientInterface
+	mu    sync.Mutex
+	store map[string]string
+	err   error
+}
+
+func newMemoryKVS() *memoryKVS {
+	return &memoryKVS{store: map[string]string{}}
+}
+
+func (kvs *memoryKVS) SetStructWithExpire(key string, structPtr interface{}, expire time.Duration) error {
+	b, err := json.Marshal(structPtr)
+	if err != nil {
+		return err
+	}
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	kvs.store[key] = string(b)
+	return nil
+}
+
+func (kvs *memoryKVS) GetStruct(key string, structPtr interface{}) error {
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	v, ok := kvs.store[key]
+	if !ok {
+		return infra.ErrKVSNotFound
+	}
+	return json.Unmarshal([]byte(v), structPtr)
+}
+
+func (kvs *memoryKVS) Delete(key string) error {
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	delete(kvs.store, key)
+	return nil
+}
+
+func (kvs *memoryKVS) EvalInts(script *infra.KVSScript, keys []string, args ...interface{}) ([]int64, error) {
+	if kvs.err != nil {
+		return nil, kvs.err
+	}
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	if _, ok := kvs.store[keys[0]]; ok {
+		return []int64{0}, nil
+	}
+	kvs.store[keys[0]] = args[0].(string)
+	return []int64{1}, nil
+}
+
+func TestIdempotent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	kvs := newMemoryKVS()
+	conf, err := server.LoadIdempotencyConfigEnv()
+	require.NoError(t, err)
+
+	var created int
+	release := make(chan struct{})
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	r := gin.New()
+	r.Use(server.RecoveryMiddleware(logger, &reportRecorder{}))
+	r.Use(server.SetIdempotency(kvs, conf))
+	r.POST("/fruits", server.Idempotent(), func(c *gin.Context) {
+		created++
+		c.Header("Location", "/fruits/1")
+		c.JSON(http.StatusCreated, gin.H{"id": created})
+	})
+	r.POST("/slow", server.Idempotent(), func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusCreated)
+	})
+	r.POST("/fail", server.Idempotent(), func(c *gin.Context) {
+		created++
+		c.Status(http.StatusInternalServerError)
+	})
+	r.POST("/panic", server.Idempotent(), func(c *gin.Context) {
+		created++
+		panic("something wrong")
+	})
+
+	postFrom := func(ip, path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.RemoteAddr = ip + ":12345"
+		if key != "" {
+			req.Header.Set(server.IdempotencyKeyHeader, key)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		return postFrom("192.0.2.1", path, key, body)
+	}
+
+	assert := assert.New(t)
+
+	// the first response is replayed.
+	w := post("/fruits", "key-1", `{"name":"apple"}`)
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.Empty(w.Header().Get(server.IdempotentReplayedHeader))
+	w = post("/fruits", "key-1", `{"name":"apple"}`)
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.Equal("true", w.Header().Get(server.IdempotentReplayedHeader))
+	assert.Equal("/fruits/1", w.Header().Get("Location"))
+	assert.Equal(gin.MIMEJSON+"; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(`{"id":1}`, w.Body.String())
+	assert.Equal(1, created)
+
+	// a different payload
+	w = post("/fruits", "key-1", `{"name":"banana"}`)
+	assert.Equal(http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(1, created)
+
+	// other keys and requests without keys
+	assert.Equal(http.StatusCreated, post("/fruits", "key-2", `{"name":"apple"}`).Code)
+	assert.Equal(http.StatusCreated, post("/fruits", "", `{"name":"apple"}`).Code)
+	assert.Equal(3, created)
+
+	// anonymous clients don't share keys.
+	w = postFrom("192.0.2.2", "/fruits", "key-1", `{"name":"banana"}`)
+	assert.Equal(http.StatusCreated, w.Code)
+	assert.Empty(w.Header().Get(server.IdempotentReplayedHeader))
+	assert.JSONEq(`{"id":4}`, w.Body.String())
+
+	// invalid key
+	assert.Equal(http.StatusBadRequest, post("/fruits", strings.Repeat("a", 256), `{}`).Code)
+
+	// in flight
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post("/slow", "key-3", `{}`) }()
+	require.Eventually(t, func() bool {
+		kvs.mu.Lock()
+		defer kvs.mu.Unlock()
+		return len(kvs.store) == 4
+	}, time.Second, time.Millisecond)
+	w = post("/slow", "key-3", `{}`)
+	assert.Equal(http.StatusConflict, w.Code)
+	assert.Equal("1", w.Header().Get("Retry-After"))
+	var res model.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(model.ErrorConflict, res.Errors[0].Type)
+	close(release)
+	assert.Equal(http.StatusCreated, (<-done).Code)
+	assert.Equal(http.StatusCreated, post("/slow", "key-3", `{}`).Code)
+
+	// server errors can be retried.
+	created = 0
+	assert.Equal(http.StatusInternalServerError, post("/fail", "key-4", `{}`).Code)
+	assert.Equal(http.StatusInternalServerError, post("/fail", "key-4", `{}`).Code)
+	assert.Equal(2, created)
+
+	// panics release the key too.
+	created = 0
+	assert.Equal(http.StatusInternalServerError, post("/panic", "key-5", `{}`).Code)
+	assert.Equal(http.StatusInternalServerError, post("/panic", "key-5", `{}`).Code)
+	assert.Equal(2, created)
+
+	// the key-value store is down.
+	kvs.err = errors.New("not connected")
+	assert.Equal(http.StatusCreated, post("/fruits", "key-1", `{"name":"apple"}`).Code)
+	assert.Equal(3, created)
+}
+
+func TestIdempotent_Compressed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	conf, err := server.LoadIdempotencyConfigEnv()
+	require.NoError(t, err)
+	large := strings.Repeat("apple ", 1000)
+	r := gin.New()
+	r.Use(server.CompressionMiddleware(server.DefaultCompressionConfig()))
+	r.Use(server.SetIdempotency(newMemoryKVS(), conf))
+	r.POST("/fruits", server.Idempotent(), func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"name": large})
+	})
+
+	for _, encoding := range []string{"gzip", "gzip", ""} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/fruits", strings.NewReader(`{}`))
+		req.Header.Set(server.IdempotencyKeyHeader, "key-1")
+		req.Header.Set("Accept-Encoding", encoding)
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+
+		body := w.Body.Bytes()
+		if encoding == "gzip" {
+			zr, err := gzip.NewReader(w.Body)
+			require.NoError(t, err)
+			body, err = ioutil.ReadAll(zr)
+			require.NoError(t, err)
+		}
+		var res struct{ Name string }
+		require.NoError(t, json.Unmarshal(body, &res))
+		assert.Equal(t, large, res.Name)
+	}
+}
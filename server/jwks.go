@@ -0,0 +1,219 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwksMinRefreshInterval limits JWKS reloading triggered by unknown kid.
+const jwksMinRefreshInterval = time.Minute
+
+// JWK is a JSON Web Key (RFC 7517) of RSA or EC public key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK converts a RSA or ECDSA public key into JWK.
+func NewJWK(kid string, publicKey interface{}) (*JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported curve %v", key.Curve.Params().Name)
+		}
+		return &JWK{
+			Kty: "EC",
+			Kid: kid,
+			Use: "sig",
+			Alg: "ES256",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+}
+
+// PublicKey converts JWK into *rsa.PublicKey or *ecdsa.PublicKey.
+func (k *JWK) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %v", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %v", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// LoadJWKSFile loads JWKS from a local file.
+func LoadJWKSFile(filename string) (*JWKS, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	jwks := &JWKS{}
+	if err := json.Unmarshal(b, jwks); err != nil {
+		return nil, fmt.Errorf("cannot parse JWKS file %v: %v", filename, err)
+	}
+	return jwks, nil
+}
+
+// FetchJWKS downloads JWKS from the url.
+func FetchJWKS(url string) (*JWKS, error) {
+	jwks := &JWKS{}
+	if err := getJSON(url, jwks); err != nil {
+		return nil, err
+	}
+	return jwks, nil
+}
+
+func getJSON(url string, target interface{}) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %v returned status %v", url, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(target)
+}
+
+// keySet holds public keys by kid and reloads them when an unknown kid comes.
+type keySet struct {
+	mu         sync.RWMutex
+	keys       map[string]interface{}
+	load       func() (*JWKS, error)
+	loadedAt   time.Time
+	refreshing sync.Mutex
+}
+
+func newKeySet(load func() (*JWKS, error)) (*keySet, error) {
+	ks := &keySet{load: load}
+	if err := ks.refresh(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func (ks *keySet) refresh() error {
+	jwks, err := ks.load()
+	if err != nil {
+		return err
+	}
+	keys := map[string]interface{}{}
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			// skip unsupported keys like "oct".
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.loadedAt = time.Now()
+	ks.mu.Unlock()
+	return nil
+}
+
+// get returns the public key of kid.
+// Empty kid is allowed only when the key set has a single key.
+func (ks *keySet) get(kid string) (interface{}, error) {
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+
+	// keys may have been rotated.
+	ks.refreshing.Lock()
+	defer ks.refreshing.Unlock()
+	ks.mu.RLock()
+	loadedAt := ks.loadedAt
+	ks.mu.RUnlock()
+	if time.Since(loadedAt) >= jwksMinRefreshInterval {
+		if err := ks.refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no JSON Web Key matched for kid: %v", kid)
+}
+
+func (ks *keySet) lookup(kid string) (interface{}, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	shutdownDelayEnv       = "SHUTDOWN_DELAY_SECOND"
+	shutdownStepTimeoutEnv = "SHUTDOWN_STEP_TIMEOUT_SECOND"
+)
+
+// ShutdownPhase orders steps of graceful shutdown.
+type ShutdownPhase int
+
+// shutdown phases in order.
+const (
+	// PhaseReadiness fails readiness and waits for load balancers to stop sending requests.
+	PhaseReadiness ShutdownPhase = iota
+	// PhaseDrain waits for in-flight requests.
+	PhaseDrain
+	// PhaseWorkers stops background workers.
+	PhaseWorkers
+	// PhaseClients closes clients of the key-value store and the database.
+	PhaseClients
+)
+
+// ShutdownConfig is how long each step of graceful shutdown can take.
+type ShutdownConfig struct {
+	// Delay is the pre-stop delay after readiness fails.
+	Delay time.Duration
+	// DrainTimeout is for in-flight requests.
+	DrainTimeout time.Duration
+	// StepTimeout is for each of the other steps.
+	StepTimeout time.Duration
+}
+
+// LoadShutdownConfigEnv initializes ShutdownConfig using Environment Variables.
+func LoadShutdownConfigEnv() *ShutdownConfig {
+	loadSecond := func(env string, defaultSec int) time.Duration {
+		v := os.Getenv(env)
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec < 0 {
+			if v != "" {
+				util.GetLogger().Warnf("%v expects int value, but %v was given. use default %v [sec]", env, v, defaultSec)
+			}
+			sec = defaultSec
+		}
+		return time.Duration(sec) * time.Second
+	}
+	return &ShutdownConfig{
+		Delay:        loadSecond(shutdownDelayEnv, 0),
+		DrainTimeout: loadSecond(shutdownTimeoutEnv, 5),
+		StepTimeout:  loadSecond(shutdownStepTimeoutEnv, 5),
+	}
+}
+
+// Lifecycle runs shutdown steps of the server in order of phases.
+// Steps of the same phase run in reverse order of registration, like defer.
+type Lifecycle struct {
+	steps []*shutdownStep
+}
+
+type shutdownStep struct {
+	phase   ShutdownPhase
+	name    string
+	timeout time.Duration
+	stop    func(ctx context.Context) error
+}
+
+// OnShutdown registers a step. stop gets a context which expires in the timeout.
+func (l *Lifecycle) OnShutdown(phase ShutdownPhase, name string, timeout time.Duration, stop func(ctx context.Context) error) {
+	l.steps = append(l.steps, &shutdownStep{phase, name, timeout, stop})
+}
+
+// Shutdown runs the registered steps once. A step over its timeout is abandoned, and the next step runs.
+// It returns the first error.
+func (l *Lifecycle) Shutdown() error {
+	steps := make([]*shutdownStep, len(l.steps))
+	for i, step := range l.steps {
+		steps[len(steps)-1-i] = step
+	}
+	l.steps = nil
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].phase < steps[j].phase })
+
+	logger := util.GetLogger()
+	var firstErr error
+	for _, step := range steps {
+		start := time.Now()
+		if err := step.run(); err != nil {
+			logger.Errorf("shutdown %v: %v", step.name, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("shutdown %v: %v", step.name, err)
+			}
+			continue
+		}
+		logger.Infof("shutdown %v in %v", step.name, time.Since(start))
+	}
+	return firstErr
+}
+
+func (step *shutdownStep) run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), step.timeout)
+	defer cancel()
+
+	// some steps like closing connections do not take the context.
+	done := make(chan error, 1)
+	go func() {
+		done <- step.stop(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out in %v", step.timeout)
+	}
+}
@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle_Shutdown(t *testing.T) {
+	var mu sync.Mutex
+	var stopped []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = append(stopped, name)
+	}
+	stop := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			record(name)
+			return err
+		}
+	}
+
+	l := &server.Lifecycle{}
+	// registered in order of initialization.
+	l.OnShutdown(server.PhaseWorkers, "tracing", time.Second, stop("tracing", nil))
+	l.OnShutdown(server.PhaseClients, "engine", time.Second, stop("engine", nil))
+	l.OnShutdown(server.PhaseClients, "kvs", time.Second, stop("kvs", errors.New("broken pipe")))
+	l.OnShutdown(server.PhaseReadiness, "readiness", time.Second, stop("readiness", nil))
+	l.OnShutdown(server.PhaseDrain, "server", 10*time.Millisecond, func(ctx context.Context) error {
+		record("server")
+		<-ctx.Done()
+		// a step ignoring the context is abandoned.
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	err := l.Shutdown()
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+	assert.Equal(t, []string{"readiness", "server", "tracing", "kvs", "engine"}, stopped)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "shutdown server: timed out")
+	}
+
+	// steps run only once.
+	assert.NoError(t, l.Shutdown())
+	assert.Len(t, stopped, 5)
+}
+
+func TestLoadShutdownConfigEnv(t *testing.T) {
+	assert.Equal(t, &server.ShutdownConfig{DrainTimeout: 5 * time.Second, StepTimeout: 5 * time.Second},
+		server.LoadShutdownConfigEnv())
+
+	os.Setenv("SHUTDOWN_DELAY_SECOND", "10")
+	os.Setenv("SHUTDOWN_TIMEOUT", "30")
+	os.Setenv("SHUTDOWN_STEP_TIMEOUT_SECOND", "invalid")
+	defer func() {
+		for _, env := range []string{"SHUTDOWN_DELAY_SECOND", "SHUTDOWN_TIMEOUT", "SHUTDOWN_STEP_TIMEOUT_SECOND"} {
+			os.Unsetenv(env)
+		}
+	}()
+	assert.Equal(t, &server.ShutdownConfig{Delay: 10 * time.Second, DrainTimeout: 30 * time.Second, StepTimeout: 5 * time.Second},
+		server.LoadShutdownConfigEnv())
+}
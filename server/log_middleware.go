@@ -5,7 +5,11 @@ package server
 // Based on github.com/stephenmuss/ginerus but adds more options.
 
 import (
+	"math/rand"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
 	"github.com/itomofumi/go-gin-xorm-starter/util"
 	"github.com/sirupsen/logrus"
 )
@@ -23,6 +27,17 @@ type loggerEntryWithFields interface {
 //   1. A time package format string (e.g. time.RFC3339).
 //   2. A boolean stating whether to use UTC time zone or local.
 func LogMiddleware(logger loggerEntryWithFields, timeFormat string, utc bool) gin.HandlerFunc {
+	return LogMiddlewareWithConfig(logger, &AccessLogConfig{TimeFormat: timeFormat, UTC: utc, SampleRate: 1})
+}
+
+// LogMiddlewareWithConfig is LogMiddleware skipping SkipPaths and sampling successful requests by SampleRate.
+// Requests with errors or status 4xx/5xx are always logged.
+func LogMiddlewareWithConfig(logger loggerEntryWithFields, conf *AccessLogConfig) gin.HandlerFunc {
+	skipPaths := map[string]bool{}
+	for _, p := range conf.SkipPaths {
+		skipPaths[p] = true
+	}
+
 	return func(c *gin.Context) {
 		start := util.GetTimeNow()
 		// some evil middlewares modify this values
@@ -30,23 +45,46 @@ func LogMiddleware(logger loggerEntryWithFields, timeFormat string, utc bool) gi
 		query := c.Request.URL.RawQuery
 		c.Next()
 
+		status := c.Writer.Status()
+		failed := len(c.Errors) > 0 || status >= http.StatusBadRequest
+		if skipPaths[path] || (!failed && conf.SampleRate < 1 && rand.Float64() >= conf.SampleRate) {
+			return
+		}
+
 		end := util.GetTimeNow()
 		latency := end.Sub(start)
-		if utc {
+		if conf.UTC {
 			end = end.UTC()
 		}
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
 
 		entry := logger.WithFields(logrus.Fields{
-			"status":     c.Writer.Status(),
-			"method":     c.Request.Method,
-			"path":       path,
-			"query":      query,
-			"ip":         c.ClientIP(),
-			"latency":    latency,
-			"user-agent": c.Request.UserAgent(),
-			"origin":     c.Request.Header["Origin"],
-			"time":       end.Format(timeFormat),
+			"status":                status,
+			"method":                c.Request.Method,
+			"path":                  path,
+			"query":                 query,
+			"route":                 c.FullPath(),
+			"proto":                 c.Request.Proto,
+			"ip":                    ClientIP(c),
+			"latency":               latency,
+			"size":                  size,
+			"user-agent":            c.Request.UserAgent(),
+			"referer":               c.Request.Referer(),
+			"origin":                c.Request.Header["Origin"],
+			"request_content_type":  c.ContentType(),
+			"response_content_type": c.Writer.Header().Get("Content-Type"),
+			"time":                  end.Format(conf.TimeFormat),
+			"request_id":            GetRequestID(c),
 		})
+		if user, ok := c.Get("user"); ok {
+			entry = entry.WithFields(logrus.Fields{"user_id": user.(*model.User).ID})
+		}
+		if actor, ok := GetActor(c); ok {
+			entry = entry.WithFields(logrus.Fields{"actor_id": actor.ID})
+		}
 
 		if len(c.Errors) > 0 {
 			// Append error field if this is an erroneous request.
@@ -3,14 +3,18 @@ package server_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
 	"github.com/itomofumi/go-gin-xorm-starter/server"
 	"github.com/itomofumi/go-gin-xorm-starter/util"
 	"github.com/stretchr/testify/assert"
@@ -31,15 +35,20 @@ func TestLogMiddleware(t *testing.T) {
 	logger.Out = b
 	logger.Formatter = &logrus.JSONFormatter{}
 
+	router.Use(server.RequestIDMiddleware())
 	router.Use(server.LogMiddleware(logger, time.RFC3339, false))
-	router.GET("/v1/tests", func(c *gin.Context) {
+	router.POST("/v1/tests/:id", func(c *gin.Context) {
 		called = true
+		c.Set("user", &model.User{Common: model.Common{ID: 3}})
+		c.JSON(http.StatusOK, gin.H{"ok": true})
 	})
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/v1/tests?param=123", nil)
+	req, _ := http.NewRequest("POST", "/v1/tests/1?param=123", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Origin", "https://example.com")
 	req.Header.Set("User-Agent", "httptest")
+	req.Header.Set("X-Request-ID", "req-123")
 	router.ServeHTTP(w, req)
 
 	assert := assert.New(t)
@@ -50,11 +59,128 @@ func TestLogMiddleware(t *testing.T) {
 	t.Log(j)
 	assert.Equal("info", j["level"])
 	assert.Equal("[access]", j["msg"])
-	assert.Equal("GET", j["method"])
+	assert.Equal("POST", j["method"])
 	assert.Equal(float64(200), j["status"])
-	assert.Equal("/v1/tests", j["path"])
+	assert.Equal("/v1/tests/1", j["path"])
+	assert.Equal("/v1/tests/:id", j["route"])
+	assert.Equal(float64(len(`{"ok":true}`)), j["size"])
+	assert.Equal(float64(3), j["user_id"])
+	assert.Equal("application/json", j["request_content_type"])
+	assert.Equal("application/json; charset=utf-8", j["response_content_type"])
 	assert.Equal("param=123", j["query"])
 	assert.Equal([]interface{}{"https://example.com"}, j["origin"])
 	assert.Equal("httptest", j["user-agent"])
 	assert.Equal("2009-11-10T23:00:00Z", j["fields.time"])
+	assert.Equal("req-123", j["request_id"])
+}
+
+func TestLogMiddleware_ActAs(t *testing.T) {
+	router := gin.New()
+	b := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.Out = b
+	logger.Formatter = &logrus.JSONFormatter{}
+
+	router.Use(server.LogMiddleware(logger, time.RFC3339, false))
+	router.GET("/v1/me", func(c *gin.Context) {
+		c.Set("actor", &model.User{Common: model.Common{ID: 1}})
+		c.Set("user", &model.User{Common: model.Common{ID: 3}})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/me", nil)
+	router.ServeHTTP(w, req)
+
+	j := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &j))
+	assert.Equal(t, float64(1), j["actor_id"])
+	assert.Equal(t, float64(3), j["user_id"])
+}
+
+func TestLogMiddlewareWithConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		conf     *server.AccessLogConfig
+		path     string
+		wantLogs int
+	}{
+		{"all", &server.AccessLogConfig{SampleRate: 1}, "/ok", 10},
+		{"skip health check", &server.AccessLogConfig{SampleRate: 1, SkipPaths: []string{"/healthz"}}, "/healthz", 0},
+		{"sample successes", &server.AccessLogConfig{SampleRate: 0}, "/ok", 0},
+		{"always log client errors", &server.AccessLogConfig{SampleRate: 0}, "/bad", 10},
+		{"always log errors", &server.AccessLogConfig{SampleRate: 0}, "/error", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			logger := logrus.New()
+			logger.Out = b
+
+			router := gin.New()
+			router.Use(server.LogMiddlewareWithConfig(logger, tt.conf))
+			router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+			router.GET("/healthz", func(c *gin.Context) { c.Status(http.StatusOK) })
+			router.GET("/bad", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+			router.GET("/error", func(c *gin.Context) { c.Error(errors.New("failed")) })
+
+			for i := 0; i < 10; i++ {
+				req, _ := http.NewRequest("GET", tt.path, nil)
+				router.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			assert.Equal(t, tt.wantLogs, strings.Count(b.String(), "[access]"))
+		})
+	}
+}
+
+func TestCombinedLogFormatter(t *testing.T) {
+	entry := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{
+		"ip":         "127.0.0.1",
+		"user_id":    uint64(3),
+		"method":     "GET",
+		"path":       "/v1/fruits",
+		"query":      "page=2",
+		"proto":      "HTTP/1.1",
+		"status":     200,
+		"size":       512,
+		"referer":    "",
+		"user-agent": `curl "7.64.1"`,
+	})
+	entry.Time = time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	b, err := (&server.CombinedLogFormatter{}).Format(entry)
+	assert.NoError(t, err)
+	assert.Equal(t, `127.0.0.1 - 3 [10/Nov/2009:23:00:00 +0000] "GET /v1/fruits?page=2 HTTP/1.1" 200 512 "-" "curl \"7.64.1\""`+"\n", string(b))
+}
+
+func TestLoadAccessLogConfigEnv(t *testing.T) {
+	conf, err := server.LoadAccessLogConfigEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, server.DefaultAccessLogConfig(), conf)
+
+	os.Setenv("ACCESS_LOG_FORMAT", "combined")
+	os.Setenv("ACCESS_LOG_SKIP_PATHS", "none")
+	os.Setenv("ACCESS_LOG_SAMPLE_RATE", "0.1")
+	defer func() {
+		for _, env := range []string{"ACCESS_LOG_FORMAT", "ACCESS_LOG_SKIP_PATHS", "ACCESS_LOG_SAMPLE_RATE"} {
+			os.Unsetenv(env)
+		}
+	}()
+	conf, err = server.LoadAccessLogConfigEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, "combined", conf.Format)
+	assert.Empty(t, conf.SkipPaths)
+	assert.Equal(t, 0.1, conf.SampleRate)
+	formatter, _ := conf.Formatter()
+	assert.IsType(t, &server.CombinedLogFormatter{}, formatter)
+
+	os.Setenv("ACCESS_LOG_FORMAT", "xml")
+	_, err = server.LoadAccessLogConfigEnv()
+	assert.Error(t, err)
+
+	os.Setenv("ACCESS_LOG_FORMAT", "json")
+	os.Setenv("ACCESS_LOG_SAMPLE_RATE", "2")
+	_, err = server.LoadAccessLogConfigEnv()
+	assert.Error(t, err)
 }
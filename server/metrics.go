@@ -0,0 +1,173 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsEnabledEnv = "METRICS_ENABLED"
+	metricsPortEnv    = "METRICS_PORT"
+
+	// MetricsPath is the path of Prometheus metrics.
+	MetricsPath = "/metrics"
+)
+
+// MetricsConfig is where Prometheus metrics are served.
+type MetricsConfig struct {
+	// Addr is a separate internal listener. If empty, metrics are served on the API listener.
+	Addr string
+}
+
+// LoadMetricsConfigEnv initializes MetricsConfig using Environment Variables.
+// Metrics are disabled by default, since they expose internals of the server.
+// METRICS_PORT serves them on the internal port, and METRICS_ENABLED=true serves them on the API listener.
+// It returns nil if they are disabled.
+func LoadMetricsConfigEnv() *MetricsConfig {
+	enabled := os.Getenv(metricsEnabledEnv)
+	port := os.Getenv(metricsPortEnv)
+	if enabled == "false" || (enabled != "true" && port == "") {
+		return nil
+	}
+	conf := &MetricsConfig{}
+	if port != "" {
+		conf.Addr = fmt.Sprintf("%v:%v", os.Getenv(ipEnv), port)
+	}
+	return conf
+}
+
+// Metrics are Prometheus metrics of the API server.
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// NewMetrics initializes HTTP metrics with Go runtime and process metrics.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests by route template and status.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of HTTP requests by route template.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being served.",
+		}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests, m.duration, m.inFlight,
+	)
+	return m
+}
+
+// RegisterDBStats adds connection pool metrics of database/sql, e.g. engine.DB().Stats.
+func (m *Metrics) RegisterDBStats(stats func() sql.DBStats) {
+	m.registry.MustRegister(&dbStatsCollector{stats})
+}
+
+// RegisterKVSStats adds key-value store metrics, e.g. infra.KVSClient.Stats.
+func (m *Metrics) RegisterKVSStats(stats func() infra.KVSStats) {
+	counter := func(name, help string, value func(s infra.KVSStats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, func() float64 {
+			return float64(value(stats()))
+		})
+	}
+	m.registry.MustRegister(
+		counter("kvs_hits_total", "Number of KVS reads which found the key.",
+			func(s infra.KVSStats) uint64 { return s.Hits }),
+		counter("kvs_misses_total", "Number of KVS reads which did not find the key.",
+			func(s infra.KVSStats) uint64 { return s.Misses }),
+		counter("kvs_errors_total", "Number of failed KVS operations.",
+			func(s infra.KVSStats) uint64 { return s.Errors }),
+	)
+}
+
+// Middleware observes requests. Routes are labeled by templates like "/v1/fruits/:fruit-id"
+// not to make a time series per ID. Requests not matching any route are labeled "unmatched".
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		m.duration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves metrics in Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// dbStatsCollector collects connection pool stats when scraped.
+type dbStatsCollector struct {
+	stats func() sql.DBStats
+}
+
+var (
+	dbMaxOpenDesc = prometheus.NewDesc("go_sql_max_open_connections",
+		"Maximum number of open connections to the database.", nil, nil)
+	dbOpenDesc = prometheus.NewDesc("go_sql_open_connections",
+		"Number of established connections both in use and idle.", nil, nil)
+	dbInUseDesc = prometheus.NewDesc("go_sql_in_use_connections",
+		"Number of connections currently in use.", nil, nil)
+	dbIdleDesc = prometheus.NewDesc("go_sql_idle_connections",
+		"Number of idle connections.", nil, nil)
+	dbWaitCountDesc = prometheus.NewDesc("go_sql_wait_count_total",
+		"Total number of connections waited for.", nil, nil)
+	dbWaitDurationDesc = prometheus.NewDesc("go_sql_wait_duration_seconds_total",
+		"Total time blocked waiting for a new connection.", nil, nil)
+	dbMaxIdleClosedDesc = prometheus.NewDesc("go_sql_max_idle_closed_total",
+		"Total number of connections closed due to SetMaxIdleConns.", nil, nil)
+	dbMaxLifetimeClosedDesc = prometheus.NewDesc("go_sql_max_lifetime_closed_total",
+		"Total number of connections closed due to SetConnMaxLifetime.", nil, nil)
+)
+
+func (dc *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxOpenDesc
+	ch <- dbOpenDesc
+	ch <- dbInUseDesc
+	ch <- dbIdleDesc
+	ch <- dbWaitCountDesc
+	ch <- dbWaitDurationDesc
+	ch <- dbMaxIdleClosedDesc
+	ch <- dbMaxLifetimeClosedDesc
+}
+
+func (dc *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := dc.stats()
+	ch <- prometheus.MustNewConstMetric(dbMaxOpenDesc, prometheus.GaugeValue, float64(s.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbOpenDesc, prometheus.GaugeValue, float64(s.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUseDesc, prometheus.GaugeValue, float64(s.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdleDesc, prometheus.GaugeValue, float64(s.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(s.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, s.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(dbMaxIdleClosedDesc, prometheus.CounterValue, float64(s.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(dbMaxLifetimeClosedDesc, prometheus.CounterValue, float64(s.MaxLifetimeClosed))
+}
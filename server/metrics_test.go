@@ -0,0 +1,81 @@
+package server_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	metrics := server.NewMetrics()
+	metrics.RegisterDBStats(func() sql.DBStats {
+		return sql.DBStats{MaxOpenConnections: 10, OpenConnections: 3, InUse: 2, Idle: 1, WaitCount: 4}
+	})
+	metrics.RegisterKVSStats(func() infra.KVSStats {
+		return infra.KVSStats{Hits: 5, Misses: 6, Errors: 7}
+	})
+
+	r := gin.New()
+	r.Use(metrics.Middleware())
+	r.GET("/v1/fruits/:fruit-id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET(server.MetricsPath, gin.WrapH(metrics.Handler()))
+
+	for _, path := range []string{"/v1/fruits/1", "/v1/fruits/2", "/unknown/3"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", server.MetricsPath, nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	body, _ := ioutil.ReadAll(w.Body)
+
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/v1/fruits/:fruit-id",status="200"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/v1/fruits/:fruit-id"} 2`,
+		`http_requests_in_flight 1`,
+		`go_sql_open_connections 3`,
+		`go_sql_in_use_connections 2`,
+		`go_sql_wait_count_total 4`,
+		`kvs_hits_total 5`,
+		`kvs_misses_total 6`,
+		`kvs_errors_total 7`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, string(body), want)
+	}
+	assert.NotContains(t, string(body), `route="/v1/fruits/1"`)
+}
+
+func TestLoadMetricsConfigEnv(t *testing.T) {
+	assert.Nil(t, server.LoadMetricsConfigEnv())
+
+	os.Setenv("METRICS_PORT", "9100")
+	assert.Equal(t, ":9100", server.LoadMetricsConfigEnv().Addr)
+	os.Unsetenv("METRICS_PORT")
+
+	os.Setenv("METRICS_ENABLED", "true")
+	assert.NotNil(t, server.LoadMetricsConfigEnv())
+	assert.Empty(t, server.LoadMetricsConfigEnv().Addr)
+
+	os.Setenv("METRICS_PORT", "9100")
+	defer os.Unsetenv("METRICS_PORT")
+	assert.Equal(t, ":9100", server.LoadMetricsConfigEnv().Addr)
+
+	os.Setenv("METRICS_ENABLED", "false")
+	defer os.Unsetenv("METRICS_ENABLED")
+	assert.Nil(t, server.LoadMetricsConfigEnv())
+}
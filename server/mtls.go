@@ -0,0 +1,203 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+)
+
+const (
+	mtlsPortEnv           = "MTLS_PORT"
+	mtlsCAFileEnv         = "MTLS_CA_FILE"
+	mtlsIdentitiesFileEnv = "MTLS_IDENTITIES_FILE"
+	tlsCertFileEnv        = "TLS_CERT_FILE"
+	tlsKeyFileEnv         = "TLS_KEY_FILE"
+)
+
+// AuthMethodMTLS is client certificate authentication of internal services.
+const AuthMethodMTLS = "mtls"
+
+var serviceIdentityContextKey = "service_identity"
+
+// ServiceIdentity maps client certificates to a service name.
+// A certificate matches when its subject or any of its SANs is listed.
+type ServiceIdentity struct {
+	Name string `json:"name"`
+	// Subjects are distinguished names, e.g. "CN=worker,O=Example".
+	Subjects []string `json:"subjects,omitempty"`
+	// SANs are DNS names, URIs (e.g. SPIFFE ID), email addresses or IP addresses.
+	SANs []string `json:"sans,omitempty"`
+}
+
+// ServiceIdentityMapper maps verified client certificates to service identities.
+type ServiceIdentityMapper struct {
+	identities []*ServiceIdentity
+}
+
+// NewServiceIdentityMapper initializes a mapper.
+// Without identities, the certificate's first URI SAN, DNS SAN or subject common name is the service name.
+func NewServiceIdentityMapper(identities []*ServiceIdentity) *ServiceIdentityMapper {
+	return &ServiceIdentityMapper{identities}
+}
+
+// Map returns the service name of the certificate.
+func (m *ServiceIdentityMapper) Map(cert *x509.Certificate) (string, bool) {
+	if len(m.identities) == 0 {
+		return defaultServiceName(cert)
+	}
+
+	subject := cert.Subject.String()
+	sans := certificateSANs(cert)
+	for _, identity := range m.identities {
+		if containsAny([]string{subject}, identity.Subjects) || containsAny(sans, identity.SANs) {
+			return identity.Name, true
+		}
+	}
+	return "", false
+}
+
+func defaultServiceName(cert *x509.Certificate) (string, bool) {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String(), true
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0], true
+	}
+	if cn := cert.Subject.CommonName; cn != "" {
+		return cn, true
+	}
+	return "", false
+}
+
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.URIs)+len(cert.EmailAddresses)+len(cert.IPAddresses))
+	sans = append(sans, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+// MTLSConfig is a listener which requires client certificates signed by the CA bundle.
+type MTLSConfig struct {
+	Addr      string
+	CertFile  string
+	KeyFile   string
+	ClientCAs *x509.CertPool
+	Mapper    *ServiceIdentityMapper
+}
+
+// LoadMTLSConfigEnv initializes MTLSConfig using Environment Variables.
+// It returns nil if MTLS_PORT is not set.
+func LoadMTLSConfigEnv() (*MTLSConfig, error) {
+	port := os.Getenv(mtlsPortEnv)
+	if port == "" {
+		return nil, nil
+	}
+
+	conf := &MTLSConfig{
+		Addr:     fmt.Sprintf("%v:%v", os.Getenv(ipEnv), port),
+		CertFile: os.Getenv(tlsCertFileEnv),
+		KeyFile:  os.Getenv(tlsKeyFileEnv),
+	}
+	if conf.CertFile == "" || conf.KeyFile == "" {
+		return nil, fmt.Errorf("%v requires %v and %v", mtlsPortEnv, tlsCertFileEnv, tlsKeyFileEnv)
+	}
+
+	caFile := os.Getenv(mtlsCAFileEnv)
+	if caFile == "" {
+		return nil, fmt.Errorf("%v requires %v", mtlsPortEnv, mtlsCAFileEnv)
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	conf.ClientCAs = x509.NewCertPool()
+	if !conf.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%v has no PEM certificates", mtlsCAFileEnv)
+	}
+
+	var identities []*ServiceIdentity
+	if filename := os.Getenv(mtlsIdentitiesFileEnv); filename != "" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &identities); err != nil {
+			return nil, fmt.Errorf("cannot parse %v: %v", mtlsIdentitiesFileEnv, err)
+		}
+	}
+	conf.Mapper = NewServiceIdentityMapper(identities)
+	return conf, nil
+}
+
+// TLSConfig requires and verifies client certificates.
+func (conf *MTLSConfig) TLSConfig() *tls.Config {
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  conf.ClientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// ServiceIdentityMiddleware sets the service identity of the verified client certificate.
+// Requests without TLS, e.g. on the plain HTTP listener, have no service identity.
+func ServiceIdentityMiddleware(mapper *ServiceIdentityMapper) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if state := c.Request.TLS; state != nil && len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+			if name, ok := mapper.Map(state.VerifiedChains[0][0]); ok {
+				c.Set(serviceIdentityContextKey, name)
+			}
+		}
+		c.Next()
+	}
+}
+
+// GetServiceIdentity returns the service identity authenticated by client certificate.
+func GetServiceIdentity(c *gin.Context) (string, bool) {
+	name := c.GetString(serviceIdentityContextKey)
+	return name, name != ""
+}
+
+// ServiceOrUserMiddleware allows the services to call the route without user credentials.
+// Other requests are authenticated like AuthMiddleware and UserMiddleware.
+func ServiceOrUserMiddleware(services ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, hasBearer := GetBearer(c.Request.Header["Authorization"])
+		_, _, hasCookie := getSessionCookie(c)
+		hasUserCredential := hasBearer || hasCookie || c.GetHeader(APIKeyHeader) != ""
+
+		if name, ok := GetServiceIdentity(c); ok && !hasUserCredential {
+			if !containsAny([]string{name}, services) {
+				c.AbortWithStatusJSON(http.StatusForbidden, model.NewErrorResponse("403", model.ErrorAuth,
+					fmt.Sprintf("service %v is not allowed", name)))
+				return
+			}
+			c.Set(authMethodContextKey, AuthMethodMTLS)
+			c.Next()
+			return
+		}
+
+		authenticator := c.MustGet(authContextKey).(Authenticator)
+		if err := authHandler(c, authenticator); err != nil {
+			abortAuth(c, err)
+			return
+		}
+		if err := UserHandler(c); err != nil {
+			abortUser(c, err)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// issueCert issues a certificate signed by parent, or a self-signed CA certificate if parent is nil.
+func issueCert(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	parentCert, parentKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		parentCert, parentKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestServiceIdentityMapper(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/worker")
+	tests := []struct {
+		name       string
+		identities []*server.ServiceIdentity
+		cert       *x509.Certificate
+		want       string
+		wantOK     bool
+	}{
+		{"default URI SAN", nil, &x509.Certificate{URIs: []*url.URL{spiffe}, DNSNames: []string{"worker.internal"}}, "spiffe://example.com/worker", true},
+		{"default DNS SAN", nil, &x509.Certificate{DNSNames: []string{"worker.internal"}, Subject: pkix.Name{CommonName: "worker"}}, "worker.internal", true},
+		{"default common name", nil, &x509.Certificate{Subject: pkix.Name{CommonName: "worker"}}, "worker", true},
+		{"mapped subject",
+			[]*server.ServiceIdentity{{Name: "worker", Subjects: []string{"CN=batch,O=Example"}}},
+			&x509.Certificate{Subject: pkix.Name{CommonName: "batch", Organization: []string{"Example"}}}, "worker", true},
+		{"mapped SAN",
+			[]*server.ServiceIdentity{{Name: "billing", SANs: []string{"billing.internal"}}, {Name: "worker", SANs: []string{"spiffe://example.com/worker"}}},
+			&x509.Certificate{URIs: []*url.URL{spiffe}}, "worker", true},
+		{"not mapped",
+			[]*server.ServiceIdentity{{Name: "worker", SANs: []string{"worker.internal"}}},
+			&x509.Certificate{Subject: pkix.Name{CommonName: "worker"}}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := server.NewServiceIdentityMapper(tt.identities).Map(tt.cert)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServiceOrUserMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ca := issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: "test CA"}}, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	conf := &server.MTLSConfig{ClientCAs: pool, Mapper: server.NewServiceIdentityMapper(nil)}
+
+	var authMethod string
+	r := gin.New()
+	r.Use(server.ServiceKeyMiddleware(&serviceFactoryMock{}))
+	r.Use(server.SetAuth(authenticatorMock{}, server.DefaultClaimMapping()))
+	r.Use(server.ServiceIdentityMiddleware(conf.Mapper))
+	r.POST("/", server.ServiceOrUserMiddleware("worker"), func(c *gin.Context) {
+		authMethod = c.GetString("auth_method")
+		name, _ := server.GetServiceIdentity(c)
+		c.String(http.StatusOK, name)
+	})
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.TLS = conf.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		commonName string
+		wantStatus int
+	}{
+		{"allowed service", "worker", http.StatusOK},
+		{"other service", "billing", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// new connection for each client certificate.
+			transport := srv.Client().Transport.(*http.Transport).Clone()
+			transport.TLSClientConfig.Certificates = []tls.Certificate{
+				issueCert(t, &x509.Certificate{Subject: pkix.Name{CommonName: tt.commonName}}, &ca),
+			}
+			client := &http.Client{Transport: transport}
+			res, err := client.Post(srv.URL, "application/json", nil)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, server.AuthMethodMTLS, authMethod)
+			}
+		})
+	}
+
+	t.Run("without client certificate", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
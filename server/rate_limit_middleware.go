@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const rateLimitsFileEnv = "RATE_LIMITS_FILE"
+
+var rateLimiterContextKey = "rate_limiter"
+
+// RateLimits are rate limits by name. A limit of 0 disables it.
+type RateLimits map[string]*RateLimitConfig
+
+// DefaultRateLimits returns rate limits used by defineRoutes.
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		// all v1 APIs per client IP
+		"v1": {Algorithm: RateLimitTokenBucket, Limit: 600, PeriodSecond: 60, Burst: 100},
+		// per user, API key or service
+		"fruits:write": {Algorithm: RateLimitSlidingWindow, Limit: 60, PeriodSecond: 60},
+		// sign up per client IP
+		"users:create": {Algorithm: RateLimitSlidingWindow, Limit: 10, PeriodSecond: 3600},
+	}
+}
+
+// LoadRateLimitsEnv loads DefaultRateLimits overridden by RATE_LIMITS_FILE.
+//
+//	{"fruits:write": {"algorithm": "token_bucket", "limit": 30, "period_second": 60, "burst": 10}}
+func LoadRateLimitsEnv() (RateLimits, error) {
+	limits := DefaultRateLimits()
+	if filename := os.Getenv(rateLimitsFileEnv); filename != "" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var overrides RateLimits
+		if err := json.Unmarshal(b, &overrides); err != nil {
+			return nil, fmt.Errorf("cannot parse %v: %v", rateLimitsFileEnv, err)
+		}
+		for name, conf := range overrides {
+			limits[name] = conf
+		}
+	}
+
+	for name, conf := range limits {
+		if err := conf.validate(); err != nil {
+			return nil, fmt.Errorf("rate limit %v: %v", name, err)
+		}
+	}
+	return limits, nil
+}
+
+type rateLimitContext struct {
+	limiter RateLimiter
+	limits  RateLimits
+}
+
+// SetRateLimiter passes a rate limiter and rate limits to RateLimit middlewares.
+func SetRateLimiter(limiter RateLimiter, limits RateLimits) gin.HandlerFunc {
+	rl := &rateLimitContext{limiter, limits}
+	return func(c *gin.Context) {
+		c.Set(rateLimiterContextKey, rl)
+		c.Next()
+	}
+}
+
+// RateLimit limits requests of the route by the named rate limit.
+// Requests are counted per API key, user or service if authenticated, or per client IP.
+func RateLimit(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get(rateLimiterContextKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		rl := v.(*rateLimitContext)
+		conf, ok := rl.limits[name]
+		if !ok || conf.Limit == 0 {
+			c.Next()
+			return
+		}
+
+		result, err := rl.limiter.Allow(name+"/"+rateLimitKey(c), conf, util.GetTimeNow())
+		if err != nil {
+			// not to stop the service by the rate limiter.
+			util.GetLogger().Warnf("rate limit %v is skipped: %v", name, err)
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, result, conf)
+		if !result.Allowed {
+			retryAfter := ceilSeconds(result.RetryAfter.Seconds())
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, model.NewErrorResponse("429", model.ErrorLimitExceeded,
+				fmt.Sprintf("rate limit exceeded. retry after %v seconds", retryAfter)))
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitKey identifies the client of the request.
+func rateLimitKey(c *gin.Context) string {
+	if key, ok := clientKey(c); ok {
+		return key
+	}
+	return "ip:" + ClientIP(c)
+}
+
+// clientKey identifies the authenticated API key, user or service of the request.
+func clientKey(c *gin.Context) (string, bool) {
+	if apiKey, ok := c.Get("api_key"); ok {
+		return fmt.Sprintf("api_key:%d", apiKey.(*model.APIKey).ID), true
+	}
+	if user, ok := c.Get("user"); ok {
+		return fmt.Sprintf("user:%d", user.(*model.User).ID), true
+	}
+	if name, ok := GetServiceIdentity(c); ok && c.GetString(authMethodContextKey) == AuthMethodMTLS {
+		return "service:" + name, true
+	}
+	return "", false
+}
+
+// setRateLimitHeaders sets RateLimit header fields (draft-ietf-httpapi-ratelimit-headers).
+// When some rate limits are applied to a request, the one with the least remaining is shown.
+func setRateLimitHeaders(c *gin.Context, result *RateLimitResult, conf *RateLimitConfig) {
+	header := c.Writer.Header()
+	if v := header.Get("RateLimit-Remaining"); v != "" {
+		if remaining, err := strconv.Atoi(v); err == nil && remaining < result.Remaining {
+			return
+		}
+	}
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset.Seconds())))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", conf.Limit, conf.PeriodSecond))
+}
+
+// ceilSeconds rounds up seconds to at least 1.
+func ceilSeconds(sec float64) int {
+	return int(math.Max(1, math.Ceil(sec)))
+}
@@ -0,0 +1,93 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limits := server.RateLimits{
+		"v1":    {Algorithm: server.RateLimitSlidingWindow, Limit: 3, PeriodSecond: 60},
+		"write": {Algorithm: server.RateLimitTokenBucket, Limit: 1, PeriodSecond: 60},
+		"off":   {Algorithm: server.RateLimitTokenBucket, Limit: 0, PeriodSecond: 60},
+	}
+	r := gin.New()
+	r.Use(server.SetRateLimiter(server.NewMemoryRateLimiter(), limits))
+	v1 := r.Group("/v1", server.RateLimit("v1"))
+	v1.GET("/fruits", func(c *gin.Context) { c.Status(http.StatusOK) })
+	v1.GET("/off", server.RateLimit("off"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	v1.POST("/fruits", func(c *gin.Context) {
+		c.Set("user", &model.User{Common: model.Common{ID: uint64(len(c.Query("user")))}})
+	}, server.RateLimit("write"), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		ip            string
+		forwardedFor  string
+		wantStatus    int
+		wantRemaining string
+	}{
+		{"first", "GET", "/v1/fruits", "192.0.2.1", "", http.StatusOK, "2"},
+		{"disabled limit", "GET", "/v1/off", "192.0.2.1", "", http.StatusOK, "1"},
+		{"user limit shows least remaining", "POST", "/v1/fruits?user=a", "192.0.2.1", "", http.StatusCreated, "0"},
+		{"other IP", "GET", "/v1/fruits", "192.0.2.2", "", http.StatusOK, "2"},
+		{"exceeded", "GET", "/v1/fruits", "192.0.2.1", "", http.StatusTooManyRequests, "0"},
+		{"forged X-Forwarded-For", "GET", "/v1/fruits", "192.0.2.1", "198.51.100.1", http.StatusTooManyRequests, "0"},
+		{"other user exceeded by IP limit", "POST", "/v1/fruits?user=bb", "192.0.2.1", "", http.StatusTooManyRequests, "0"},
+		{"user limit exceeded", "POST", "/v1/fruits?user=a", "192.0.2.2", "", http.StatusTooManyRequests, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			req.RemoteAddr = tt.ip + ":12345"
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantRemaining, w.Header().Get("RateLimit-Remaining"))
+			assert.NotEmpty(t, w.Header().Get("RateLimit-Reset"))
+			if tt.wantStatus != http.StatusTooManyRequests {
+				assert.Empty(t, w.Header().Get("Retry-After"))
+				return
+			}
+
+			assert.NotEmpty(t, w.Header().Get("Retry-After"))
+			var res model.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			require.Len(t, res.Errors, 1)
+			assert.Equal(t, model.ErrorLimitExceeded, res.Errors[0].Type)
+		})
+	}
+}
+
+func TestRateLimit_LimiterError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limits := server.RateLimits{"v1": {Algorithm: server.RateLimitTokenBucket, Limit: 1, PeriodSecond: 60}}
+	r := gin.New()
+	r.Use(server.SetRateLimiter(failingRateLimiter{}, limits))
+	r.GET("/v1/fruits", server.RateLimit("v1"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/fruits", nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Remaining"))
+	}
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+// rate limit algorithms.
+const (
+	// RateLimitTokenBucket refills Limit tokens per Period up to Burst tokens.
+	RateLimitTokenBucket = "token_bucket"
+	// RateLimitSlidingWindow allows Limit requests in any Period, weighting the previous fixed window.
+	RateLimitSlidingWindow = "sliding_window"
+)
+
+// RateLimitConfig is a rate limit of a route.
+type RateLimitConfig struct {
+	Algorithm    string `json:"algorithm"`
+	Limit        int    `json:"limit"`
+	PeriodSecond int    `json:"period_second"`
+	// Burst is the bucket size of token bucket. (default: Limit)
+	Burst int `json:"burst,omitempty"`
+}
+
+func (conf *RateLimitConfig) period() time.Duration {
+	return time.Duration(conf.PeriodSecond) * time.Second
+}
+
+func (conf *RateLimitConfig) burst() int {
+	if conf.Burst > 0 {
+		return conf.Burst
+	}
+	return conf.Limit
+}
+
+func (conf *RateLimitConfig) validate() error {
+	if conf.Algorithm != RateLimitTokenBucket && conf.Algorithm != RateLimitSlidingWindow {
+		return fmt.Errorf("unknown rate limit algorithm %q", conf.Algorithm)
+	}
+	if conf.Limit < 0 || conf.PeriodSecond <= 0 || conf.Burst < 0 {
+		return fmt.Errorf("rate limit expects non-negative limit and burst, and positive period_second")
+	}
+	return nil
+}
+
+// RateLimitResult is the state of the rate limit after a request.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the time until the next request is allowed.
+	RetryAfter time.Duration
+	// Reset is the time until the quota is fully restored.
+	Reset time.Duration
+}
+
+// RateLimiter counts a request of the key and returns whether it is allowed.
+type RateLimiter interface {
+	Allow(key string, conf *RateLimitConfig, now time.Time) (*RateLimitResult, error)
+}
+
+// tokenBucketScript refills tokens by elapsed time and takes one.
+// KEYS[1]: bucket, ARGV: burst, tokens per millisecond, now in milliseconds.
+// returns {allowed, remaining, retry after ms, reset ms}
+var tokenBucketScript = infra.NewKVSScript(1, `
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) / rate)
+end
+local reset = math.ceil((burst - tokens) / rate)
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], reset + 1000)
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// slidingWindowScript counts requests in the current fixed window
+// and weights the previous window by the remaining time.
+// KEYS[1]: current window, KEYS[2]: previous window, ARGV: limit, window ms, elapsed ms in the current window.
+// returns {allowed, remaining, retry after ms, reset ms}
+var slidingWindowScript = infra.NewKVSScript(2, `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+local count = prev * (window - elapsed) / window + cur
+if count + 1 > limit then
+  local retry = window - elapsed
+  if prev > 0 then
+    retry = math.min(retry, math.ceil((count + 1 - limit) * window / prev))
+  end
+  return {0, 0, retry, window - elapsed}
+end
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], window * 2)
+return {1, math.floor(limit - count - 1), 0, window - elapsed}
+`)
+
+// redisRateLimiter shares rate limits among API instances.
+type redisRateLimiter struct {
+	kvsClient infra.KVSClientInterface
+}
+
+// NewRedisRateLimiter initializes a rate limiter running Lua scripts in Redis.
+func NewRedisRateLimiter(kvsClient infra.KVSClientInterface) RateLimiter {
+	return &redisRateLimiter{kvsClient}
+}
+
+func (l *redisRateLimiter) Allow(key string, conf *RateLimitConfig, now time.Time) (*RateLimitResult, error) {
+	var values []int64
+	var err error
+	switch conf.Algorithm {
+	case RateLimitTokenBucket:
+		rate := float64(conf.Limit) / float64(toMillis(conf.period()))
+		values, err = l.kvsClient.EvalInts(tokenBucketScript, []string{"rate_limits/" + key},
+			conf.burst(), strconv.FormatFloat(rate, 'g', -1, 64), unixMillis(now))
+	case RateLimitSlidingWindow:
+		window := toMillis(conf.period())
+		index := unixMillis(now) / window
+		values, err = l.kvsClient.EvalInts(slidingWindowScript,
+			[]string{windowKey(key, index), windowKey(key, index-1)},
+			conf.Limit, window, unixMillis(now)%window)
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", conf.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("rate limit script returned %v values", len(values))
+	}
+	return &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      conf.Limit,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		Reset:      time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+func windowKey(key string, index int64) string {
+	return fmt.Sprintf("rate_limits/%s/%d", key, index)
+}
+
+func toMillis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// memoryRateLimiter runs the same algorithms as the scripts in memory of this instance.
+type memoryRateLimiter struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryRateLimitEntry
+	lastSweep time.Time
+}
+
+type memoryRateLimitEntry struct {
+	tokens    float64
+	ts        int64
+	count     float64
+	expiresAt int64
+}
+
+// NewMemoryRateLimiter initializes a rate limiter which is not shared among API instances.
+func NewMemoryRateLimiter() RateLimiter {
+	return &memoryRateLimiter{entries: map[string]*memoryRateLimitEntry{}}
+}
+
+func (l *memoryRateLimiter) Allow(key string, conf *RateLimitConfig, now time.Time) (*RateLimitResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	nowMillis := unixMillis(now)
+	l.sweep(now, nowMillis)
+
+	result := &RateLimitResult{Limit: conf.Limit}
+	switch conf.Algorithm {
+	case RateLimitTokenBucket:
+		burst := float64(conf.burst())
+		rate := float64(conf.Limit) / float64(toMillis(conf.period()))
+		e := l.get("rate_limits/"+key, nowMillis)
+		if e.ts == 0 {
+			e.tokens, e.ts = burst, nowMillis
+		}
+		e.tokens = math.Min(burst, e.tokens+math.Max(0, float64(nowMillis-e.ts))*rate)
+		if e.tokens >= 1 {
+			e.tokens--
+			result.Allowed = true
+		} else {
+			result.RetryAfter = millis(math.Ceil((1 - e.tokens) / rate))
+		}
+		reset := math.Ceil((burst - e.tokens) / rate)
+		e.ts = nowMillis
+		e.expiresAt = nowMillis + int64(reset) + 1000
+		result.Remaining = int(e.tokens)
+		result.Reset = millis(reset)
+
+	case RateLimitSlidingWindow:
+		window := toMillis(conf.period())
+		index := nowMillis / window
+		elapsed := nowMillis % window
+		cur := l.get(windowKey(key, index), nowMillis)
+		prev := l.get(windowKey(key, index-1), nowMillis)
+		count := prev.count*float64(window-elapsed)/float64(window) + cur.count
+		result.Reset = millis(float64(window - elapsed))
+		if count+1 > float64(conf.Limit) {
+			retry := float64(window - elapsed)
+			if prev.count > 0 {
+				retry = math.Min(retry, math.Ceil((count+1-float64(conf.Limit))*float64(window)/prev.count))
+			}
+			result.RetryAfter = millis(retry)
+		} else {
+			cur.count++
+			cur.expiresAt = nowMillis + window*2
+			result.Allowed = true
+			result.Remaining = int(float64(conf.Limit) - count - 1)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", conf.Algorithm)
+	}
+	return result, nil
+}
+
+// get returns the entry, or a new entry if it does not exist or is expired.
+func (l *memoryRateLimiter) get(key string, nowMillis int64) *memoryRateLimitEntry {
+	e, ok := l.entries[key]
+	if !ok || e.expiresAt <= nowMillis {
+		// expired until it is updated.
+		e = &memoryRateLimitEntry{expiresAt: nowMillis}
+		l.entries[key] = e
+	}
+	return e
+}
+
+// sweep removes expired entries once a minute.
+func (l *memoryRateLimiter) sweep(now time.Time, nowMillis int64) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, e := range l.entries {
+		if e.expiresAt <= nowMillis {
+			delete(l.entries, key)
+		}
+	}
+}
+
+func millis(ms float64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+// fallbackRateLimiter uses the secondary limiter while the primary one returns errors.
+type fallbackRateLimiter struct {
+	primary   RateLimiter
+	secondary RateLimiter
+
+	mu         sync.Mutex
+	lastWarned time.Time
+}
+
+// NewFallbackRateLimiter initializes a rate limiter which falls back to secondary,
+// e.g. in-memory limiter while Redis is unavailable.
+func NewFallbackRateLimiter(primary, secondary RateLimiter) RateLimiter {
+	return &fallbackRateLimiter{primary: primary, secondary: secondary}
+}
+
+func (l *fallbackRateLimiter) Allow(key string, conf *RateLimitConfig, now time.Time) (*RateLimitResult, error) {
+	result, err := l.primary.Allow(key, conf, now)
+	if err == nil {
+		return result, nil
+	}
+
+	l.mu.Lock()
+	if now.Sub(l.lastWarned) >= time.Minute {
+		l.lastWarned = now
+		util.GetLogger().Warnf("rate limiter falls back to in-memory: %v", err)
+	}
+	l.mu.Unlock()
+
+	return l.secondary.Allow(key, conf, now)
+}
@@ -0,0 +1,86 @@
+package server_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	start := time.Date(2020, 10, 21, 0, 0, 0, 0, time.UTC)
+
+	type request struct {
+		after       time.Duration
+		wantAllowed bool
+		wantRemain  int
+	}
+	tests := []struct {
+		name     string
+		conf     *server.RateLimitConfig
+		requests []request
+	}{
+		{
+			name: "token bucket",
+			conf: &server.RateLimitConfig{Algorithm: server.RateLimitTokenBucket, Limit: 60, PeriodSecond: 60, Burst: 2},
+			requests: []request{
+				{0, true, 1},
+				{0, true, 0},
+				{0, false, 0},
+				// refilled a token per second.
+				{time.Second, true, 0},
+				{time.Second, false, 0},
+				{3 * time.Second, true, 1},
+			},
+		},
+		{
+			name: "sliding window",
+			conf: &server.RateLimitConfig{Algorithm: server.RateLimitSlidingWindow, Limit: 2, PeriodSecond: 60},
+			requests: []request{
+				{0, true, 1},
+				{30 * time.Second, true, 0},
+				{59 * time.Second, false, 0},
+				// the previous window is weighted by 1/2.
+				{90 * time.Second, true, 0},
+				{150 * time.Second, true, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := server.NewMemoryRateLimiter()
+			for i, req := range tt.requests {
+				result, err := limiter.Allow("key", tt.conf, start.Add(req.after))
+				require.NoError(t, err)
+				assert.Equal(t, req.wantAllowed, result.Allowed, "request %v", i)
+				assert.Equal(t, req.wantRemain, result.Remaining, "request %v", i)
+				if !result.Allowed {
+					assert.True(t, result.RetryAfter > 0, "request %v", i)
+				}
+			}
+		})
+	}
+}
+
+type failingRateLimiter struct{}
+
+func (failingRateLimiter) Allow(key string, conf *server.RateLimitConfig, now time.Time) (*server.RateLimitResult, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestFallbackRateLimiter(t *testing.T) {
+	limiter := server.NewFallbackRateLimiter(failingRateLimiter{}, server.NewMemoryRateLimiter())
+	conf := &server.RateLimitConfig{Algorithm: server.RateLimitSlidingWindow, Limit: 1, PeriodSecond: 60}
+	now := time.Now()
+
+	result, err := limiter.Allow("key", conf, now)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, err = limiter.Allow("key", conf, now)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+}
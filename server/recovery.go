@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"github.com/sirupsen/logrus"
+)
+
+// RecoveryMiddleware recovers from panics of handlers with 500 Internal Server Error of model.ErrorResponse.
+// The panic is logged with the stack at error level and notified to the reporter.
+func RecoveryMiddleware(logger loggerEntryWithFields, reporter infra.ErrorReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// net/http aborts the response silently.
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+			// the client has gone, and nothing can be written.
+			if isBrokenConnection(v) {
+				logger.WithFields(logrus.Fields{"request_id": GetRequestID(c)}).Warnf("[recovery] connection broken: %v", v)
+				c.Error(fmt.Errorf("%v", v))
+				c.Abort()
+				return
+			}
+
+			report := &infra.ErrorReport{
+				Time:      util.GetTimeNow(),
+				Error:     fmt.Sprint(v),
+				Stack:     string(debug.Stack()),
+				RequestID: GetRequestID(c),
+				Method:    c.Request.Method,
+				Path:      c.Request.URL.Path,
+			}
+			if user, ok := c.Get("user"); ok {
+				report.UserID = user.(*model.User).ID
+			}
+			logger.WithFields(logrus.Fields{
+				"request_id": report.RequestID,
+				"method":     report.Method,
+				"path":       report.Path,
+			}).Errorf("[recovery] panic recovered: %v\n%s", v, report.Stack)
+			if err := reporter.Report(report); err != nil {
+				logger.WithFields(logrus.Fields{"request_id": report.RequestID}).Warnf("failed to report the panic: %v", err)
+			}
+
+			c.Error(fmt.Errorf("panic: %v", v))
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			res := model.NewErrorResponse("500", model.ErrorUnknown, "internal server error")
+			res.RequestID = report.RequestID
+			c.AbortWithStatusJSON(http.StatusInternalServerError, res)
+		}()
+		c.Next()
+	}
+}
+
+func isBrokenConnection(v interface{}) bool {
+	var opErr *net.OpError
+	err, ok := v.(error)
+	if !ok || !errors.As(err, &opErr) {
+		return false
+	}
+	var syscallErr *os.SyscallError
+	if !errors.As(opErr, &syscallErr) {
+		return false
+	}
+	msg := strings.ToLower(syscallErr.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
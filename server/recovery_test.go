@@ -0,0 +1,79 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reportRecorder struct {
+	reports []*infra.ErrorReport
+}
+
+func (r *reportRecorder) Report(report *infra.ErrorReport) error {
+	r.reports = append(r.reports, report)
+	return nil
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &logs
+	reporter := &reportRecorder{}
+
+	r := gin.New()
+	r.Use(server.RequestIDMiddleware())
+	r.Use(server.RecoveryMiddleware(logger, reporter))
+	r.Use(func(c *gin.Context) {
+		c.Set("user", &model.User{Common: model.Common{ID: uint64(7)}})
+	})
+	r.GET("/panic", func(c *gin.Context) { panic(errors.New("something wrong")) })
+	r.GET("/ok", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	req.Header.Set(server.RequestIDHeader, "req-1")
+	r.ServeHTTP(w, req)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	var res model.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Len(t, res.Errors, 1)
+	assert.Equal(model.ErrorUnknown, res.Errors[0].Type)
+	assert.Equal("req-1", res.RequestID)
+
+	assert.Contains(logs.String(), "level=error")
+	assert.Contains(logs.String(), "something wrong")
+	assert.Contains(logs.String(), "request_id=req-1")
+	assert.Contains(logs.String(), "recovery_test.go")
+
+	require.Len(t, reporter.reports, 1)
+	report := reporter.reports[0]
+	assert.Equal("something wrong", report.Error)
+	assert.Equal("req-1", report.RequestID)
+	assert.Equal("GET", report.Method)
+	assert.Equal("/panic", report.Path)
+	assert.Equal(uint64(7), report.UserID)
+	assert.Contains(report.Stack, "recovery_test.go")
+
+	// requests without panics are not affected.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/ok", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Len(reporter.reports, 1)
+}
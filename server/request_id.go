@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	// RequestIDHeader is a request and response header to correlate logs.
+	RequestIDHeader = "X-Request-ID"
+	// TraceparentHeader is a W3C Trace Context header.
+	TraceparentHeader = "traceparent"
+)
+
+var (
+	requestIDContextKey   = "request_id"
+	traceparentContextKey = "traceparent"
+)
+
+var (
+	requestIDPattern   = regexp.MustCompile(`^[A-Za-z0-9._:/+=@-]{1,128}$`)
+	traceparentPattern = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+)
+
+// RequestIDMiddleware accepts X-Request-ID and traceparent headers, or generates them.
+// Without valid X-Request-ID, the trace ID is the request ID.
+// The request ID is echoed in X-Request-ID response header and error responses,
+// and passed to the request context for SQL logs.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		traceID, flags, ok := parseTraceparent(c.GetHeader(TraceparentHeader))
+		if !ok {
+			traceID, flags = randomHex(16), "01"
+		}
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = traceID
+		}
+
+		// this server is a child span of the caller.
+		c.Set(traceparentContextKey, fmt.Sprintf("00-%v-%v-%v", traceID, randomHex(8), flags))
+		c.Set(requestIDContextKey, id)
+		c.Request = c.Request.WithContext(util.WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+		c.Writer = &requestIDWriter{ResponseWriter: c.Writer, requestID: id}
+		c.Next()
+	}
+}
+
+// GetRequestID returns the request ID set by RequestIDMiddleware.
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+// GetTraceparent returns traceparent header value to propagate the trace to other services.
+func GetTraceparent(c *gin.Context) string {
+	return c.GetString(traceparentContextKey)
+}
+
+// parseTraceparent returns the trace ID and flags of a valid version 00 compatible traceparent.
+func parseTraceparent(v string) (traceID, flags string, ok bool) {
+	m := traceparentPattern.FindStringSubmatch(strings.TrimSpace(v))
+	if m == nil || m[1] == "ff" ||
+		m[2] == strings.Repeat("0", 32) || m[3] == strings.Repeat("0", 16) {
+		return "", "", false
+	}
+	return m[2], m[4], true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIDWriter adds the request ID to model.ErrorResponse bodies,
+// so that clients can report it with errors.
+type requestIDWriter struct {
+	gin.ResponseWriter
+	requestID string
+}
+
+func (w *requestIDWriter) Write(b []byte) (int, error) {
+	if w.Status() < 400 || !strings.HasPrefix(w.Header().Get("Content-Type"), gin.MIMEJSON) {
+		return w.ResponseWriter.Write(b)
+	}
+
+	var res model.ErrorResponse
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&res); err != nil || len(res.Errors) == 0 || res.RequestID != "" {
+		return w.ResponseWriter.Write(b)
+	}
+	res.RequestID = w.requestID
+	body, err := json.Marshal(&res)
+	if err != nil {
+		return w.ResponseWriter.Write(b)
+	}
+	if _, err := w.ResponseWriter.Write(body); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,91 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var contextID, traceparent string
+	r := gin.New()
+	r.Use(server.RequestIDMiddleware())
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		contextID = util.GetRequestID(c.Request.Context())
+		traceparent = server.GetTraceparent(c)
+	})
+	r.GET("/ok", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"errors": "not an error response"}) })
+	r.GET("/error", func(c *gin.Context) {
+		c.AbortWithStatusJSON(http.StatusNotFound, model.NewErrorResponse("404", model.ErrorNotFound, "not found"))
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	tests := []struct {
+		name            string
+		requestID       string
+		traceparent     string
+		wantID          string
+		wantGenerated   bool
+		wantTraceParent *regexp.Regexp
+	}{
+		{"accept request ID", "abc-123", "", "abc-123", false, regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`)},
+		{"trace ID from traceparent", "", "00-" + traceID + "-00f067aa0ba902b7-00", traceID, false,
+			regexp.MustCompile(`^00-` + traceID + `-[0-9a-f]{16}-00$`)},
+		{"both", "abc-123", "00-" + traceID + "-00f067aa0ba902b7-01", "abc-123", false,
+			regexp.MustCompile(`^00-` + traceID + `-[0-9a-f]{16}-01$`)},
+		{"generate", "", "", "", true, regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`)},
+		{"invalid request ID", "<script>", "", "", true, nil},
+		{"invalid traceparent", "", "00-" + traceID + "-0000000000000000-01", "", true, nil},
+		{"invalid version", "", "ff-" + traceID + "-00f067aa0ba902b7-01", "", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range []string{"/ok", "/error"} {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", path, nil)
+				if tt.requestID != "" {
+					req.Header.Set(server.RequestIDHeader, tt.requestID)
+				}
+				if tt.traceparent != "" {
+					req.Header.Set(server.TraceparentHeader, tt.traceparent)
+				}
+				r.ServeHTTP(w, req)
+
+				id := w.Header().Get(server.RequestIDHeader)
+				if tt.wantGenerated {
+					assert.Regexp(t, generated, id)
+				} else {
+					assert.Equal(t, tt.wantID, id)
+				}
+				assert.Equal(t, id, contextID)
+				if tt.wantTraceParent != nil {
+					assert.Regexp(t, tt.wantTraceParent, traceparent)
+				}
+
+				if path == "/ok" {
+					assert.JSONEq(t, `{"errors": "not an error response"}`, w.Body.String())
+					continue
+				}
+				var res model.ErrorResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+				assert.Equal(t, id, res.RequestID)
+				require.Len(t, res.Errors, 1)
+				assert.Equal(t, model.ErrorNotFound, res.Errors[0].Type)
+			}
+		})
+	}
+}
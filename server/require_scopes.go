@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+)
+
+// scopesContextKey has scopes granted to the credential.
+// It is not set for ID tokens, which are used by the user itself.
+var scopesContextKey = "scopes"
+
+// RequireScopes rejects requests whose access token or API key lacks any of the scopes.
+// Requests with ID tokens have no scope restriction.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, restricted := c.Get(scopesContextKey)
+		if !restricted {
+			c.Next()
+			return
+		}
+		granted, _ := v.([]string)
+
+		missing := make([]string, 0, len(scopes))
+		for _, s := range scopes {
+			if !containsAny([]string{s}, granted) {
+				missing = append(missing, s)
+			}
+		}
+		if len(missing) > 0 {
+			// RFC 6750 insufficient_scope error
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%v"`, strings.Join(scopes, " ")))
+			c.AbortWithStatusJSON(http.StatusForbidden, model.NewErrorResponse("403", model.ErrorAuth,
+				fmt.Sprintf("insufficient scope. missing scopes: %v", strings.Join(missing, " "))))
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetScopes returns OAuth2 scopes of the access token.
+// "scope" is a space-delimited string (RFC 8693), and some providers use "scp" array instead.
+// ok is false when the token has no scope claim, e.g. ID tokens.
+func GetScopes(claims jwt.MapClaims) (scopes []string, ok bool) {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope), true
+	}
+	switch scp := claims["scp"].(type) {
+	case string:
+		return strings.Fields(scp), true
+	case []interface{}:
+		scopes = make([]string, 0, len(scp))
+		for _, v := range scp {
+			if s, ok := v.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes, true
+	}
+	return nil, false
+}
@@ -0,0 +1,74 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		scopes      []string
+		restricted  bool
+		wantStatus  int
+		wantMessage string
+	}{
+		{"ID token", nil, false, http.StatusOK, ""},
+		{"granted", []string{"fruits:read", "fruits:write", "users:write"}, true, http.StatusOK, ""},
+		{"missing one", []string{"fruits:write"}, true, http.StatusForbidden, "insufficient scope. missing scopes: users:write"},
+		{"no scopes", []string{}, true, http.StatusForbidden, "insufficient scope. missing scopes: fruits:write users:write"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				if tt.restricted {
+					c.Set("scopes", tt.scopes)
+				}
+			}, server.RequireScopes("fruits:write", "users:write"), func(c *gin.Context) {})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			if tt.wantMessage != "" {
+				var res model.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+				assert.Equal(t, []string{tt.wantMessage}, res.Errors[0].Messages)
+				assert.Equal(t, `Bearer error="insufficient_scope", scope="fruits:write users:write"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestGetScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   []string
+		wantOK bool
+	}{
+		{"scope", jwt.MapClaims{"scope": "openid fruits:write"}, []string{"openid", "fruits:write"}, true},
+		{"scp array", jwt.MapClaims{"scp": []interface{}{"fruits:write"}}, []string{"fruits:write"}, true},
+		{"empty scope", jwt.MapClaims{"scope": ""}, []string{}, true},
+		{"ID token", jwt.MapClaims{"token_use": "id"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := server.GetScopes(tt.claims)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
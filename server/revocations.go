@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+// revocationsCheckInterval is how often the key-value store is checked for the lost revocation list.
+const revocationsCheckInterval = 30 * time.Second
+
+// WatchRevocations restores the revocation list whenever the key-value store has lost it,
+// e.g. after Redis restarted or failed over. The returned function stops watching.
+func WatchRevocations(sessions service.SessionsInterface, interval time.Duration) (stop func(ctx context.Context) error) {
+	logger := util.GetLogger()
+	quit := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+			count, err := sessions.RestoreRevocationsIfLost()
+			if err != nil {
+				logger.Warnf("failed to restore session revocations: %v", err)
+			} else if count > 0 {
+				logger.Infof("%v session revocations restored", count)
+			}
+		}
+	}()
+
+	return func(ctx context.Context) error {
+		close(quit)
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package server_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+)
+
+// restoringSessionsMock counts restorations.
+type restoringSessionsMock struct {
+	sessionsMock
+	restored int32
+}
+
+func (sm *restoringSessionsMock) RestoreRevocationsIfLost() (int, error) {
+	atomic.AddInt32(&sm.restored, 1)
+	return 1, nil
+}
+
+func TestWatchRevocations(t *testing.T) {
+	sessions := &restoringSessionsMock{}
+	stop := server.WatchRevocations(sessions, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&sessions.restored) >= 2 }, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, stop(ctx))
+	restored := atomic.LoadInt32(&sessions.restored)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, restored, atomic.LoadInt32(&sessions.restored), "it should not restore after stopped")
+}
@@ -8,6 +8,14 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// serviceWorker is the service identity of internal workers authenticated by mTLS.
+const serviceWorker = "worker"
+
+func defineHealthRoutes(r gin.IRouter, health *Health) {
+	r.GET(LivenessPath, health.Liveness)
+	r.GET(ReadinessPath, health.Readiness)
+}
+
 func defineRoutes(r gin.IRouter) {
 
 	// Health Check
@@ -16,23 +24,57 @@ func defineRoutes(r gin.IRouter) {
 	})
 
 	// v1
-	v1 := r.Group("/v1")
+	v1 := r.Group("/v1", RateLimit("v1"))
 	v1withUser := v1.Group("/", AuthMiddleware(), UserMiddleware())
 
 	{
 		v1withUser.GET("/me", handler.GetMe)
 		v1withUser.GET("/user", handler.GetMe)
+		v1withUser.GET("/me/logins", handler.GetMyLogins)
+	}
+
+	{
+		// API keys and impersonating admins can't manage API keys and sessions.
+		v1withJWT := v1withUser.Group("/", RequireAuthMethod(AuthMethodJWT, AuthMethodCookie), DenyImpersonation())
+		v1withJWT.GET("/me/tokens", handler.GetMyAPIKeys)
+		v1withJWT.POST("/me/tokens", handler.PostMyAPIKey)
+		v1withJWT.DELETE("/me/tokens/:token-id", RequirePathParam("token-id"), handler.DeleteMyAPIKey)
+		v1withJWT.GET("/me/sessions", handler.GetMySessions)
+		v1withJWT.DELETE("/me/sessions", handler.DeleteMySessions)
+		v1withJWT.DELETE("/me/sessions/:session-id", RequirePathParam("session-id"), handler.DeleteMySession)
 	}
 
 	{
-		v1.POST("/users", handler.PostUser)
+		v1.POST("/users", RateLimit("users:create"), Idempotent(), handler.PostUser)
+		// the link in verification emails
+		v1.GET("/users/verify", handler.GetVerifyUser)
+		v1.POST("/users/verify", handler.PostVerifyUser)
+		v1.POST("/users/verify/resend", handler.PostResendVerification)
 	}
 
 	{
 		v1.GET("/fruits", handler.GetFruits)
 		v1.GET("/fruits/:fruit-id", RequirePathParam("fruit-id"), handler.GetFruitByID)
-		v1withUser.POST("/fruits", handler.PostFruit)
-		v1withUser.PUT("/fruits/:fruit-id", RequirePathParam("fruit-id"), handler.PutFruit)
-		v1withUser.DELETE("/fruits/:fruit-id", RequirePathParam("fruit-id"), handler.DeleteFruit)
+		// internal workers can write fruits with client certificate.
+		v1withUserOrWorker := v1.Group("/", ServiceOrUserMiddleware(serviceWorker),
+			RateLimit("fruits:write"), ConcurrencyLimit("fruits:write"))
+		v1withUserOrWorker.POST("/fruits", RequireScopes("fruits:write"), Idempotent(), handler.PostFruit)
+		v1withUserOrWorker.PUT("/fruits/:fruit-id", RequireScopes("fruits:write"), RequirePathParam("fruit-id"), handler.PutFruit)
+		v1withUserOrWorker.DELETE("/fruits/:fruit-id", RequireScopes("fruits:write"), RequirePathParam("fruit-id"), handler.DeleteFruit)
 	}
 }
+
+// defineCookieSessionRoutes defines routes to exchange JWT for a session cookie.
+func defineCookieSessionRoutes(r gin.IRouter, conf *CookieConfig) {
+	v1 := r.Group("/v1")
+	v1.POST("/cookie-session", AuthMiddleware(), RequireAuthMethod(AuthMethodJWT), UserMiddleware(), conf.PostCookieSession)
+	v1.DELETE("/cookie-session", AuthMiddleware(), RequireAuthMethod(AuthMethodCookie), conf.DeleteCookieSession)
+}
+
+// defineDevRoutes defines routes of the development token issuer.
+func defineDevRoutes(r gin.IRouter, issuer *DevTokenIssuer) {
+	dev := r.Group("/dev")
+	dev.POST("/token", issuer.PostToken)
+	dev.GET("/.well-known/jwks.json", issuer.GetJWKS)
+	dev.GET("/.well-known/openid-configuration", issuer.GetOpenIDConfiguration)
+}
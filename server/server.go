@@ -9,7 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"path"
-	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/itomofumi/go-gin-xorm-starter/factory"
@@ -19,7 +19,6 @@ import (
 	"github.com/gin-gonic/gin/binding"
 	"github.com/itomofumi/go-gin-xorm-starter/infra"
 	"github.com/itomofumi/go-gin-xorm-starter/util"
-	"github.com/itomofumi/gognito/auth"
 	"github.com/sirupsen/logrus"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 	"xorm.io/xorm"
@@ -52,16 +51,27 @@ func setupDBEngine(logLevel logrus.Level) (*xorm.Engine, error) {
 	loggerSQL.Level = logLevel
 	loggerSQL.Out = io.MultiWriter(os.Stdout, sqlLogWriter)
 
-	engine.SetLogger(engine.Logger())
+	// SQLログにリクエストIDを付ける
+	engine.SetLogger(infra.NewSQLLogger(loggerSQL, engine.Logger()))
+	engine.AddHook(&infra.TracingHook{DBName: dbOptions.DBName})
 
 	return engine, nil
 }
 
-// Start starts api server
+// Start starts api server, and shuts it down gracefully by SIGTERM or SIGINT.
 // func Start(serverOptions Options) error {
-func Start() error {
+func Start() (err error) {
 	logger := util.GetLogger()
 
+	// 初期化に失敗した場合も、初期化済みのものを順に停止する
+	shutdownConf := LoadShutdownConfigEnv()
+	lifecycle := &Lifecycle{}
+	defer func() {
+		if shutdownErr := lifecycle.Shutdown(); err == nil {
+			err = shutdownErr
+		}
+	}()
+
 	// ログの出力設定
 	logLevel, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL"))
 	if err != nil {
@@ -71,22 +81,28 @@ func Start() error {
 
 	logDir := os.Getenv("LOG_DIR")
 
+	// tracing
+	shutdownTracing, err := SetupTracing(context.Background())
+	if err != nil {
+		return err
+	}
+	lifecycle.OnShutdown(PhaseWorkers, "tracing", shutdownConf.StepTimeout, shutdownTracing)
+
 	// db engine 初期化
 	engine, err := setupDBEngine(logLevel)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer func() {
-		log.Println("engine closed")
-		engine.Close()
-	}()
+	lifecycle.OnShutdown(PhaseClients, "engine", shutdownConf.StepTimeout, func(context.Context) error {
+		return engine.Close()
+	})
 
 	// key-value store initialization.
 	kvsClient := infra.NewKVSClient()
-	defer func() {
-		log.Println("kvsClient closed")
+	lifecycle.OnShutdown(PhaseClients, "kvsClient", shutdownConf.StepTimeout, func(context.Context) error {
 		kvsClient.Close()
-	}()
+		return nil
+	})
 
 	accessLogWriter := &lumberjack.Logger{
 		Filename:   path.Join(logDir, "server_access.log"),
@@ -95,9 +111,14 @@ func Start() error {
 		Compress:   true, // disabled by default
 	}
 
+	accessLogConf, err := LoadAccessLogConfigEnv()
+	if err != nil {
+		return err
+	}
 	loggerAccess := logrus.New()
 	loggerAccess.Level = logLevel
 	loggerAccess.Out = io.MultiWriter(os.Stdout, accessLogWriter)
+	loggerAccess.Formatter, _ = accessLogConf.Formatter()
 
 	// Gin エラーログ
 	ginErrorLogWriter := &lumberjack.Logger{
@@ -109,37 +130,145 @@ func Start() error {
 
 	gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, ginErrorLogWriter)
 
+	// mailer initialization.
+	mailer, err := infra.NewMailerEnv()
+	if err != nil {
+		return err
+	}
+
+	// error reporter initialization.
+	errorReporter, err := infra.NewErrorReporterEnv()
+	if err != nil {
+		return err
+	}
+
 	// service factoryの初期化
-	factory := factory.NewService(engine, kvsClient)
+	factory := factory.NewService(engine, kvsClient, mailer)
+
+	// key-value store may have lost the revocation list.
+	if count, err := factory.NewSessions().RestoreRevocations(); err != nil {
+		logger.Warnf("failed to restore session revocations: %v", err)
+	} else {
+		logger.Infof("%v session revocations restored", count)
+	}
+	lifecycle.OnShutdown(PhaseWorkers, "revocations", shutdownConf.StepTimeout,
+		WatchRevocations(factory.NewSessions(), revocationsCheckInterval))
 
 	// override gin validator
 	binding.Validator = &model.StructValidator{}
 
+	corsPolicy, err := LoadCORSPolicyEnv()
+	if err != nil {
+		return err
+	}
+	concurrencyLimits, err := LoadConcurrencyLimitsEnv()
+	if err != nil {
+		return err
+	}
+	compressionConf, err := LoadCompressionConfigEnv()
+	if err != nil {
+		return err
+	}
+	trustedProxies, err := LoadTrustedProxiesEnv()
+	if err != nil {
+		return err
+	}
+	health, err := NewHealthEnv(
+		&Dependency{Name: "mysql", Check: engine.PingContext},
+		&Dependency{Name: "redis", Check: kvsClient.Ping},
+	)
+	if err != nil {
+		return err
+	}
+
 	// Ginの初期化
-	r := gin.Default()
+	r := gin.New()
+	// X-Forwarded-Forは信頼するプロキシからのみ受け付ける (ClientIPMiddleware)
+	r.ForwardedByClientIP = false
 
 	// middlewareのロード
-	r.Use(LogMiddleware(loggerAccess, time.RFC3339, false))
-	r.Use(CORSMiddleware())
+	r.Use(gin.Logger())
+	// 圧縮はエラーレスポンスへのリクエストIDの追加より外側で行う
+	if compressionConf != nil {
+		r.Use(CompressionMiddleware(compressionConf))
+	}
+	r.Use(RequestIDMiddleware())
+	r.Use(ClientIPMiddleware(trustedProxies))
+	r.Use(TracingMiddleware())
+	metricsConf := LoadMetricsConfigEnv()
+	var metrics *Metrics
+	if metricsConf != nil {
+		metrics = NewMetrics()
+		metrics.RegisterDBStats(engine.DB().Stats)
+		metrics.RegisterKVSStats(kvsClient.Stats)
+		r.Use(metrics.Middleware())
+	}
+	r.Use(LogMiddlewareWithConfig(loggerAccess, accessLogConf))
+	// panicはリクエストIDを付けたJSONで返し、アクセスログ・メトリクスにも500として残す
+	r.Use(RecoveryMiddleware(logger, errorReporter))
+
+	// ヘルスチェックは負荷制限や認証の対象外にする
+	defineHealthRoutes(r, health)
+
+	r.Use(CORSMiddleware(corsPolicy))
+	// 認証やDBアクセスの前に過負荷のリクエストを落とす
+	r.Use(SetConcurrencyLimiters(NewConcurrencyLimiters(concurrencyLimits)), ConcurrencyLimit("global"))
 	r.Use(ServiceKeyMiddleware(factory))
 
 	// auth middlewareの準備
-	authenticator, err := auth.New(
-		&auth.UserPool{
-			Region: os.Getenv(cognitoRegionEnv),
-			PoolID: os.Getenv(cognitoUserPoolIDEnv),
-		},
-		&auth.Option{
-			NoVerification: DisableVerification,
-		})
+	var devIssuer *DevTokenIssuer
+	if DevTokenIssuerEnabled {
+		devIssuer, err = NewDevTokenIssuerEnv()
+		if err != nil {
+			return err
+		}
+	}
+	authenticator, err := setupAuthenticator(devIssuer)
+	if err != nil {
+		return err
+	}
+
+	r.Use(SetAuth(authenticator, LoadClaimMappingEnv()))
 
+	cookieConf, err := LoadCookieConfigEnv()
 	if err != nil {
 		return err
 	}
+	if cookieConf != nil {
+		r.Use(SetCookieAuth(cookieConf))
+	}
 
-	r.Use(SetAuth(authenticator))
+	mtlsConf, err := LoadMTLSConfigEnv()
+	if err != nil {
+		return err
+	}
+	if mtlsConf != nil {
+		r.Use(ServiceIdentityMiddleware(mtlsConf.Mapper))
+	}
+
+	rateLimits, err := LoadRateLimitsEnv()
+	if err != nil {
+		return err
+	}
+	// Redisが使えない間はインスタンスごとに制限する
+	limiter := NewFallbackRateLimiter(NewRedisRateLimiter(kvsClient), NewMemoryRateLimiter())
+	r.Use(SetRateLimiter(limiter, rateLimits))
+	idempotencyConf, err := LoadIdempotencyConfigEnv()
+	if err != nil {
+		return err
+	}
+	r.Use(SetIdempotency(kvsClient, idempotencyConf))
 
 	defineRoutes(r)
+	if metricsConf != nil && metricsConf.Addr == "" {
+		r.GET(MetricsPath, gin.WrapH(metrics.Handler()))
+	}
+	if cookieConf != nil {
+		defineCookieSessionRoutes(r, cookieConf)
+	}
+	if devIssuer != nil {
+		defineDevRoutes(r, devIssuer)
+	}
 
 	ip := os.Getenv(ipEnv)
 
@@ -148,40 +277,77 @@ func Start() error {
 		port = "3000"
 	}
 
-	// parse SHUTDOWN_TIMEOUT ENV
-	var shutdownTimeout int
-	shutdownTimeoutStr := os.Getenv(shutdownTimeoutEnv)
-	if shutdownTimeout, err = strconv.Atoi(shutdownTimeoutStr); err != nil {
-		logger.Warnf("%v expects int value, but %v was given.", shutdownTimeoutEnv, shutdownTimeoutStr)
-		logger.Infof("use default 5 [sec] for %v", shutdownTimeoutEnv)
-		shutdownTimeout = 5
-	}
+	// readinessを落としてからロードバランサーが外すまで待つ
+	lifecycle.OnShutdown(PhaseReadiness, "readiness", shutdownConf.Delay+time.Second, func(ctx context.Context) error {
+		health.SetShuttingDown()
+		time.Sleep(shutdownConf.Delay)
+		return nil
+	})
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf("%v:%v", ip, port),
 		Handler: r,
 	}
 
+	// listener errors stop the server gracefully instead of exiting in goroutines.
+	serverErr := make(chan error, 3)
+	lifecycle.OnShutdown(PhaseDrain, "server", shutdownConf.DrainTimeout, srv.Shutdown)
 	go func() {
 		// Start server
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("listen: %s\n", err)
+			serverErr <- fmt.Errorf("listen: %v", err)
 		}
 	}()
 
-	// Wait for "interrupt" or "kill" signal to gracefully shutdown.
-	quit := make(chan os.Signal)
-	signal.Notify(quit, os.Interrupt, os.Kill)
-	sig := <-quit
+	// mTLS listener for internal services
+	var mtlsSrv *http.Server
+	if mtlsConf != nil {
+		mtlsSrv = &http.Server{
+			Addr:      mtlsConf.Addr,
+			Handler:   r,
+			TLSConfig: mtlsConf.TLSConfig(),
+		}
+		lifecycle.OnShutdown(PhaseDrain, "mTLS server", shutdownConf.DrainTimeout, mtlsSrv.Shutdown)
+		go func() {
+			if err := mtlsSrv.ListenAndServeTLS(mtlsConf.CertFile, mtlsConf.KeyFile); err != nil && err != http.ErrServerClosed {
+				serverErr <- fmt.Errorf("listen mTLS: %v", err)
+			}
+		}()
+	}
 
-	logger.Printf("Shutdown Server with Signal %v", sig)
+	// internal listener for Prometheus metrics
+	var metricsSrv *http.Server
+	if metricsConf != nil && metricsConf.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle(MetricsPath, metrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:    metricsConf.Addr,
+			Handler: mux,
+		}
+		lifecycle.OnShutdown(PhaseDrain, "metrics server", shutdownConf.DrainTimeout, metricsSrv.Shutdown)
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serverErr <- fmt.Errorf("listen metrics: %v", err)
+			}
+		}()
+	}
+
+	// Wait for SIGTERM (e.g. Kubernetes, docker stop) or SIGINT to gracefully shutdown.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(quit)
+	select {
+	case sig := <-quit:
+		logger.Printf("Shutdown Server with Signal %v", sig)
+	case err = <-serverErr:
+		logger.Errorf("Shutdown Server with Error %v", err)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(shutdownTimeout)*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server Shutdown:", err)
+	// readiness, drain, workers, clients の順に停止する
+	if shutdownErr := lifecycle.Shutdown(); err == nil {
+		err = shutdownErr
 	}
 	logger.Println("Server exiting")
 
-	return nil
+	return err
 }
@@ -8,7 +8,12 @@ import (
 // ServiceKeyMiddleware provides the service factory
 func ServiceKeyMiddleware(si factory.Servicer) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Set(factory.ServiceKey, si)
+		if cs, ok := si.(factory.ContextServicer); ok {
+			// queries are logged with the request ID.
+			c.Set(factory.ServiceKey, cs.WithContext(c.Request.Context()))
+		} else {
+			c.Set(factory.ServiceKey, si)
+		}
 		c.Next()
 	}
 }
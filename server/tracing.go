@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	lumberjack "gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	tracesExporterEnv    = "TRACES_EXPORTER"
+	tracesFileEnv        = "TRACES_FILE"
+	tracesSampleRatioEnv = "TRACES_SAMPLE_RATIO"
+
+	serviceName = "go-gin-xorm-starter"
+)
+
+// trace exporters.
+const (
+	// TracesExporterOTLP sends spans to OTEL_EXPORTER_OTLP_ENDPOINT by OTLP/HTTP.
+	TracesExporterOTLP = "otlp"
+	// TracesExporterStdout prints spans for local development.
+	TracesExporterStdout = "stdout"
+	// TracesExporterFile writes spans to TRACES_FILE.
+	TracesExporterFile = "file"
+)
+
+// SetupTracing sets the global tracer provider using Environment Variables.
+// Without TRACES_EXPORTER, spans are not recorded.
+// It returns a function to flush spans and stop the exporter.
+func SetupTracing(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch v := os.Getenv(tracesExporterEnv); v {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case TracesExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case TracesExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case TracesExporterFile:
+		filename := os.Getenv(tracesFileEnv)
+		if filename == "" {
+			filename = path.Join(os.Getenv("LOG_DIR"), "server_traces.log")
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(&lumberjack.Logger{
+			Filename:   filename,
+			MaxSize:    10,  // megabytes
+			MaxBackups: 100, // default: not to remove old logs
+			Compress:   true,
+		}))
+	default:
+		return nil, fmt.Errorf("%v expects %v, %v or %v, but %v was given",
+			tracesExporterEnv, TracesExporterOTLP, TracesExporterStdout, TracesExporterFile, v)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := 1.0
+	if v := os.Getenv(tracesSampleRatioEnv); v != "" {
+		if ratio, err = strconv.ParseFloat(v, 64); err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("%v expects a ratio from 0 to 1, but %v was given", tracesSampleRatioEnv, v)
+		}
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the service name.
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	if res, err = resource.Merge(res, resource.Environment()); err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// follow the sampling decision of the caller.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// TracingMiddleware starts a server span of the request, continuing the trace of traceparent header.
+// Spans of services, repositories, SQL and KVS are its children through the request context.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := util.Tracer().Start(ctx, "HTTP "+c.Request.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(c.Request.Method),
+				semconv.HTTPTargetKey.String(c.Request.URL.Path),
+				semconv.HTTPClientIPKey.String(ClientIP(c)),
+				semconv.HTTPUserAgentKey.String(c.Request.UserAgent()),
+				attribute.String("http.request_id", GetRequestID(c)),
+			))
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		// name by the route template, not to make a span name per ID.
+		if route := c.FullPath(); route != "" {
+			span.SetName(c.Request.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRouteKey.String(route))
+		}
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		for _, err := range c.Errors {
+			span.RecordError(err.Err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	_, err := server.SetupTracing(context.Background())
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(server.RequestIDMiddleware(), server.TracingMiddleware())
+	r.GET("/v1/fruits/:fruit-id", func(c *gin.Context) {
+		// service and repository spans are nested by the scope.
+		scope := util.NewTraceScope(c.Request.Context())
+		endService := scope.Start("FruitsService.GetByID")
+		endRepository := scope.Start("FruitsRepository.GetByID")
+		endRepository(nil)
+		endService(nil)
+		c.Status(http.StatusInternalServerError)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/fruits/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	repository, service, root := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "GET /v1/fruits/:fruit-id", root.Name())
+	assert.Equal(t, trace.SpanKindServer, root.SpanKind())
+	assert.Equal(t, traceID, root.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", root.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, root.Status().Code)
+	attrs := map[string]interface{}{}
+	for _, kv := range root.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.Equal(t, "/v1/fruits/:fruit-id", attrs["http.route"])
+	assert.Equal(t, "/v1/fruits/1", attrs["http.target"])
+	assert.Equal(t, int64(http.StatusInternalServerError), attrs["http.status_code"])
+	assert.Equal(t, traceID, attrs["http.request_id"])
+
+	assert.Equal(t, "FruitsService.GetByID", service.Name())
+	assert.Equal(t, root.SpanContext().SpanID(), service.Parent().SpanID())
+	assert.Equal(t, "FruitsRepository.GetByID", repository.Name())
+	assert.Equal(t, service.SpanContext().SpanID(), repository.Parent().SpanID())
+}
+
+func TestSetupTracing(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		ratio    string
+		wantErr  bool
+	}{
+		{"disabled", "", "", false},
+		{"stdout", "stdout", "0.5", false},
+		{"file", "file", "", false},
+		{"unknown exporter", "zipkin", "", true},
+		{"invalid ratio", "stdout", "2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("TRACES_EXPORTER", tt.exporter)
+			os.Setenv("TRACES_SAMPLE_RATIO", tt.ratio)
+			os.Setenv("TRACES_FILE", os.DevNull)
+			defer os.Unsetenv("TRACES_EXPORTER")
+			defer os.Unsetenv("TRACES_SAMPLE_RATIO")
+			defer os.Unsetenv("TRACES_FILE")
+
+			shutdown, err := server.SetupTracing(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+}
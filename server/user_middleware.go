@@ -1,26 +1,45 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/itomofumi/go-gin-xorm-starter/factory"
 	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
 	"github.com/itomofumi/go-gin-xorm-starter/util"
-	"github.com/itomofumi/ptr"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
+// ActAsHeader is a request header for admins to act as another user by user ID.
+const ActAsHeader = "X-Act-As"
+
+var actorContextKey = "actor"
+
+// impersonation errors.
+var (
+	// ErrActAsForbidden is returned when the user is not an admin.
+	ErrActAsForbidden = errors.New("only admins can act as another user")
+	// ErrActAsAdmin is returned when the target user is an admin.
+	ErrActAsAdmin = errors.New("cannot act as another admin")
+	// ErrActAsNotFound is returned when the target user does not exist, or is deleted or disabled.
+	ErrActAsNotFound = errors.New("user to act as is not found")
+)
+
+// ErrUserNotLinked is returned when the subject is not linked to any user,
+// and it can't be linked by the email automatically.
+var ErrUserNotLinked = errors.New("user is not linked to the identity. verify the email of both the identity provider and the user to link them")
+
 // UserMiddleware 認証したユーザー情報を取得する
 func UserMiddleware() gin.HandlerFunc {
-	logger := util.GetLogger()
 	return func(c *gin.Context) {
 		err := UserHandler(c)
 		if err != nil {
-			er := model.NewErrorResponse("401", model.ErrorAuth, err.Error())
-			logger.Debug(er)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, er)
+			abortUser(c, err)
 			return
 		}
 
@@ -30,15 +49,12 @@ func UserMiddleware() gin.HandlerFunc {
 
 // OptionalUserMiddleware 認証していればユーザー情報を取得する
 func OptionalUserMiddleware() gin.HandlerFunc {
-	logger := util.GetLogger()
 	return func(c *gin.Context) {
-		_, ok := c.Get("email")
+		_, ok := c.Get("sub")
 		if ok {
 			err := UserHandler(c)
 			if err != nil {
-				er := model.NewErrorResponse("401", model.ErrorAuth, err.Error())
-				logger.Debug(er)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, er)
+				abortUser(c, err)
 				return
 			}
 		}
@@ -52,20 +68,32 @@ func UserHandler(c *gin.Context) error {
 	factory := c.MustGet(factory.ServiceKey).(factory.Servicer)
 	userSrv := factory.NewUsers()
 
-	// ID Tokenのemailはエンドユーザー身元識別子
-	email := c.MustGet("email").(string)
-	user, ok := userSrv.GetByEmail(email)
-	if !ok {
-		return fmt.Errorf("cannot find user email = %v", email)
+	user, err := findUser(c, userSrv)
+	if err != nil {
+		return err
+	}
+
+	// email_verified is updated by the email verification flow (/v1/users/verify).
+
+	// ログイン履歴の記録
+	if sessionID := c.GetString("session_id"); sessionID != "" {
+		loginSrv := factory.NewLogins()
+		login, created, err := loginSrv.Record(user.ID, sessionID, ClientIP(c), c.Request.UserAgent())
+		if err != nil {
+			util.GetLogger().Warnf("failed to record login of user id = %v: %v", user.ID, err)
+		} else if created {
+			user.LastLoginAt = login.CreatedAt
+		}
 	}
 
-	// ここまで来たらユーザー認証OK
-	if user.EmailVerified != nil && !*user.EmailVerified {
-		err := userSrv.Verify(user.ID)
+	// 管理者による他ユーザーとしての操作
+	if actAs := c.GetHeader(ActAsHeader); actAs != "" {
+		actor := user
+		user, err = impersonate(c, userSrv, actor, actAs)
 		if err != nil {
 			return err
 		}
-		user.EmailVerified = ptr.Bool(true)
+		c.Set(actorContextKey, actor)
 	}
 
 	// PublicDataの更新
@@ -73,3 +101,105 @@ func UserHandler(c *gin.Context) error {
 	c.Set("user", user)
 	return nil
 }
+
+// impersonate returns the target user for the admin actor.
+// Every impersonated request is logged with both identities.
+func impersonate(c *gin.Context, userSrv service.UsersInterface, actor *model.User, actAs string) (*model.User, error) {
+	if !actor.IsAdmin() || c.GetString(authMethodContextKey) == AuthMethodAPIKey {
+		return nil, ErrActAsForbidden
+	}
+	targetID, err := strconv.ParseUint(actAs, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v must be a user id", ErrActAsNotFound, ActAsHeader)
+	}
+	target, ok := userSrv.GetByID(targetID)
+	if !ok || !target.IsActive() {
+		return nil, fmt.Errorf("%w: user id = %v", ErrActAsNotFound, targetID)
+	}
+	if target.ID != actor.ID && target.IsAdmin() {
+		return nil, ErrActAsAdmin
+	}
+
+	// audit log. Warn level not to be filtered out by usual LOG_LEVEL.
+	util.GetLogger().WithFields(logrus.Fields{
+		"actor_id":    actor.ID,
+		"actor_email": actor.Email,
+		"user_id":     target.ID,
+		"user_email":  target.Email,
+		"method":      c.Request.Method,
+		"path":        c.Request.URL.Path,
+		"ip":          ClientIP(c),
+	}).Warn("[impersonation]")
+
+	return target, nil
+}
+
+// GetActor returns the admin acting as the user of the request.
+func GetActor(c *gin.Context) (*model.User, bool) {
+	actor, ok := c.Get(actorContextKey)
+	if !ok {
+		return nil, false
+	}
+	return actor.(*model.User), true
+}
+
+// abortUser responds 403 or 404 for impersonation errors, and 401 for the others.
+func abortUser(c *gin.Context, err error) {
+	status := http.StatusUnauthorized
+	errType := model.ErrorAuth
+	switch {
+	case errors.Is(err, ErrActAsForbidden), errors.Is(err, ErrActAsAdmin):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrActAsNotFound):
+		status = http.StatusNotFound
+		errType = model.ErrorNotFound
+	}
+	er := model.NewErrorResponse(strconv.Itoa(status), errType, err.Error())
+	util.GetLogger().Debug(er)
+	c.AbortWithStatusJSON(status, er)
+}
+
+// DenyImpersonation rejects requests made by admins acting as the user.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetActor(c); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, model.NewErrorResponse("403", model.ErrorAuth,
+				fmt.Sprintf("%v is not allowed for this request", ActAsHeader)))
+			return
+		}
+		c.Next()
+	}
+}
+
+// findUser は認証情報に対応するユーザーを取得する
+func findUser(c *gin.Context, userSrv service.UsersInterface) (*model.User, error) {
+	// APIキー認証では取得済み
+	if user, ok := c.Get("user"); ok {
+		return user.(*model.User), nil
+	}
+
+	// subはIDプロバイダが発行する不変のユーザー識別子で、issuerごとに一意
+	iss := c.GetString("iss")
+	sub := c.MustGet("sub").(string)
+	user, ok := userSrv.GetBySub(iss, sub)
+	if !ok {
+		// subが未登録の既存ユーザーは初回ログイン時にemailで紐付ける
+		// なりすまし防止のため、IDプロバイダとユーザーの両方でemailが確認済みの場合のみ
+		email := c.GetString("email")
+		if !c.GetBool("email_verified") {
+			return nil, fmt.Errorf("%w: email = %v is not verified by the identity provider", ErrUserNotLinked, email)
+		}
+		user, ok = userSrv.LinkSub(email, iss, sub)
+		if !ok {
+			return nil, fmt.Errorf("%w: iss = %v, sub = %v, email = %v", ErrUserNotLinked, iss, sub, email)
+		}
+		if user.DisplayName == nil {
+			if name := c.GetString("display_name"); name != "" {
+				if _, err := userSrv.Update(user.ID, &model.UserProfile{DisplayName: &name}); err == nil {
+					user.DisplayName = &name
+				}
+			}
+		}
+	}
+	return user, nil
+}
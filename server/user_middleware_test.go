@@ -0,0 +1,255 @@
+package server_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/itomofumi/go-gin-xorm-starter/factory"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/server"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+// serviceFactoryMock is a mock of service factory.
+type serviceFactoryMock struct {
+	factory.Servicer
+	users    service.UsersInterface
+	apiKeys  service.APIKeysInterface
+	sessions service.SessionsInterface
+	cookies  service.CookieSessionsInterface
+}
+
+func (sf *serviceFactoryMock) NewUsers() service.UsersInterface {
+	return sf.users
+}
+
+func (sf *serviceFactoryMock) NewAPIKeys() service.APIKeysInterface {
+	return sf.apiKeys
+}
+
+func (sf *serviceFactoryMock) NewSessions() service.SessionsInterface {
+	if sf.sessions == nil {
+		return sessionsMock{}
+	}
+	return sf.sessions
+}
+
+func (sf *serviceFactoryMock) NewCookieSessions() service.CookieSessionsInterface {
+	return sf.cookies
+}
+
+// sessionsMock revokes the given session ids.
+type sessionsMock struct {
+	service.SessionsInterface
+	revoked map[string]bool
+}
+
+func (sm sessionsMock) IsRevoked(iss string, sub string, sessionIDs []string, issuedAt time.Time) (bool, error) {
+	for _, id := range sessionIDs {
+		if sm.revoked[id] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+const testIssuer = "https://idp.example.com"
+
+// usersMock is a mock of users service.
+type usersMock struct {
+	service.UsersInterface
+	bySub   map[string]*model.User
+	byEmail map[string]*model.User
+	updated *model.UserProfile
+}
+
+func (um *usersMock) GetBySub(iss string, sub string) (*model.User, bool) {
+	u, ok := um.bySub[sub]
+	if !ok || *u.Iss != iss {
+		return nil, false
+	}
+	return u, true
+}
+
+func (um *usersMock) LinkSub(email string, iss string, sub string) (*model.User, bool) {
+	u, ok := um.byEmail[email]
+	if !ok || u.Sub != nil || u.EmailVerified == nil || !*u.EmailVerified {
+		return nil, false
+	}
+	u.Iss = &iss
+	u.Sub = &sub
+	um.bySub[sub] = u
+	return u, true
+}
+
+func (um *usersMock) GetByID(id uint64) (*model.User, bool) {
+	for _, u := range um.bySub {
+		if u.ID == id {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+func (um *usersMock) Update(id uint64, profile *model.UserProfile) (*model.UserPublicData, error) {
+	um.updated = profile
+	return nil, nil
+}
+
+func TestUserHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		iss           string
+		sub           string
+		email         string
+		emailVerified bool
+		displayName   string
+		wantUserID    uint64
+		wantName      *string
+		wantErr       bool
+	}{
+		{"found by sub even if email has been changed", testIssuer, "sub-1", "changed@example.com", false, "", 1, ptr.String("foo"), false},
+		{"link existing user by email", testIssuer, "sub-2", "bar@example.com", true, "bar", 2, ptr.String("bar"), false},
+		{"email not verified by the identity provider", testIssuer, "sub-2", "bar@example.com", false, "bar", 0, nil, true},
+		{"email of the user not verified", testIssuer, "sub-4", "baz@example.com", true, "", 0, nil, true},
+		{"not found", testIssuer, "sub-3", "unknown@example.com", true, "", 0, nil, true},
+		{"same sub of another issuer", "https://other.example.com", "sub-1", "foo@example.com", true, "", 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &usersMock{
+				bySub: map[string]*model.User{
+					"sub-1": {Common: model.Common{ID: 1}, Iss: ptr.String(testIssuer), Sub: ptr.String("sub-1"), Email: "foo@example.com",
+						UserPublicData: model.UserPublicData{UserProfile: model.UserProfile{DisplayName: ptr.String("foo")}}},
+				},
+				byEmail: map[string]*model.User{
+					"bar@example.com": {Common: model.Common{ID: 2}, Email: "bar@example.com", EmailVerified: ptr.Bool(true)},
+					"baz@example.com": {Common: model.Common{ID: 3}, Email: "baz@example.com", EmailVerified: ptr.Bool(false)},
+				},
+			}
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/", nil)
+			c.Set(factory.ServiceKey, &serviceFactoryMock{users: users})
+			c.Set("iss", tt.iss)
+			c.Set("sub", tt.sub)
+			c.Set("email", tt.email)
+			c.Set("email_verified", tt.emailVerified)
+			c.Set("display_name", tt.displayName)
+
+			err := server.UserHandler(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UserHandler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, server.ErrUserNotLinked))
+				return
+			}
+			user := c.MustGet("user").(*model.User)
+			assert.Equal(t, tt.wantUserID, user.ID)
+			assert.Equal(t, tt.wantUserID, user.UserID)
+			assert.Equal(t, tt.wantName, user.DisplayName)
+		})
+	}
+}
+
+func TestUserMiddleware_ActAs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	users := &usersMock{
+		bySub: map[string]*model.User{
+			"admin-1": {Common: model.Common{ID: 1}, Iss: ptr.String(testIssuer), Sub: ptr.String("admin-1"), Role: model.RoleAdmin},
+			"admin-2": {Common: model.Common{ID: 2}, Iss: ptr.String(testIssuer), Sub: ptr.String("admin-2"), Role: model.RoleAdmin},
+			"user-3":  {Common: model.Common{ID: 3}, Iss: ptr.String(testIssuer), Sub: ptr.String("user-3"), Role: model.RoleUser},
+			"user-4":  {Common: model.Common{ID: 4}, Iss: ptr.String(testIssuer), Sub: ptr.String("user-4"), Role: model.RoleUser},
+			"user-5":  {Common: model.Common{ID: 5, IsDeleted: ptr.Bool(true)}, Iss: ptr.String(testIssuer), Sub: ptr.String("user-5"), Role: model.RoleUser},
+			"user-6":  {Common: model.Common{ID: 6, IsEnabled: ptr.Bool(false)}, Iss: ptr.String(testIssuer), Sub: ptr.String("user-6"), Role: model.RoleUser},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		sub         string
+		authMethod  string
+		actAs       string
+		wantStatus  int
+		wantUserID  uint64
+		wantActorID uint64
+	}{
+		{"admin acts as user", "admin-1", server.AuthMethodJWT, "3", http.StatusOK, 3, 1},
+		{"without header", "admin-1", server.AuthMethodJWT, "", http.StatusOK, 1, 0},
+		{"user can't act as another user", "user-4", server.AuthMethodJWT, "3", http.StatusForbidden, 0, 0},
+		{"admin can't act as another admin", "admin-1", server.AuthMethodJWT, "2", http.StatusForbidden, 0, 0},
+		{"API key can't act as user", "admin-1", server.AuthMethodAPIKey, "3", http.StatusForbidden, 0, 0},
+		{"unknown user", "admin-1", server.AuthMethodJWT, "99", http.StatusNotFound, 0, 0},
+		{"deleted user", "admin-1", server.AuthMethodJWT, "5", http.StatusNotFound, 0, 0},
+		{"disabled user", "admin-1", server.AuthMethodJWT, "6", http.StatusNotFound, 0, 0},
+		{"invalid user id", "admin-1", server.AuthMethodJWT, "user-3", http.StatusNotFound, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user, actor *model.User
+			r := gin.New()
+			r.Use(server.ServiceKeyMiddleware(&serviceFactoryMock{users: users}))
+			r.GET("/", func(c *gin.Context) {
+				c.Set("iss", testIssuer)
+				c.Set("sub", tt.sub)
+				c.Set("auth_method", tt.authMethod)
+			}, server.UserMiddleware(), func(c *gin.Context) {
+				user = c.MustGet("user").(*model.User)
+				actor, _ = server.GetActor(c)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			if tt.actAs != "" {
+				req.Header.Set(server.ActAsHeader, tt.actAs)
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.wantUserID, user.ID)
+			if tt.wantActorID == 0 {
+				assert.Nil(t, actor)
+			} else if assert.NotNil(t, actor) {
+				assert.Equal(t, tt.wantActorID, actor.ID)
+			}
+		})
+	}
+}
+
+func TestDenyImpersonation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		actor      *model.User
+		wantStatus int
+	}{
+		{"user", nil, http.StatusOK},
+		{"impersonating admin", &model.User{Common: model.Common{ID: 1}, Role: model.RoleAdmin}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				if tt.actor != nil {
+					c.Set("actor", tt.actor)
+				}
+			}, server.DenyImpersonation(), func(c *gin.Context) {})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
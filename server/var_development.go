@@ -2,5 +2,5 @@
 
 package server
 
-// DisableVerification allows local server pass through all JWT in development mode.
-var DisableVerification = true
+// DevTokenIssuerEnabled enables POST /dev/token which signs tokens with a local key in development mode.
+const DevTokenIssuerEnabled = true
@@ -2,5 +2,5 @@
 
 package server
 
-// DisableVerification won't pass through invalid JWT in production mode.
-var DisableVerification = false
+// DevTokenIssuerEnabled disables the local token issuer in production mode.
+const DevTokenIssuerEnabled = false
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	// apiKeyTokenPrefix makes leaked tokens easy to find by secret scanners.
+	apiKeyTokenPrefix = "gxs"
+	// apiKeyTouchInterval throttles updating last_used_at.
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	// ErrInvalidAPIKey is returned when the API key is malformed, unknown, revoked or expired.
+	ErrInvalidAPIKey = errors.New("API key is not valid")
+	// ErrAPIKeyNotFound is returned when the API key to revoke does not exist.
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// APIKeysInterface defines API keys service interface.
+type APIKeysInterface interface {
+	Create(userID uint64, body *model.APIKeyCreateBody) (*model.APIKeyCreated, error)
+	GetByUserID(userID uint64) ([]*model.APIKey, error)
+	Revoke(userID uint64, id uint64) error
+	Authenticate(token string) (*model.APIKey, *model.User, error)
+}
+
+// APIKeys implements API keys service.
+type APIKeys struct {
+	repo  repository.APIKeysInterface
+	users repository.UsersInterface
+}
+
+// NewAPIKeys initializes API keys service.
+func NewAPIKeys(repo repository.APIKeysInterface, users repository.UsersInterface) APIKeysInterface {
+	k := APIKeys{
+		repo:  repo,
+		users: users,
+	}
+	return &k
+}
+
+// Create issues a new API key. Only the hash of the secret is stored.
+func (k *APIKeys) Create(userID uint64, body *model.APIKeyCreateBody) (*model.APIKeyCreated, error) {
+	now := util.GetTimeNow()
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	prefix, err := randomString(4, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	// gxs_<prefix>_<secret>
+	token := strings.Join([]string{apiKeyTokenPrefix, prefix, secret}, "_")
+
+	scopes := body.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	key := model.APIKey{
+		UserID:     userID,
+		Name:       body.Name,
+		Prefix:     prefix,
+		SecretHash: hashAPIKey(token),
+		Scopes:     scopes,
+		ExpiresAt:  body.ExpiresAt,
+		CreatedAt:  &now,
+	}
+	if err := k.repo.Create(&key); err != nil {
+		return nil, err
+	}
+
+	return &model.APIKeyCreated{APIKey: key, Token: token}, nil
+}
+
+// GetByUserID returns the user's API keys.
+func (k *APIKeys) GetByUserID(userID uint64) ([]*model.APIKey, error) {
+	return k.repo.GetByUserID(userID)
+}
+
+// Revoke revokes the user's API key.
+func (k *APIKeys) Revoke(userID uint64, id uint64) error {
+	ok, err := k.repo.Revoke(userID, id, util.GetTimeNow())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate verifies the API key token and returns the key and its owner.
+func (k *APIKeys) Authenticate(token string) (*model.APIKey, *model.User, error) {
+	parts := strings.SplitN(token, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyTokenPrefix {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, ok := k.repo.GetByPrefix(parts[1])
+	if !ok {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashAPIKey(token))) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	now := util.GetTimeNow()
+	if key.IsExpired(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, ok := k.users.GetByID(key.UserID)
+	if !ok || (user.IsDeleted != nil && *user.IsDeleted) || (user.IsEnabled != nil && !*user.IsEnabled) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := k.repo.Touch(key.ID, now); err == nil {
+			key.LastUsedAt = &now
+		}
+	}
+	return key, user, nil
+}
+
+// hashAPIKey returns SHA-256 of the token.
+// A slow hash is not needed because the secret has 256 bits of entropy.
+func hashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
@@ -0,0 +1,119 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+// apiKeysRepositoryMock stores API keys in memory.
+type apiKeysRepositoryMock struct {
+	repository.APIKeysInterface
+	keys    []*model.APIKey
+	touched int
+}
+
+func (kr *apiKeysRepositoryMock) Create(key *model.APIKey) error {
+	key.ID = uint64(len(kr.keys) + 1)
+	kr.keys = append(kr.keys, key)
+	return nil
+}
+
+func (kr *apiKeysRepositoryMock) GetByPrefix(prefix string) (*model.APIKey, bool) {
+	for _, k := range kr.keys {
+		if k.Prefix == prefix && k.RevokedAt == nil {
+			copied := *k
+			return &copied, true
+		}
+	}
+	return nil, false
+}
+
+func (kr *apiKeysRepositoryMock) Revoke(userID uint64, id uint64, revokedAt time.Time) (bool, error) {
+	for _, k := range kr.keys {
+		if k.ID == id && k.UserID == userID && k.RevokedAt == nil {
+			k.RevokedAt = &revokedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (kr *apiKeysRepositoryMock) Touch(id uint64, usedAt time.Time) error {
+	kr.touched++
+	kr.keys[id-1].LastUsedAt = &usedAt
+	return nil
+}
+
+func TestAPIKeys_CreateAndAuthenticate(t *testing.T) {
+	repo := &apiKeysRepositoryMock{}
+	users := &usersRepositoryMock{
+		FakeGetByID: func(id uint64) (*model.User, bool) {
+			return &model.User{Common: model.Common{ID: id, IsDeleted: ptr.Bool(false), IsEnabled: ptr.Bool(true)}}, true
+		},
+	}
+	k := service.NewAPIKeys(repo, users)
+
+	assert := assert.New(t)
+	created, err := k.Create(1, &model.APIKeyCreateBody{Name: "batch", Scopes: []string{"fruits:write"}})
+	if err != nil {
+		t.Fatalf("APIKeys.Create() error = %v", err)
+	}
+	assert.True(strings.HasPrefix(created.Token, "gxs_"+created.Prefix+"_"))
+	assert.NotContains(repo.keys[0].SecretHash, created.Token, "secret must not be stored")
+
+	key, user, err := k.Authenticate(created.Token)
+	if assert.NoError(err) {
+		assert.Equal(created.ID, key.ID)
+		assert.Equal(uint64(1), user.ID)
+		assert.Equal([]string{"fruits:write"}, key.Scopes)
+	}
+
+	// last_used_at is updated once in a while.
+	_, _, _ = k.Authenticate(created.Token)
+	assert.Equal(1, repo.touched)
+
+	for _, token := range []string{
+		"",
+		created.Token + "x",
+		"xxx_" + created.Prefix + "_secret",
+		"gxs_ffffffff_secret",
+	} {
+		_, _, err := k.Authenticate(token)
+		assert.Equal(service.ErrInvalidAPIKey, err, "token %q", token)
+	}
+
+	// other users cannot revoke the key.
+	assert.Equal(service.ErrAPIKeyNotFound, k.Revoke(2, created.ID))
+	assert.NoError(k.Revoke(1, created.ID))
+	_, _, err = k.Authenticate(created.Token)
+	assert.Equal(service.ErrInvalidAPIKey, err)
+}
+
+func TestAPIKeys_Expiry(t *testing.T) {
+	repo := &apiKeysRepositoryMock{}
+	users := &usersRepositoryMock{
+		FakeGetByID: func(id uint64) (*model.User, bool) {
+			return &model.User{Common: model.Common{ID: id}}, true
+		},
+	}
+	k := service.NewAPIKeys(repo, users)
+
+	_, err := k.Create(1, &model.APIKeyCreateBody{Name: "past", ExpiresAt: ptr.Time(time.Now().Add(-time.Hour))})
+	assert.Error(t, err)
+
+	created, err := k.Create(1, &model.APIKeyCreateBody{Name: "soon", ExpiresAt: ptr.Time(time.Now().Add(time.Hour))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.keys[0].ExpiresAt = ptr.Time(time.Now().Add(-time.Second))
+
+	_, _, err = k.Authenticate(created.Token)
+	assert.Equal(t, service.ErrInvalidAPIKey, err)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+// ErrCookieSessionNotFound is returned when the cookie session does not exist or is expired.
+var ErrCookieSessionNotFound = errors.New("session is not found or expired")
+
+// CookieSessionsInterface defines browser cookie sessions service interface.
+type CookieSessionsInterface interface {
+	Create(session *model.CookieSession) (id string, err error)
+	Get(id string) (*model.CookieSession, error)
+	Delete(id string) error
+}
+
+// CookieSessions implements browser cookie sessions service.
+type CookieSessions struct {
+	repo   repository.CookieSessionsInterface
+	config *SessionConfig
+}
+
+// NewCookieSessions initializes browser cookie sessions service.
+func NewCookieSessions(repo repository.CookieSessionsInterface, config *SessionConfig) CookieSessionsInterface {
+	s := CookieSessions{
+		repo:   repo,
+		config: config,
+	}
+	return &s
+}
+
+// Create stores the session with a new CSRF token and returns its id.
+// The id is a secret to be set to an HttpOnly cookie.
+func (s *CookieSessions) Create(session *model.CookieSession) (string, error) {
+	id, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+	csrfToken, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+	session.CSRFToken = csrfToken
+	session.ExpiresAt = util.GetTimeNow().Add(s.config.CookieMaxAge)
+
+	if err := s.repo.Create(id, session, s.config.CookieMaxAge); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Get returns the session which is not expired.
+func (s *CookieSessions) Get(id string) (*model.CookieSession, error) {
+	session, err := s.repo.Get(id)
+	if err == infra.ErrKVSNotFound {
+		return nil, ErrCookieSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !util.GetTimeNow().Before(session.ExpiresAt) {
+		return nil, ErrCookieSessionNotFound
+	}
+	return session, nil
+}
+
+// Delete deletes the session. ("log out")
+func (s *CookieSessions) Delete(id string) error {
+	return s.repo.Delete(id)
+}
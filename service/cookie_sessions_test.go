@@ -0,0 +1,62 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// cookieSessionsRepositoryMock stores sessions in memory.
+type cookieSessionsRepositoryMock struct {
+	repository.CookieSessionsInterface
+	store map[string]*model.CookieSession
+	ttl   time.Duration
+}
+
+func (sr *cookieSessionsRepositoryMock) Create(id string, session *model.CookieSession, ttl time.Duration) error {
+	sr.store[id] = session
+	sr.ttl = ttl
+	return nil
+}
+
+func (sr *cookieSessionsRepositoryMock) Get(id string) (*model.CookieSession, error) {
+	session, ok := sr.store[id]
+	if !ok {
+		return nil, infra.ErrKVSNotFound
+	}
+	return session, nil
+}
+
+func TestCookieSessions(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	util.GetTimeNowFunc = func() time.Time { return now }
+	defer func() { util.GetTimeNowFunc = time.Now }()
+
+	repo := &cookieSessionsRepositoryMock{store: map[string]*model.CookieSession{}}
+	s := service.NewCookieSessions(repo, &service.SessionConfig{CookieMaxAge: time.Hour})
+
+	assert := assert.New(t)
+	id, err := s.Create(&model.CookieSession{Sub: "abc"})
+	assert.NoError(err)
+	assert.NotEmpty(id)
+	assert.Equal(time.Hour, repo.ttl)
+
+	session, err := s.Get(id)
+	assert.NoError(err)
+	assert.NotEmpty(session.CSRFToken)
+	assert.NotEqual(id, session.CSRFToken)
+	assert.Equal(now.Add(time.Hour), session.ExpiresAt)
+
+	_, err = s.Get("unknown")
+	assert.Equal(service.ErrCookieSessionNotFound, err)
+
+	now = now.Add(time.Hour)
+	_, err = s.Get(id)
+	assert.Equal(service.ErrCookieSessionNotFound, err, "expired")
+}
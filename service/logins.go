@@ -0,0 +1,50 @@
+package service
+
+import (
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+// loginHistoryLimit is the number of logins returned by GetByUserID.
+const loginHistoryLimit = 50
+
+// LoginsInterface defines login history service interface.
+type LoginsInterface interface {
+	Record(userID uint64, sessionID string, ip string, userAgent string) (*model.Login, bool, error)
+	GetByUserID(userID uint64) ([]*model.Login, error)
+}
+
+// Logins implements login history service.
+type Logins struct {
+	repo repository.LoginsInterface
+}
+
+// NewLogins initializes login history service.
+func NewLogins(repo repository.LoginsInterface) LoginsInterface {
+	l := Logins{repo}
+	return &l
+}
+
+// Record records a successful authentication of the session once.
+// It returns true when the session is recorded for the first time.
+func (l *Logins) Record(userID uint64, sessionID string, ip string, userAgent string) (*model.Login, bool, error) {
+	now := util.GetTimeNow()
+	login := &model.Login{
+		UserID:    userID,
+		SessionID: sessionID,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: &now,
+	}
+	created, err := l.repo.Record(login, now)
+	if err != nil {
+		return nil, false, err
+	}
+	return login, created, nil
+}
+
+// GetByUserID returns the latest logins of the user.
+func (l *Logins) GetByUserID(userID uint64) ([]*model.Login, error) {
+	return l.repo.GetByUserID(userID, loginHistoryLimit)
+}
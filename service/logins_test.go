@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// loginsRepositoryMock is a mock for Logins repository.
+type loginsRepositoryMock struct {
+	repository.LoginsInterface
+	FakeRecord      func(login *model.Login, loggedInAt time.Time) (bool, error)
+	FakeGetByUserID func(userID uint64, limit int) ([]*model.Login, error)
+}
+
+func (lr *loginsRepositoryMock) Record(login *model.Login, loggedInAt time.Time) (bool, error) {
+	return lr.FakeRecord(login, loggedInAt)
+}
+
+func (lr *loginsRepositoryMock) GetByUserID(userID uint64, limit int) ([]*model.Login, error) {
+	return lr.FakeGetByUserID(userID, limit)
+}
+
+func TestLogins_Record(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	util.GetTimeNowFunc = func() time.Time { return now }
+	defer func() { util.GetTimeNowFunc = time.Now }()
+
+	tests := []struct {
+		name        string
+		created     bool
+		err         error
+		wantCreated bool
+		wantErr     bool
+	}{
+		{"first login", true, nil, true, false},
+		{"same session", false, nil, false, false},
+		{"failure", false, fmt.Errorf("db error"), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var recorded *model.Login
+			repo := &loginsRepositoryMock{
+				FakeRecord: func(login *model.Login, loggedInAt time.Time) (bool, error) {
+					recorded = login
+					assert.Equal(t, now, loggedInAt)
+					return tt.created, tt.err
+				},
+			}
+			l := service.NewLogins(repo)
+
+			_, created, err := l.Record(1, "jti:aaa", "127.0.0.1", "httptest")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Logins.Record() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantCreated, created)
+			assert.Equal(t, &model.Login{
+				UserID:    1,
+				SessionID: "jti:aaa",
+				IP:        "127.0.0.1",
+				UserAgent: "httptest",
+				CreatedAt: &now,
+			}, recorded)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	sessionRevocationTTLEnv = "SESSION_REVOCATION_TTL_SECOND"
+	sessionCookieMaxAgeEnv  = "SESSION_COOKIE_MAX_AGE_SECOND"
+
+	// defaultSessionRevocationTTL is the default lifetime of Cognito refresh tokens.
+	defaultSessionRevocationTTL = 30 * 24 * time.Hour
+	defaultSessionCookieMaxAge  = 24 * time.Hour
+
+	// sessionListLimit is the number of sessions returned by GetActiveByUserID.
+	sessionListLimit = 50
+)
+
+// ErrSessionNotFound is returned when the session to revoke does not exist.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionConfig has login session settings.
+type SessionConfig struct {
+	// RevocationTTL is how long revoked tokens are rejected.
+	// It must be longer than the lifetime of tokens, or refresh tokens when "origin_jti" is used.
+	RevocationTTL time.Duration
+	// CookieMaxAge is the lifetime of browser cookie sessions.
+	CookieMaxAge time.Duration
+}
+
+// LoadSessionConfigEnv initializes SessionConfig using Environment Variables.
+func LoadSessionConfigEnv() *SessionConfig {
+	conf := &SessionConfig{
+		RevocationTTL: loadDurationSecondEnv(sessionRevocationTTLEnv, defaultSessionRevocationTTL),
+		CookieMaxAge:  loadDurationSecondEnv(sessionCookieMaxAgeEnv, defaultSessionCookieMaxAge),
+	}
+	return conf
+}
+
+func loadDurationSecondEnv(env string, defaultValue time.Duration) time.Duration {
+	v := os.Getenv(env)
+	if v == "" {
+		return defaultValue
+	}
+	sec, err := strconv.Atoi(v)
+	if err != nil || sec <= 0 {
+		util.GetLogger().Warnf("%v expects positive int value, but %q was given. use default %v",
+			env, v, defaultValue)
+		return defaultValue
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// SessionsInterface defines login sessions service interface.
+type SessionsInterface interface {
+	GetActiveByUserID(userID uint64, currentSessionID string) ([]*model.Session, error)
+	Revoke(userID uint64, id uint64) error
+	RevokeAll(userID uint64) error
+	IsRevoked(iss string, sub string, sessionIDs []string, issuedAt time.Time) (bool, error)
+	RestoreRevocations() (int, error)
+	RestoreRevocationsIfLost() (int, error)
+}
+
+// Sessions implements login sessions service.
+type Sessions struct {
+	repo repository.SessionsInterface
+}
+
+// NewSessions initializes login sessions service.
+func NewSessions(repo repository.SessionsInterface) SessionsInterface {
+	s := Sessions{repo}
+	return &s
+}
+
+// GetActiveByUserID returns the sessions which are not revoked.
+// The session of currentSessionID is marked as current.
+func (s *Sessions) GetActiveByUserID(userID uint64, currentSessionID string) ([]*model.Session, error) {
+	logins, err := s.repo.GetActiveByUserID(userID, sessionListLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*model.Session, 0, len(logins))
+	for _, login := range logins {
+		list = append(list, &model.Session{
+			Login:   *login,
+			Current: login.SessionID == currentSessionID,
+		})
+	}
+	return list, nil
+}
+
+// Revoke revokes the user's session. Tokens of the session are rejected on every API instance.
+func (s *Sessions) Revoke(userID uint64, id uint64) error {
+	ok, err := s.repo.Revoke(userID, id, util.GetTimeNow())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll revokes all sessions of the user. ("log out everywhere")
+// API keys are not revoked.
+func (s *Sessions) RevokeAll(userID uint64) error {
+	// MySQL DATETIME has no fraction. tokens issued in the same second are revoked.
+	return s.repo.RevokeAll(userID, util.GetTimeNow().Truncate(time.Second))
+}
+
+// IsRevoked returns true when the token of the user (iss and sub) with the session ids issued at issuedAt is revoked.
+func (s *Sessions) IsRevoked(iss string, sub string, sessionIDs []string, issuedAt time.Time) (bool, error) {
+	return s.repo.IsRevoked(iss, sub, sessionIDs, issuedAt)
+}
+
+// RestoreRevocations publishes revocations to the key-value store again.
+func (s *Sessions) RestoreRevocations() (int, error) {
+	return s.repo.RestoreRevocations(util.GetTimeNow())
+}
+
+// RestoreRevocationsIfLost restores revocations only when the key-value store has lost them.
+func (s *Sessions) RestoreRevocationsIfLost() (int, error) {
+	lost, err := s.repo.RevocationsLost()
+	if err != nil || !lost {
+		return 0, err
+	}
+	return s.RestoreRevocations()
+}
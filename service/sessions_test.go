@@ -0,0 +1,136 @@
+package service_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// sessionsRepositoryMock is a mock for Sessions repository.
+type sessionsRepositoryMock struct {
+	repository.SessionsInterface
+	FakeGetActiveByUserID func(userID uint64, limit int) ([]*model.Login, error)
+	FakeRevoke            func(userID uint64, id uint64, revokedAt time.Time) (bool, error)
+	FakeRevokeAll         func(userID uint64, revokedAt time.Time) error
+	FakeRestore           func(now time.Time) (int, error)
+	FakeRevocationsLost   func() (bool, error)
+}
+
+func (sr *sessionsRepositoryMock) GetActiveByUserID(userID uint64, limit int) ([]*model.Login, error) {
+	return sr.FakeGetActiveByUserID(userID, limit)
+}
+
+func (sr *sessionsRepositoryMock) Revoke(userID uint64, id uint64, revokedAt time.Time) (bool, error) {
+	return sr.FakeRevoke(userID, id, revokedAt)
+}
+
+func (sr *sessionsRepositoryMock) RevokeAll(userID uint64, revokedAt time.Time) error {
+	return sr.FakeRevokeAll(userID, revokedAt)
+}
+
+func (sr *sessionsRepositoryMock) RestoreRevocations(now time.Time) (int, error) {
+	return sr.FakeRestore(now)
+}
+
+func (sr *sessionsRepositoryMock) RevocationsLost() (bool, error) {
+	return sr.FakeRevocationsLost()
+}
+
+func TestSessions_GetActiveByUserID(t *testing.T) {
+	repo := &sessionsRepositoryMock{
+		FakeGetActiveByUserID: func(userID uint64, limit int) ([]*model.Login, error) {
+			return []*model.Login{
+				{ID: 2, UserID: userID, SessionID: "origin_jti:bbb"},
+				{ID: 1, UserID: userID, SessionID: "origin_jti:aaa"},
+			}, nil
+		},
+	}
+	s := service.NewSessions(repo)
+
+	list, err := s.GetActiveByUserID(1, "origin_jti:aaa")
+	assert.NoError(t, err)
+	if assert.Len(t, list, 2) {
+		assert.False(t, list[0].Current)
+		assert.True(t, list[1].Current)
+	}
+}
+
+func TestSessions_Revoke(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	util.GetTimeNowFunc = func() time.Time { return now }
+	defer func() { util.GetTimeNowFunc = time.Now }()
+
+	tests := []struct {
+		name    string
+		ok      bool
+		err     error
+		wantErr error
+	}{
+		{"revoked", true, nil, nil},
+		{"not found", false, nil, service.ErrSessionNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &sessionsRepositoryMock{
+				FakeRevoke: func(userID uint64, id uint64, revokedAt time.Time) (bool, error) {
+					assert.Equal(t, now, revokedAt)
+					return tt.ok, tt.err
+				},
+			}
+			err := service.NewSessions(repo).Revoke(1, 2)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestSessions_RevokeAll(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 123, time.UTC)
+	util.GetTimeNowFunc = func() time.Time { return now }
+	defer func() { util.GetTimeNowFunc = time.Now }()
+
+	var got time.Time
+	repo := &sessionsRepositoryMock{
+		FakeRevokeAll: func(userID uint64, revokedAt time.Time) error {
+			got = revokedAt
+			return fmt.Errorf("db error")
+		},
+	}
+	err := service.NewSessions(repo).RevokeAll(1)
+	assert.Error(t, err)
+	// truncated to be stored in DATETIME.
+	assert.Equal(t, now.Truncate(time.Second), got)
+}
+
+func TestSessions_RestoreRevocationsIfLost(t *testing.T) {
+	tests := []struct {
+		name      string
+		lost      bool
+		want      int
+		wantCalls int
+	}{
+		{"lost", true, 3, 1},
+		{"kept", false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			repo := &sessionsRepositoryMock{
+				FakeRevocationsLost: func() (bool, error) { return tt.lost, nil },
+				FakeRestore: func(now time.Time) (int, error) {
+					calls++
+					return 3, nil
+				},
+			}
+			count, err := service.NewSessions(repo).RestoreRevocationsIfLost()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, count)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
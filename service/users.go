@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/itomofumi/go-gin-xorm-starter/model"
@@ -10,11 +11,13 @@ import (
 // UsersInterface はサポーター管理サービスです
 type UsersInterface interface {
 	Create(email string, profile *model.UserProfile) (*model.UserPublicData, error)
-	GetByID(uint64) (user *model.User, ok bool)
+	GetByID(id uint64) (user *model.User, ok bool)
 	GetByEmail(email string) (user *model.User, ok bool)
+	GetBySub(iss string, sub string) (user *model.User, ok bool)
+	LinkSub(email string, iss string, sub string) (user *model.User, ok bool)
 	Verify(userID uint64) error
-	Update(uint64, *model.UserProfile) (*model.UserPublicData, error)
-	Delete(uint64) error
+	Update(id uint64, profile *model.UserProfile) (*model.UserPublicData, error)
+	Delete(id uint64) error
 }
 
 // Users はサポーターのサービス実装
@@ -28,6 +31,10 @@ func NewUsers(repo repository.UsersInterface) UsersInterface {
 	return &u
 }
 
+// ErrVerificationPending is returned by Create when the email is registered but not verified yet.
+// The pending user is kept, so that others can't take over the email before the owner verifies it.
+var ErrVerificationPending = errors.New("user is waiting for email verification")
+
 // Create はユーザを登録
 func (u *Users) Create(email string, profile *model.UserProfile) (*model.UserPublicData, error) {
 
@@ -38,9 +45,7 @@ func (u *Users) Create(email string, profile *model.UserProfile) (*model.UserPub
 		if currentUser.EmailVerified != nil && *currentUser.EmailVerified {
 			return nil, fmt.Errorf("user is already verified")
 		}
-		// Delete temporary user.
-		// Don't care wheather success or not.
-		_ = u.Delete(currentUser.ID)
+		return nil, ErrVerificationPending
 	}
 
 	return u.repo.Create(email, profile)
@@ -56,6 +61,19 @@ func (u *Users) GetByEmail(email string) (user *model.User, ok bool) {
 	return u.repo.GetByEmail(email)
 }
 
+// GetBySub はIDプロバイダ (issuer) のsubjectでユーザを取得します
+func (u *Users) GetBySub(iss string, sub string) (user *model.User, ok bool) {
+	return u.repo.GetBySub(iss, sub)
+}
+
+// LinkSub はsubjectが未登録のユーザにIDプロバイダ (issuer) のsubjectを紐付けます
+func (u *Users) LinkSub(email string, iss string, sub string) (user *model.User, ok bool) {
+	if email == "" || iss == "" || sub == "" {
+		return nil, false
+	}
+	return u.repo.LinkSub(email, iss, sub)
+}
+
 // Verify はユーザーを認証済みにします
 func (u *Users) Verify(userID uint64) error {
 	return u.repo.Verify(userID)
@@ -4,28 +4,44 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/itomofumi/go-gin-xorm-starter/model"
 	"github.com/itomofumi/go-gin-xorm-starter/repository"
 	"github.com/itomofumi/go-gin-xorm-starter/service"
 	"github.com/itomofumi/ptr"
+	"github.com/stretchr/testify/assert"
 )
 
 // usersRepositoryMock is a mock for Users repository.
 type usersRepositoryMock struct {
 	repository.UsersInterface
 	FakeGetByEmail func(email string) (user *model.User, ok bool)
+	FakeGetBySub   func(iss string, sub string) (user *model.User, ok bool)
+	FakeLinkSub    func(email string, iss string, sub string) (user *model.User, ok bool)
 	FakeCreate     func(email string, profile *model.UserProfile) (*model.UserPublicData, error)
 	FakeDelete     func(id uint64) error
 	FakeGetByID    func(id uint64) (user *model.User, ok bool)
 	FakeVerify     func(userID uint64) error
 	FakeUpdate     func(id uint64, profile *model.UserProfile) (*model.UserPublicData, error)
+
+	FakeMarkVerificationSent   func(userID uint64, sentAt time.Time, interval time.Duration) (bool, error)
+	FakeUnmarkVerificationSent func(userID uint64, sentAt time.Time) error
+	FakeConsumeVerification    func(userID uint64, sentAt time.Time) (bool, error)
 }
 
 func (ur *usersRepositoryMock) GetByEmail(email string) (user *model.User, ok bool) {
 	return ur.FakeGetByEmail(email)
 }
 
+func (ur *usersRepositoryMock) GetBySub(iss string, sub string) (user *model.User, ok bool) {
+	return ur.FakeGetBySub(iss, sub)
+}
+
+func (ur *usersRepositoryMock) LinkSub(email string, iss string, sub string) (user *model.User, ok bool) {
+	return ur.FakeLinkSub(email, iss, sub)
+}
+
 func (ur *usersRepositoryMock) Create(email string, profile *model.UserProfile) (*model.UserPublicData, error) {
 	return ur.FakeCreate(email, profile)
 }
@@ -42,6 +58,18 @@ func (ur *usersRepositoryMock) Verify(userID uint64) error {
 	return ur.FakeVerify(userID)
 }
 
+func (ur *usersRepositoryMock) MarkVerificationSent(userID uint64, sentAt time.Time, interval time.Duration) (bool, error) {
+	return ur.FakeMarkVerificationSent(userID, sentAt, interval)
+}
+
+func (ur *usersRepositoryMock) UnmarkVerificationSent(userID uint64, sentAt time.Time) error {
+	return ur.FakeUnmarkVerificationSent(userID, sentAt)
+}
+
+func (ur *usersRepositoryMock) ConsumeVerification(userID uint64, sentAt time.Time) (bool, error) {
+	return ur.FakeConsumeVerification(userID, sentAt)
+}
+
 func (ur *usersRepositoryMock) Update(id uint64, profile *model.UserProfile) (*model.UserPublicData, error) {
 	return ur.FakeUpdate(id, profile)
 }
@@ -92,24 +120,6 @@ func TestUsers_Create(t *testing.T) {
 			testUsers[0].GetPublicData(),
 			false,
 		},
-		{
-			"success for secondary creation",
-			fakes{
-				getByEmail: func(email string) (user *model.User, ok bool) {
-					return &model.User{EmailVerified: ptr.Bool(false)}, true
-				},
-				create: func(email string, profile *model.UserProfile) (*model.UserPublicData, error) {
-					return testUsers[0].GetPublicData(), nil
-				},
-				delete: func(id uint64) error { return nil },
-			},
-			args{
-				email:   "foo@example.com",
-				profile: &testUsers[0].UserProfile,
-			},
-			testUsers[0].GetPublicData(),
-			false,
-		},
 		{
 			"failure for verified email",
 			fakes{
@@ -150,6 +160,28 @@ func TestUsers_Create(t *testing.T) {
 	}
 }
 
+func TestUsers_Create_VerificationPending(t *testing.T) {
+	pending := &model.User{Common: model.Common{ID: 1}, Email: "foo@example.com", EmailVerified: ptr.Bool(false)}
+	repo := &usersRepositoryMock{
+		FakeGetByEmail: func(email string) (*model.User, bool) { return pending, email == pending.Email },
+		FakeCreate: func(email string, profile *model.UserProfile) (*model.UserPublicData, error) {
+			t.Fatalf("Users.Create() created another user of %v", email)
+			return nil, nil
+		},
+		FakeDelete: func(id uint64) error {
+			t.Fatalf("Users.Create() deleted the pending user id = %v", id)
+			return nil
+		},
+	}
+	u := service.NewUsers(repo)
+
+	_, err := u.Create(pending.Email, &model.UserProfile{DisplayName: ptr.String("stranger")})
+	assert.Equal(t, service.ErrVerificationPending, err)
+	got, ok := u.GetByEmail(pending.Email)
+	assert.True(t, ok)
+	assert.Equal(t, pending, got)
+}
+
 func TestUsers_Verify(t *testing.T) {
 	type fakes struct {
 		verify func(userID uint64) error
@@ -301,3 +333,41 @@ func TestUsers_Update(t *testing.T) {
 		})
 	}
 }
+
+func TestUsers_LinkSub(t *testing.T) {
+	type args struct {
+		email string
+		iss   string
+		sub   string
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantCalled bool
+		wantOk     bool
+	}{
+		{"success", args{"foo@example.com", "https://idp.example.com", "abc"}, true, true},
+		{"empty email", args{"", "https://idp.example.com", "abc"}, false, false},
+		{"empty iss", args{"foo@example.com", "", "abc"}, false, false},
+		{"empty sub", args{"foo@example.com", "https://idp.example.com", ""}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			repo := &usersRepositoryMock{
+				FakeLinkSub: func(email string, iss string, sub string) (*model.User, bool) {
+					called = true
+					return &model.User{Email: email, Iss: &iss, Sub: &sub}, true
+				},
+			}
+			u := service.NewUsers(repo)
+			_, ok := u.LinkSub(tt.args.email, tt.args.iss, tt.args.sub)
+			if called != tt.wantCalled {
+				t.Errorf("repository.LinkSub() called = %v, want %v", called, tt.wantCalled)
+			}
+			if ok != tt.wantOk {
+				t.Errorf("Users.LinkSub() ok = %v, want %v", ok, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+)
+
+// DefaultLocale is used when no supported locale is requested.
+const DefaultLocale = "en"
+
+// verificationMailData is passed to verification mail templates.
+type verificationMailData struct {
+	DisplayName *string
+	URL         string
+	ExpireHours int
+}
+
+type mailTemplate struct {
+	subject string
+	body    *template.Template
+}
+
+// verificationMailTemplates are verification mail templates by locale.
+var verificationMailTemplates = map[string]*mailTemplate{
+	"en": {
+		subject: "Verify your email address",
+		body: template.Must(template.New("en").Parse(
+			`Hello{{if .DisplayName}} {{.DisplayName}}{{end}},
+
+Please verify your email address by opening the link below.
+
+{{.URL}}
+
+This link expires in {{.ExpireHours}} hours.
+If you did not sign up, please ignore this email.
+`)),
+	},
+	"ja": {
+		subject: "メールアドレスの確認",
+		body: template.Must(template.New("ja").Parse(
+			`{{if .DisplayName}}{{.DisplayName}} 様{{else}}こんにちは{{end}}
+
+以下のリンクを開いてメールアドレスを確認してください。
+
+{{.URL}}
+
+このリンクの有効期限は {{.ExpireHours}} 時間です。
+お心当たりのない場合は、このメールを破棄してください。
+`)),
+	},
+	"fr": {
+		subject: "Vérifiez votre adresse e-mail",
+		body: template.Must(template.New("fr").Parse(
+			`Bonjour{{if .DisplayName}} {{.DisplayName}}{{end}},
+
+Veuillez vérifier votre adresse e-mail en ouvrant le lien ci-dessous.
+
+{{.URL}}
+
+Ce lien expire dans {{.ExpireHours}} heures.
+Si vous ne vous êtes pas inscrit, veuillez ignorer cet e-mail.
+`)),
+	},
+}
+
+// MatchLocale picks a supported locale from Accept-Language header value.
+func MatchLocale(acceptLanguage string) string {
+	for _, lang := range strings.Split(acceptLanguage, ",") {
+		// "ja-JP;q=0.9" => "ja"
+		tag := strings.TrimSpace(strings.SplitN(lang, ";", 2)[0])
+		tag = strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if _, ok := verificationMailTemplates[tag]; ok {
+			return tag
+		}
+	}
+	return DefaultLocale
+}
+
+func renderVerificationMail(locale string, data *verificationMailData) (*infra.Mail, error) {
+	tmpl, ok := verificationMailTemplates[locale]
+	if !ok {
+		tmpl = verificationMailTemplates[DefaultLocale]
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return nil, err
+	}
+
+	mail := &infra.Mail{
+		Subject: tmpl.subject,
+		Body:    body.String(),
+	}
+	return mail, nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/repository"
+	"github.com/itomofumi/go-gin-xorm-starter/util"
+)
+
+const (
+	verificationSecretEnv         = "EMAIL_VERIFICATION_SECRET"
+	verificationExpireSecondEnv   = "EMAIL_VERIFICATION_EXPIRE_SECOND"
+	verificationResendIntervalEnv = "EMAIL_VERIFICATION_RESEND_INTERVAL_SECOND"
+	verificationURLEnv            = "EMAIL_VERIFICATION_URL"
+
+	defaultVerificationExpire         = 24 * time.Hour
+	defaultVerificationResendInterval = time.Minute
+	defaultVerificationURL            = "http://localhost:3000/v1/users/verify"
+
+	verificationTokenUse = "email_verification"
+)
+
+var (
+	// ErrVerificationThrottled is returned when a verification email was sent recently.
+	ErrVerificationThrottled = errors.New("verification email was sent recently. try again later")
+	// ErrAlreadyVerified is returned when the user is already verified.
+	ErrAlreadyVerified = errors.New("user is already verified")
+	// ErrVerificationUserNotFound is returned when the user to verify does not exist.
+	ErrVerificationUserNotFound = errors.New("user not found")
+)
+
+// VerificationConfig has email verification settings.
+type VerificationConfig struct {
+	// Secret signs verification tokens with HMAC-SHA256.
+	Secret []byte
+	// Expire is the lifetime of verification tokens.
+	Expire time.Duration
+	// ResendInterval throttles sending verification emails per user.
+	ResendInterval time.Duration
+	// URL is the verification link. The token is added as "token" query parameter.
+	URL string
+}
+
+// LoadVerificationConfigEnv initializes VerificationConfig using Environment Variables.
+func LoadVerificationConfigEnv() *VerificationConfig {
+	logger := util.GetLogger()
+	conf := &VerificationConfig{
+		Secret:         []byte(os.Getenv(verificationSecretEnv)),
+		Expire:         defaultVerificationExpire,
+		ResendInterval: defaultVerificationResendInterval,
+		URL:            os.Getenv(verificationURLEnv),
+	}
+
+	if len(conf.Secret) == 0 {
+		// tokens can't be verified after restart nor by other instances.
+		logger.Warnf("%v is not set. use random secret.", verificationSecretEnv)
+		conf.Secret = make([]byte, 32)
+		_, _ = rand.Read(conf.Secret)
+	}
+	if sec, err := strconv.Atoi(os.Getenv(verificationExpireSecondEnv)); err == nil {
+		conf.Expire = time.Duration(sec) * time.Second
+	}
+	if sec, err := strconv.Atoi(os.Getenv(verificationResendIntervalEnv)); err == nil {
+		conf.ResendInterval = time.Duration(sec) * time.Second
+	}
+	if conf.URL == "" {
+		conf.URL = defaultVerificationURL
+	}
+	return conf
+}
+
+// VerificationsInterface handles email verification.
+type VerificationsInterface interface {
+	Send(email string, locale string) error
+	Verify(token string) (*model.User, error)
+}
+
+// Verifications implements VerificationsInterface.
+type Verifications struct {
+	repo   repository.UsersInterface
+	mailer infra.Mailer
+	config *VerificationConfig
+}
+
+// NewVerifications initializes email verification service.
+func NewVerifications(repo repository.UsersInterface, mailer infra.Mailer, config *VerificationConfig) VerificationsInterface {
+	v := Verifications{
+		repo:   repo,
+		mailer: mailer,
+		config: config,
+	}
+	return &v
+}
+
+// verificationClaims are claims of verification tokens.
+type verificationClaims struct {
+	Email string `json:"email"`
+	Use   string `json:"use"`
+	jwt.StandardClaims
+}
+
+// Send sends a verification email rendered in the given locale.
+func (v *Verifications) Send(email string, locale string) error {
+	user, ok := v.repo.GetByEmail(email)
+	if !ok {
+		return ErrVerificationUserNotFound
+	}
+	if user.EmailVerified != nil && *user.EmailVerified {
+		return ErrAlreadyVerified
+	}
+
+	// the token is tied to the marked time by its iat in seconds.
+	now := util.GetTimeNow().Truncate(time.Second)
+	ok, err := v.repo.MarkVerificationSent(user.ID, now, v.config.ResendInterval)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrVerificationThrottled
+	}
+
+	// the user would be throttled without any email.
+	if err := v.send(user, now, locale); err != nil {
+		if unmarkErr := v.repo.UnmarkVerificationSent(user.ID, now); unmarkErr != nil {
+			util.GetLogger().Warnf("failed to unmark verification sent of user id = %v: %v", user.ID, unmarkErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (v *Verifications) send(user *model.User, now time.Time, locale string) error {
+	token, err := v.issueToken(user, now)
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(v.config.URL)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	mail, err := renderVerificationMail(locale, &verificationMailData{
+		DisplayName: user.DisplayName,
+		URL:         link.String(),
+		ExpireHours: int(v.config.Expire.Hours()),
+	})
+	if err != nil {
+		return err
+	}
+	mail.To = []string{user.Email}
+
+	return v.mailer.Send(mail)
+}
+
+// Verify verifies the user by the given token.
+func (v *Verifications) Verify(token string) (*model.User, error) {
+	claims := verificationClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return v.config.Secret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verification token is not valid. [Reason] %v", err)
+	}
+	if claims.Use != verificationTokenUse {
+		return nil, fmt.Errorf("verification token is not valid. [Reason] wrong token use")
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("verification token is not valid. [Reason] %v", err)
+	}
+	user, ok := v.repo.GetByID(userID)
+	if !ok || (user.IsDeleted != nil && *user.IsDeleted) {
+		return nil, ErrVerificationUserNotFound
+	}
+	// the email may have been changed after the token was issued.
+	if user.Email != claims.Email {
+		return nil, fmt.Errorf("verification token is not valid. [Reason] email does not match")
+	}
+
+	if user.EmailVerified != nil && *user.EmailVerified {
+		return nil, ErrAlreadyVerified
+	}
+
+	// only the latest email verifies the user, once.
+	ok, err = v.repo.ConsumeVerification(user.ID, time.Unix(claims.IssuedAt, 0))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("verification token is not valid. [Reason] the token was already used or a newer one was sent")
+	}
+	verified := true
+	user.EmailVerified = &verified
+	return user, nil
+}
+
+func (v *Verifications) issueToken(user *model.User, now time.Time) (string, error) {
+	claims := verificationClaims{
+		Email: user.Email,
+		Use:   verificationTokenUse,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.FormatUint(user.ID, 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(v.config.Expire).Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(v.config.Secret)
+}
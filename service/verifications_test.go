@@ -0,0 +1,211 @@
+package service_test
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itomofumi/go-gin-xorm-starter/infra"
+	"github.com/itomofumi/go-gin-xorm-starter/model"
+	"github.com/itomofumi/go-gin-xorm-starter/service"
+	"github.com/itomofumi/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+// mailerMock stores sent mails, or fails with err.
+type mailerMock struct {
+	sent []*infra.Mail
+	err  error
+}
+
+func (m *mailerMock) Send(mail *infra.Mail) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, mail)
+	return nil
+}
+
+var errMail = errors.New("mail server is down")
+
+var testVerificationConfig = &service.VerificationConfig{
+	Secret:         []byte("secret"),
+	Expire:         time.Hour,
+	ResendInterval: time.Minute,
+	URL:            "https://example.com/verify",
+}
+
+func newUnverifiedUser() *model.User {
+	return &model.User{
+		Common:        model.Common{ID: 1, IsDeleted: ptr.Bool(false)},
+		Email:         "foo@example.com",
+		EmailVerified: ptr.Bool(false),
+		UserPublicData: model.UserPublicData{
+			UserProfile: model.UserProfile{DisplayName: ptr.String("foo")},
+		},
+	}
+}
+
+func TestVerifications_SendAndVerify(t *testing.T) {
+	user := newUnverifiedUser()
+	verified := false
+	var sentAt *time.Time
+	repo := &usersRepositoryMock{
+		FakeGetByEmail: func(email string) (*model.User, bool) { return user, true },
+		FakeGetByID:    func(id uint64) (*model.User, bool) { return user, id == user.ID },
+		FakeMarkVerificationSent: func(userID uint64, at time.Time, interval time.Duration) (bool, error) {
+			sentAt = &at
+			return true, nil
+		},
+		FakeConsumeVerification: func(userID uint64, at time.Time) (bool, error) {
+			if sentAt == nil || !sentAt.Equal(at) {
+				return false, nil
+			}
+			sentAt = nil
+			verified = true
+			return true, nil
+		},
+	}
+	mailer := &mailerMock{}
+	v := service.NewVerifications(repo, mailer, testVerificationConfig)
+
+	assert := assert.New(t)
+	if err := v.Send(user.Email, "ja"); err != nil {
+		t.Fatalf("Verifications.Send() error = %v", err)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("mails sent = %d, want %d", len(mailer.sent), 1)
+	}
+	mail := mailer.sent[0]
+	assert.Equal([]string{user.Email}, mail.To)
+	assert.Equal("メールアドレスの確認", mail.Subject)
+	assert.Contains(mail.Body, "foo 様")
+	assert.Contains(mail.Body, "1 時間")
+
+	link, err := url.Parse(regexp.MustCompile(`https://example\.com/verify\?\S+`).FindString(mail.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := link.Query().Get("token")
+
+	// a token of an older email
+	older := *sentAt
+	sentAt = ptr.Time(older.Add(time.Minute))
+	_, err = v.Verify(token)
+	assert.Error(err)
+	assert.False(verified)
+	sentAt = &older
+
+	// tampered token
+	_, err = v.Verify(token + "x")
+	assert.Error(err)
+
+	got, err := v.Verify(token)
+	assert.NoError(err)
+	assert.True(verified)
+	assert.True(*got.EmailVerified)
+
+	// the token is used only once.
+	user.EmailVerified = ptr.Bool(false)
+	_, err = v.Verify(token)
+	assert.Error(err)
+	user.EmailVerified = ptr.Bool(true)
+	_, err = v.Verify(token)
+	assert.Equal(service.ErrAlreadyVerified, err)
+	user.EmailVerified = ptr.Bool(false)
+
+	// email has been changed after issuing the token
+	user.Email = "bar@example.com"
+	_, err = v.Verify(token)
+	assert.Error(err)
+}
+
+func TestVerifications_Send(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      *model.User
+		throttled bool
+		mailErr   error
+		wantErr   error
+	}{
+		{"success", newUnverifiedUser(), false, nil, nil},
+		{"not found", nil, false, nil, service.ErrVerificationUserNotFound},
+		{"already verified",
+			&model.User{Common: model.Common{ID: 1}, EmailVerified: ptr.Bool(true)},
+			false, nil, service.ErrAlreadyVerified},
+		{"throttled", newUnverifiedUser(), true, nil, service.ErrVerificationThrottled},
+		{"mail failed", newUnverifiedUser(), false, errMail, errMail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var markedAt *time.Time
+			repo := &usersRepositoryMock{
+				FakeGetByEmail: func(email string) (*model.User, bool) { return tt.user, tt.user != nil },
+				FakeMarkVerificationSent: func(userID uint64, sentAt time.Time, interval time.Duration) (bool, error) {
+					if tt.throttled {
+						return false, nil
+					}
+					markedAt = &sentAt
+					return true, nil
+				},
+				FakeUnmarkVerificationSent: func(userID uint64, sentAt time.Time) error {
+					assert.Equal(t, *markedAt, sentAt)
+					markedAt = nil
+					return nil
+				},
+			}
+			mailer := &mailerMock{err: tt.mailErr}
+			v := service.NewVerifications(repo, mailer, testVerificationConfig)
+
+			err := v.Send("foo@example.com", "en")
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantErr == nil, len(mailer.sent) == 1)
+			// only sent emails throttle the user.
+			assert.Equal(t, tt.wantErr == nil, markedAt != nil)
+		})
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", "en"},
+		{"ja", "ja"},
+		{"fr-CA,fr;q=0.9", "fr"},
+		{"de-DE,ja;q=0.5", "ja"},
+		{"de-DE", "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			assert.Equal(t, tt.want, service.MatchLocale(tt.acceptLanguage))
+		})
+	}
+}
+
+func TestVerificationMailTemplates(t *testing.T) {
+	for _, locale := range []string{"en", "ja", "fr"} {
+		t.Run(locale, func(t *testing.T) {
+			user := newUnverifiedUser()
+			user.DisplayName = nil
+			repo := &usersRepositoryMock{
+				FakeGetByEmail: func(email string) (*model.User, bool) { return user, true },
+				FakeMarkVerificationSent: func(userID uint64, sentAt time.Time, interval time.Duration) (bool, error) {
+					return true, nil
+				},
+			}
+			mailer := &mailerMock{}
+			v := service.NewVerifications(repo, mailer, testVerificationConfig)
+			if err := v.Send(user.Email, locale); err != nil {
+				t.Fatal(err)
+			}
+			body := mailer.sent[0].Body
+			assert.Contains(t, body, "https://example.com/verify?token=")
+			assert.False(t, strings.Contains(body, "<nil>"), "body should not contain <nil>")
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package util
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx with the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// GetRequestID returns the request ID of ctx, or "" if it is not set.
+func GetRequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
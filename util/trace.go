@@ -0,0 +1,63 @@
+package util
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of spans of this API.
+const TracerName = "github.com/itomofumi/go-gin-xorm-starter"
+
+// Tracer returns the tracer of the global tracer provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// EndSpan records err if any and ends the span.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceScope holds the current context of a request while services, repositories and queries call each other,
+// so that their spans are nested without passing context.Context to every method.
+type TraceScope struct {
+	mu  sync.Mutex
+	ctx context.Context
+}
+
+// NewTraceScope initializes a scope with the request context.
+func NewTraceScope(ctx context.Context) *TraceScope {
+	return &TraceScope{ctx: ctx}
+}
+
+// Context returns the context of the current span.
+func (s *TraceScope) Context() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ctx
+}
+
+// Start starts a child span of the current span. end records the error of the call
+// and restores the parent span.
+func (s *TraceScope) Start(name string, attrs ...attribute.KeyValue) (end func(err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parent := s.ctx
+	ctx, span := Tracer().Start(parent, name, trace.WithAttributes(attrs...))
+	s.ctx = ctx
+	return func(err error) {
+		EndSpan(span, err)
+		s.mu.Lock()
+		s.ctx = parent
+		s.mu.Unlock()
+	}
+}